@@ -0,0 +1,298 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// ======== Activity ========
+
+// Activity kinds recorded in the activity_events table. Trophy rules refer to
+// these strings, so renaming one requires updating the seeded trophies too.
+// Matrix kinds are recorded by the /api/matrix endpoints, solved problems and
+// completed quizzes by POST /api/me/problems and POST /api/me/quizzes.
+const (
+	ActivityMatrixAdd      = "matrix.add"
+	ActivityMatrixSubtract = "matrix.subtract"
+	ActivityMatrixMultiply = "matrix.multiply"
+	ActivityMatrixRREF     = "matrix.rref"
+	ActivityProblemSolved  = "problem.solved"
+	ActivityQuizCompleted  = "quiz.completed"
+)
+
+// recordActivity stores one activity event for userID and awards the XP and
+// any trophies that the new event unlocks.
+func recordActivity(userID int, kind string) error {
+	if _, err := db.Exec("INSERT INTO activity_events (user_id, kind) VALUES (?, ?)", userID, kind); err != nil {
+		return err
+	}
+	stats, err := awardTrophies(userID)
+	if err != nil {
+		return err
+	}
+	return awardActivityXP(userID, kind, stats.Streak)
+}
+
+// trackActivity records kind for the requesting user when one is known.
+// Failures are logged rather than returned so that tracking never breaks the
+// request that triggered it.
+func trackActivity(r *http.Request, kind string) {
+	if db == nil {
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		return
+	}
+	if err := recordActivity(userID, kind); err != nil {
+		log.Printf("failed to record %s activity for user %d: %v", kind, userID, err)
+	}
+}
+
+// ActivityStats summarizes a user's activity history for trophy evaluation.
+type ActivityStats struct {
+	Counts map[string]int // events per kind
+	Total  int            // events of any kind
+	Streak int            // consecutive active days ending today or yesterday
+}
+
+// countOf returns the number of events of kind, or of any kind when kind is empty.
+func (s ActivityStats) countOf(kind string) int {
+	if kind == "" {
+		return s.Total
+	}
+	return s.Counts[kind]
+}
+
+// currentStreak counts consecutive days in days (sorted newest first, one entry
+// per day) that end today or yesterday relative to now.
+func currentStreak(days []time.Time, now time.Time) int {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	expected := today
+	streak := 0
+	for i, d := range days {
+		day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+		if i == 0 && day.Equal(today.AddDate(0, 0, -1)) {
+			// A streak stays alive until the end of the day after the last activity.
+			expected = day
+		}
+		if !day.Equal(expected) {
+			break
+		}
+		streak++
+		expected = expected.AddDate(0, 0, -1)
+	}
+	return streak
+}
+
+// getActivityStats loads per-kind event counts and the current streak for userID.
+func getActivityStats(userID int) (ActivityStats, error) {
+	stats := ActivityStats{Counts: map[string]int{}}
+
+	rows, err := db.Query("SELECT kind, COUNT(*) FROM activity_events WHERE user_id = ? GROUP BY kind", userID)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind string
+		var n int
+		if err := rows.Scan(&kind, &n); err != nil {
+			return stats, err
+		}
+		stats.Counts[kind] = n
+		stats.Total += n
+	}
+	if err := rows.Err(); err != nil {
+		return stats, err
+	}
+
+	dayRows, err := db.Query(
+		"SELECT DISTINCT DATE(created_at) AS day FROM activity_events WHERE user_id = ? ORDER BY day DESC LIMIT 400",
+		userID,
+	)
+	if err != nil {
+		return stats, err
+	}
+	defer dayRows.Close()
+	var days []time.Time
+	for dayRows.Next() {
+		var d time.Time
+		if err := dayRows.Scan(&d); err != nil {
+			return stats, err
+		}
+		days = append(days, d)
+	}
+	if err := dayRows.Err(); err != nil {
+		return stats, err
+	}
+	stats.Streak = currentStreak(days, time.Now().UTC())
+	return stats, nil
+}
+
+// ======== Trophies ========
+
+// Trophy rule types stored in trophies.rule.
+const (
+	TrophyRuleCount  = "count"  // at least Threshold events of EventKind
+	TrophyRuleStreak = "streak" // at least Threshold consecutive active days
+)
+
+// Trophy is one entry of the trophy catalog stored in the trophies table.
+// New trophies are added as rows; the rule fields decide when one is earned.
+type Trophy struct {
+	ID          int    `json:"id"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	Rule        string `json:"rule"`
+	EventKind   string `json:"event_kind,omitempty"`
+	Threshold   int    `json:"threshold"`
+}
+
+// Earned reports whether stats satisfy the trophy's rule. Unknown rule types
+// are never earned so that a bad catalog row cannot award everything.
+func (t Trophy) Earned(stats ActivityStats) bool {
+	switch t.Rule {
+	case TrophyRuleCount:
+		return stats.countOf(t.EventKind) >= t.Threshold
+	case TrophyRuleStreak:
+		return stats.Streak >= t.Threshold
+	default:
+		return false
+	}
+}
+
+// TrophyStatus pairs a catalog trophy with whether the user has earned it.
+type TrophyStatus struct {
+	Trophy
+	Earned    bool       `json:"earned"`
+	AwardedAt *time.Time `json:"awarded_at,omitempty"`
+}
+
+// TrophiesResponse is the JSON payload returned by GET /api/me/trophies.
+type TrophiesResponse struct {
+	Earned   int            `json:"earned"`
+	Streak   int            `json:"streak"`
+	Trophies []TrophyStatus `json:"trophies"`
+}
+
+// GetTrophies returns the active trophy catalog.
+func GetTrophies() ([]Trophy, error) {
+	rows, err := db.Query(`
+        SELECT id, slug, name, COALESCE(description,''), COALESCE(icon,''),
+        rule, COALESCE(event_kind,''), threshold
+        FROM trophies
+        WHERE is_active = TRUE
+        ORDER BY sort_order, id
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trophies []Trophy
+	for rows.Next() {
+		var t Trophy
+		if err := rows.Scan(&t.ID, &t.Slug, &t.Name, &t.Description, &t.Icon,
+			&t.Rule, &t.EventKind, &t.Threshold); err != nil {
+			return nil, err
+		}
+		trophies = append(trophies, t)
+	}
+	return trophies, rows.Err()
+}
+
+// awardTrophies evaluates every active trophy against userID's activity and
+// persists the ones earned. Awards are idempotent: a trophy already held is
+// left untouched, so calling this repeatedly is safe.
+func awardTrophies(userID int) (ActivityStats, error) {
+	stats, err := getActivityStats(userID)
+	if err != nil {
+		return stats, err
+	}
+	trophies, err := GetTrophies()
+	if err != nil {
+		return stats, err
+	}
+	for _, t := range trophies {
+		if !t.Earned(stats) {
+			continue
+		}
+		if _, err := db.Exec(
+			"INSERT IGNORE INTO user_trophies (user_id, trophy_id) VALUES (?, ?)",
+			userID, t.ID,
+		); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// getUserTrophyAwards returns the award time of each trophy held by userID, keyed by trophy ID.
+func getUserTrophyAwards(userID int) (map[int]time.Time, error) {
+	rows, err := db.Query("SELECT trophy_id, awarded_at FROM user_trophies WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	awards := map[int]time.Time{}
+	for rows.Next() {
+		var id int
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		awards[id] = at
+	}
+	return awards, rows.Err()
+}
+
+// ======== HTTP Handlers ========
+
+// handleGetMyTrophies serves GET /api/me/trophies.
+//
+// Trophies are re-evaluated before responding so that catalog rows added since
+// the user's last activity are awarded retroactively.
+func handleGetMyTrophies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	stats, err := awardTrophies(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	trophies, err := GetTrophies()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	awards, err := getUserTrophyAwards(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := TrophiesResponse{Streak: stats.Streak, Trophies: []TrophyStatus{}}
+	for _, t := range trophies {
+		status := TrophyStatus{Trophy: t}
+		if at, ok := awards[t.ID]; ok {
+			status.Earned = true
+			status.AwardedAt = &at
+			resp.Earned++
+		}
+		resp.Trophies = append(resp.Trophies, status)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
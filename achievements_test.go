@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// day returns midnight UTC for the given date.
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// TestCurrentStreak verifies streak counting from distinct activity days.
+func TestCurrentStreak(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2025, time.March, 10, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		days     []time.Time
+		expected int
+	}{
+		{"No activity", nil, 0},
+		{"Active only today", []time.Time{day(2025, 3, 10)}, 1},
+		{"Three days ending today", []time.Time{day(2025, 3, 10), day(2025, 3, 9), day(2025, 3, 8)}, 3},
+		{"Streak ending yesterday is still alive", []time.Time{day(2025, 3, 9), day(2025, 3, 8)}, 2},
+		{"Gap breaks the streak", []time.Time{day(2025, 3, 10), day(2025, 3, 8), day(2025, 3, 7)}, 1},
+		{"Last activity two days ago", []time.Time{day(2025, 3, 8), day(2025, 3, 7)}, 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := currentStreak(tt.days, now); got != tt.expected {
+				t.Errorf("currentStreak() observed = %d, expected: %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestTrophyEarned verifies count and streak rules against activity stats.
+func TestTrophyEarned(t *testing.T) {
+	t.Parallel()
+	stats := ActivityStats{
+		Counts: map[string]int{ActivityMatrixRREF: 1, ActivityProblemSolved: 99},
+		Total:  100,
+		Streak: 7,
+	}
+	tests := []struct {
+		name     string
+		trophy   Trophy
+		expected bool
+	}{
+		{"First RREF", Trophy{Rule: TrophyRuleCount, EventKind: ActivityMatrixRREF, Threshold: 1}, true},
+		{"100 problems not yet reached", Trophy{Rule: TrophyRuleCount, EventKind: ActivityProblemSolved, Threshold: 100}, false},
+		{"Any activity counts every kind", Trophy{Rule: TrophyRuleCount, Threshold: 100}, true},
+		{"Kind never recorded", Trophy{Rule: TrophyRuleCount, EventKind: ActivityQuizCompleted, Threshold: 1}, false},
+		{"7-day streak", Trophy{Rule: TrophyRuleStreak, Threshold: 7}, true},
+		{"30-day streak", Trophy{Rule: TrophyRuleStreak, Threshold: 30}, false},
+		{"Unknown rule is never earned", Trophy{Rule: "bogus", Threshold: 0}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.trophy.Earned(stats); got != tt.expected {
+				t.Errorf("Earned() observed = %v, expected: %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestSeededTrophyKinds verifies every seeded trophy counts an activity kind
+// that an endpoint records, so no seeded trophy is unreachable.
+func TestSeededTrophyKinds(t *testing.T) {
+	t.Parallel()
+	schema, err := os.ReadFile("schema.sql")
+	if err != nil {
+		t.Fatalf("reading schema.sql: %v", err)
+	}
+	recorded := map[string]bool{
+		ActivityMatrixAdd:      true,
+		ActivityMatrixSubtract: true,
+		ActivityMatrixMultiply: true,
+		ActivityMatrixRREF:     true,
+		ActivityProblemSolved:  true,
+		ActivityQuizCompleted:  true,
+	}
+
+	seedRE := regexp.MustCompile(`\('([\w-]+)', '[^']*', '[^']*', '[\w-]+', '(?:count|streak)', (NULL|'[\w.]+'), \d+, \d+\)`)
+	seeds := seedRE.FindAllStringSubmatch(string(schema), -1)
+	if len(seeds) == 0 {
+		t.Fatal("found no seeded trophies in schema.sql")
+	}
+	for _, m := range seeds {
+		slug, kind := m[1], m[2]
+		if kind != "NULL" && !recorded[kind[1:len(kind)-1]] {
+			t.Errorf("trophy %s counts %s, which no endpoint records", slug, kind)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== Scopes ========
+
+// API token scopes. Each scope guards a group of routes via requireScope.
+const (
+	ScopeMatrixRead    = "matrix:read"
+	ScopeAssistChat    = "assist:chat"
+	ScopeResourcesRead = "resources:read"
+)
+
+// apiTokenScopes lists every scope a token may be granted, with a description
+// shown to users when creating tokens.
+var apiTokenScopes = map[string]string{
+	ScopeMatrixRead:    "Run matrix computations",
+	ScopeAssistChat:    "Chat with the problem assistant",
+	ScopeResourcesRead: "Browse learning resources",
+}
+
+// apiTokenPrefix marks G6Labs tokens so they are recognizable in scripts and
+// secret scanners.
+const apiTokenPrefix = "g6_"
+
+const (
+	maxAPITokenNameLen  = 100
+	maxAPITokensPerUser = 20
+)
+
+// normalizeScopes validates scopes and returns them sorted without duplicates.
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		if _, ok := apiTokenScopes[s]; !ok {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// ======== Types ========
+
+// APIToken is a personal access token as listed to its owner. The secret
+// itself is only returned once, at creation.
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // first characters of the token, for recognition
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateAPITokenRequest is the JSON payload for POST /api/me/tokens.
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 means never
+}
+
+// CreateAPITokenResponse returns the new token's metadata and its secret.
+type CreateAPITokenResponse struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+// ======== DB Functions ========
+
+// createAPIToken generates and stores a token for userID and returns it with its secret.
+func createAPIToken(userID int, req CreateAPITokenRequest) (*CreateAPITokenResponse, error) {
+	var count int
+	if err := db.QueryRow(
+		"SELECT COUNT(*) FROM api_tokens WHERE user_id = ? AND revoked_at IS NULL",
+		userID,
+	).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count >= maxAPITokensPerUser {
+		return nil, errAPITokenLimit
+	}
+
+	secret, err := newSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	token := apiTokenPrefix + secret
+
+	resp := &CreateAPITokenResponse{
+		APIToken: APIToken{
+			Name:      req.Name,
+			Prefix:    token[:len(apiTokenPrefix)+6],
+			Scopes:    req.Scopes,
+			CreatedAt: time.Now().UTC(),
+		},
+		Token: token,
+	}
+	var expires interface{}
+	if req.ExpiresInDays > 0 {
+		at := resp.CreatedAt.AddDate(0, 0, req.ExpiresInDays)
+		resp.ExpiresAt = &at
+		expires = at
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, req.Name, hashSessionToken(token), resp.Prefix, strings.Join(req.Scopes, ","), expires,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	resp.ID = int(id)
+	return resp, nil
+}
+
+// getAPITokens lists userID's active tokens, newest first.
+func getAPITokens(userID int) ([]APIToken, error) {
+	rows, err := db.Query(`
+        SELECT id, name, prefix, scopes, created_at, last_used_at, expires_at
+        FROM api_tokens
+        WHERE user_id = ? AND revoked_at IS NULL
+        ORDER BY created_at DESC, id DESC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &scopes, &t.CreatedAt, &t.LastUsedAt, &t.ExpiresAt); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// revokeAPIToken marks one of userID's tokens as revoked.
+func revokeAPIToken(userID, tokenID int) error {
+	result, err := db.Exec(
+		"UPDATE api_tokens SET revoked_at = UTC_TIMESTAMP() WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		tokenID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errAPITokenNotFound
+	}
+	return nil
+}
+
+var (
+	errAPITokenNotFound = errors.New("token not found")
+	errAPITokenLimit    = fmt.Errorf("at most %d active tokens are allowed", maxAPITokensPerUser)
+)
+
+// getAPITokenAuth resolves an active, unexpired token to its user and scopes
+// and records that it was used. It returns sql.ErrNoRows for unknown tokens.
+func getAPITokenAuth(token string) (*requestAuth, error) {
+	auth := &requestAuth{user: &User{}, scopes: map[string]bool{}}
+	var scopes string
+	err := db.QueryRow(`
+        SELECT t.id, t.scopes, u.id, u.first_name, u.last_name, u.email, COALESCE(u.avatar, ''), u.email_verified_at IS NOT NULL, u.role
+        FROM api_tokens t
+        JOIN users u ON u.id = t.user_id
+        WHERE t.token_hash = ? AND t.revoked_at IS NULL
+        AND (t.expires_at IS NULL OR t.expires_at > UTC_TIMESTAMP())
+    `, hashSessionToken(token)).Scan(&auth.tokenID, &scopes,
+		&auth.user.ID, &auth.user.FName, &auth.user.LName, &auth.user.Email, &auth.user.Avatar, &auth.user.EmailVerified, &auth.user.Role)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range strings.Split(scopes, ",") {
+		auth.scopes[s] = true
+	}
+	if _, err := db.Exec("UPDATE api_tokens SET last_used_at = UTC_TIMESTAMP() WHERE id = ?", auth.tokenID); err != nil {
+		log.Printf("failed to record use of API token %d: %v", auth.tokenID, err)
+	}
+	return auth, nil
+}
+
+// ======== Middleware ========
+
+// bearerToken extracts the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(h[7:])
+	return token, token != ""
+}
+
+// requireScope guards a route group for API tokens: token-authenticated
+// requests must carry scope (403 otherwise), and only then does the token's
+// user become visible to the handler. Session and anonymous requests are
+// unaffected, so public endpoints stay public.
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth, _ := r.Context().Value(authKey).(*requestAuth)
+		if auth != nil && auth.tokenID != 0 {
+			if !auth.scopes[scope] {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "token lacks scope " + scope})
+				return
+			}
+			scoped := *auth
+			scoped.scoped = true
+			r = r.WithContext(context.WithValue(r.Context(), authKey, &scoped))
+		}
+		next(w, r)
+	}
+}
+
+// ======== HTTP Handlers ========
+
+// handleAPITokens serves /api/me/tokens.
+//
+// GET lists the user's active tokens and POST creates one. Tokens can only be
+// managed from a browser session, never with another token.
+func handleAPITokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok || !isSessionRequest(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := getAPITokens(userID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"tokens": tokens, "scopes": apiTokenScopes})
+
+	case http.MethodPost:
+		defer r.Body.Close()
+		var req CreateAPITokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > maxAPITokenNameLen {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("name must be 1-%d characters", maxAPITokenNameLen)})
+			return
+		}
+		if req.ExpiresInDays < 0 || req.ExpiresInDays > 365 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expires_in_days must be between 0 and 365"})
+			return
+		}
+		scopes, err := normalizeScopes(req.Scopes)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		req.Scopes = scopes
+
+		created, err := createAPIToken(userID, req)
+		if errors.Is(err, errAPITokenLimit) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or POST"})
+	}
+}
+
+// handleAPIToken serves DELETE /api/me/tokens/{id}, which revokes a token.
+func handleAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use DELETE"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok || !isSessionRequest(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	tokenID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid token id"})
+		return
+	}
+	if err := revokeAPIToken(userID, tokenID); err != nil {
+		if errors.Is(err, errAPITokenNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
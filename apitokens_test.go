@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestNormalizeScopes verifies scope validation, de-duplication and ordering.
+func TestNormalizeScopes(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		scopes    []string
+		expected  []string
+		expectErr bool
+	}{
+		{"Sorted and de-duplicated", []string{"resources:read", " matrix:read", "matrix:read"}, []string{"matrix:read", "resources:read"}, false},
+		{"Unknown scope", []string{"matrix:write"}, nil, true},
+		{"No scopes", []string{" "}, nil, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := normalizeScopes(tt.scopes)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("normalizeScopes() error status: observed error = %v, want expected error: %v", err, tt.expectErr)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("normalizeScopes() observed = %v, expected: %v", actual, tt.expected)
+			}
+		})
+	}
+}
+
+// TestBearerToken verifies parsing of the Authorization header.
+func TestBearerToken(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		header   string
+		expected string
+		ok       bool
+	}{
+		{"Bearer g6_abc", "g6_abc", true},
+		{"bearer   g6_abc ", "g6_abc", true},
+		{"Basic dXNlcjpwYXNz", "", false},
+		{"Bearer ", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", tt.header)
+		token, ok := bearerToken(req)
+		if token != tt.expected || ok != tt.ok {
+			t.Errorf("bearerToken(%q) observed = (%q, %v), expected: (%q, %v)", tt.header, token, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+// TestRequireScope verifies that tokens need the route's scope and only
+// identify their user on scoped routes.
+func TestRequireScope(t *testing.T) {
+	t.Parallel()
+	tokenAuth := &requestAuth{user: &User{ID: 7}, tokenID: 1, scopes: map[string]bool{ScopeMatrixRead: true}}
+
+	tests := []struct {
+		name           string
+		auth           *requestAuth
+		scope          string
+		expectedStatus int
+		expectedUser   int
+	}{
+		{"Anonymous request stays public", nil, ScopeMatrixRead, http.StatusOK, 0},
+		{"Session is not restricted by scopes", &requestAuth{user: &User{ID: 3}}, ScopeAssistChat, http.StatusOK, 3},
+		{"Token with scope", tokenAuth, ScopeMatrixRead, http.StatusOK, 7},
+		{"Token without scope", tokenAuth, ScopeAssistChat, http.StatusForbidden, 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.auth != nil {
+				req = req.WithContext(context.WithValue(req.Context(), authKey, tt.auth))
+			}
+			var seenUser int
+			rr := httptest.NewRecorder()
+			requireScope(tt.scope, func(w http.ResponseWriter, r *http.Request) {
+				seenUser, _ = requestUserID(r)
+				w.WriteHeader(http.StatusOK)
+			})(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, observed: %d", tt.expectedStatus, rr.Code)
+			}
+			if seenUser != tt.expectedUser {
+				t.Errorf("Handler saw user %d, expected: %d", seenUser, tt.expectedUser)
+			}
+		})
+	}
+
+	// Outside requireScope a token does not identify anyone.
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req = req.WithContext(context.WithValue(req.Context(), authKey, tokenAuth))
+	if id, ok := requestUserID(req); ok {
+		t.Errorf("requestUserID() on an unscoped route observed = %d, expected anonymous", id)
+	}
+}
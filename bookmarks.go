@@ -0,0 +1,818 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ======== Types ========
+
+// Bookmark is a resource saved by a user, with the collections holding it.
+type Bookmark struct {
+	Resource
+	BookmarkedAt  time.Time `json:"bookmarked_at"`
+	CollectionIDs []int     `json:"collection_ids"`
+}
+
+// Collection is a named group of a user's bookmarks. ShareURL is set while
+// the collection is shared.
+type Collection struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	ItemCount   int       `json:"item_count"`
+	ShareURL    string    `json:"share_url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CollectionDetail is a collection with its resources, most recently added
+// first.
+type CollectionDetail struct {
+	Collection
+	Resources []Resource `json:"resources"`
+}
+
+// CollectionRequest is the JSON payload for creating or renaming a collection.
+type CollectionRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SharedCollection is a collection as seen by anyone holding its share link.
+type SharedCollection struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	OwnerName   string     `json:"owner_name"` // first name and last initial
+	Resources   []Resource `json:"resources"`
+}
+
+const (
+	maxCollectionNameLen = 100
+	maxCollectionDescLen = 500 // characters
+	maxCollections       = 100
+)
+
+var (
+	errCollectionNotFound  = errors.New("collection not found")
+	errBookmarkNotFound    = errors.New("bookmark not found")
+	errCollectionNameTaken = errors.New("you already have a collection with this name")
+	errTooManyCollections  = fmt.Errorf("at most %d collections are allowed", maxCollections)
+)
+
+// ======== Validation ========
+
+// validateCollectionRequest checks a collection payload and trims its fields.
+func validateCollectionRequest(req *CollectionRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if utf8.RuneCountInString(req.Name) > maxCollectionNameLen {
+		return fmt.Errorf("name is longer than %d characters", maxCollectionNameLen)
+	}
+	if utf8.RuneCountInString(req.Description) > maxCollectionDescLen {
+		return fmt.Errorf("description is longer than %d characters", maxCollectionDescLen)
+	}
+	return nil
+}
+
+// newShareToken returns a random URL-safe token with 128 bits of entropy.
+// Share tokens only grant read access to one collection, so they are stored
+// as is and the owner can copy the link again later.
+func newShareToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// collectionShareURL returns the public page of a share token, or "".
+func collectionShareURL(token string) string {
+	if token == "" {
+		return ""
+	}
+	return appBaseURL() + "/shared/collections/" + token
+}
+
+// ======== DB Functions ========
+
+// addBookmark saves an active resource for userID. Bookmarking twice is not
+// an error.
+func addBookmark(userID, resourceID int) error {
+	result, err := db.Exec(`
+        INSERT IGNORE INTO resource_bookmarks (user_id, resource_id, created_at)
+        SELECT ?, id, UTC_TIMESTAMP() FROM resources WHERE id = ? AND is_active = TRUE`,
+		userID, resourceID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Either already bookmarked or not an active resource.
+		var exists bool
+		if err := db.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM resource_bookmarks WHERE user_id = ? AND resource_id = ?)",
+			userID, resourceID,
+		).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return errResourceNotFound
+		}
+	}
+	return nil
+}
+
+// removeBookmark unsaves resourceID for userID and takes it out of their
+// collections.
+func removeBookmark(userID, resourceID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+        DELETE i FROM bookmark_collection_items i
+        JOIN bookmark_collections c ON c.id = i.collection_id
+        WHERE c.user_id = ? AND i.resource_id = ?`,
+		userID, resourceID,
+	); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM resource_bookmarks WHERE user_id = ? AND resource_id = ?", userID, resourceID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errBookmarkNotFound
+	}
+	return tx.Commit()
+}
+
+// getBookmarks returns userID's bookmarks of active resources, newest first,
+// optionally limited to one of their collections.
+func getBookmarks(userID, collectionID int) ([]Bookmark, error) {
+	query := `
+        SELECT ` + resourceColumns + `, bm.created_at,
+        COALESCE((SELECT GROUP_CONCAT(i.collection_id ORDER BY i.collection_id SEPARATOR ',')
+            FROM bookmark_collection_items i
+            JOIN bookmark_collections c ON c.id = i.collection_id
+            WHERE c.user_id = bm.user_id AND i.resource_id = r.id), '')
+        FROM resource_bookmarks bm
+        JOIN resources r ON r.id = bm.resource_id
+        WHERE bm.user_id = ? AND r.is_active = TRUE
+    `
+	args := []interface{}{userID, userID}
+	if collectionID > 0 {
+		query += " AND bm.resource_id IN (SELECT resource_id FROM bookmark_collection_items WHERE collection_id = ?)"
+		args = append(args, collectionID)
+	}
+	query += " ORDER BY bm.created_at DESC, r.id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bookmarks := []Bookmark{}
+	for rows.Next() {
+		var b Bookmark
+		var collections string
+		b.Resource, err = scanResource(rows, &b.BookmarkedAt, &collections)
+		if err != nil {
+			return nil, err
+		}
+		b.CollectionIDs = []int{}
+		for _, s := range strings.Split(collections, ",") {
+			if id, err := strconv.Atoi(s); err == nil {
+				b.CollectionIDs = append(b.CollectionIDs, id)
+			}
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
+
+// getCollections returns userID's collections by name, optionally limited to
+// one.
+func getCollections(userID, collectionID int) ([]Collection, error) {
+	query := `
+        SELECT c.id, c.name, c.description, COALESCE(c.share_token, ''), c.created_at, c.updated_at,
+        (SELECT COUNT(*) FROM bookmark_collection_items i
+            JOIN resources r ON r.id = i.resource_id
+            WHERE i.collection_id = c.id AND r.is_active = TRUE)
+        FROM bookmark_collections c
+        WHERE c.user_id = ?
+    `
+	args := []interface{}{userID}
+	if collectionID > 0 {
+		query += " AND c.id = ?"
+		args = append(args, collectionID)
+	}
+	query += " ORDER BY c.name, c.id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	collections := []Collection{}
+	for rows.Next() {
+		var c Collection
+		var token string
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &token, &c.CreatedAt, &c.UpdatedAt, &c.ItemCount); err != nil {
+			return nil, err
+		}
+		c.ShareURL = collectionShareURL(token)
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// getCollection returns one of userID's collections with its resources.
+func getCollection(userID, collectionID int) (*CollectionDetail, error) {
+	collections, err := getCollections(userID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return nil, errCollectionNotFound
+	}
+	c := CollectionDetail{Collection: collections[0]}
+	c.Resources, err = getCollectionResources(collectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// getCollectionResources returns the active resources of a collection, most
+// recently added first. is_bookmarked is set for viewerID.
+func getCollectionResources(collectionID, viewerID int) ([]Resource, error) {
+	rows, err := db.Query(`
+        SELECT `+resourceColumns+`
+        FROM bookmark_collection_items i
+        JOIN resources r ON r.id = i.resource_id
+        WHERE i.collection_id = ? AND r.is_active = TRUE
+        ORDER BY i.added_at DESC, r.id DESC
+    `, viewerID, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	resources := []Resource{}
+	for rows.Next() {
+		r, err := scanResource(rows)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, r)
+	}
+	return resources, rows.Err()
+}
+
+// collectionNameTaken reports whether userID has another collection named name.
+func collectionNameTaken(tx *sql.Tx, userID, collectionID int, name string) (bool, error) {
+	var n int
+	err := tx.QueryRow(
+		"SELECT COUNT(*) FROM bookmark_collections WHERE user_id = ? AND name = ? AND id <> ?",
+		userID, name, collectionID,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// createCollection inserts an empty collection for userID.
+func createCollection(userID int, req CollectionRequest) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Locking the user row serializes creates, so the limit and the name
+	// check cannot race.
+	var id int
+	if err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Scan(&id); err != nil {
+		return 0, err
+	}
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM bookmark_collections WHERE user_id = ?", userID).Scan(&n); err != nil {
+		return 0, err
+	}
+	if n >= maxCollections {
+		return 0, errTooManyCollections
+	}
+	if taken, err := collectionNameTaken(tx, userID, 0, req.Name); err != nil || taken {
+		if err == nil {
+			err = errCollectionNameTaken
+		}
+		return 0, err
+	}
+	result, err := tx.Exec(
+		"INSERT INTO bookmark_collections (user_id, name, description, created_at, updated_at) VALUES (?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP())",
+		userID, req.Name, req.Description,
+	)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(newID), tx.Commit()
+}
+
+// lockCollection checks inside tx that collectionID belongs to userID and
+// locks it for the rest of the transaction.
+func lockCollection(tx *sql.Tx, userID, collectionID int) error {
+	var owner int
+	err := tx.QueryRow("SELECT user_id FROM bookmark_collections WHERE id = ? FOR UPDATE", collectionID).Scan(&owner)
+	if err == sql.ErrNoRows || (err == nil && owner != userID) {
+		return errCollectionNotFound
+	}
+	return err
+}
+
+// updateCollection renames one of userID's collections.
+func updateCollection(userID, collectionID int, req CollectionRequest) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		return err
+	}
+	if taken, err := collectionNameTaken(tx, userID, collectionID, req.Name); err != nil || taken {
+		if err == nil {
+			err = errCollectionNameTaken
+		}
+		return err
+	}
+	if _, err := tx.Exec(
+		"UPDATE bookmark_collections SET name = ?, description = ?, updated_at = UTC_TIMESTAMP() WHERE id = ?",
+		req.Name, req.Description, collectionID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteCollection removes one of userID's collections. Its items cascade;
+// the bookmarks themselves are kept.
+func deleteCollection(userID, collectionID int) error {
+	result, err := db.Exec("DELETE FROM bookmark_collections WHERE id = ? AND user_id = ?", collectionID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errCollectionNotFound
+	}
+	return nil
+}
+
+// addCollectionItem puts an active resource into one of userID's
+// collections, bookmarking it first if needed.
+func addCollectionItem(userID, collectionID, resourceID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		return err
+	}
+	var id int
+	if err := tx.QueryRow("SELECT id FROM resources WHERE id = ? AND is_active = TRUE", resourceID).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return errResourceNotFound
+		}
+		return err
+	}
+	if _, err := tx.Exec(
+		"INSERT IGNORE INTO resource_bookmarks (user_id, resource_id, created_at) VALUES (?, ?, UTC_TIMESTAMP())",
+		userID, resourceID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"INSERT IGNORE INTO bookmark_collection_items (collection_id, resource_id, added_at) VALUES (?, ?, UTC_TIMESTAMP())",
+		collectionID, resourceID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE bookmark_collections SET updated_at = UTC_TIMESTAMP() WHERE id = ?", collectionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// removeCollectionItem takes a resource out of one of userID's collections.
+// It stays bookmarked.
+func removeCollectionItem(userID, collectionID, resourceID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM bookmark_collection_items WHERE collection_id = ? AND resource_id = ?", collectionID, resourceID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errBookmarkNotFound
+	}
+	if _, err := tx.Exec("UPDATE bookmark_collections SET updated_at = UTC_TIMESTAMP() WHERE id = ?", collectionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// shareCollection returns the share token of one of userID's collections,
+// creating one if it is not shared yet.
+func shareCollection(userID, collectionID int) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if err := lockCollection(tx, userID, collectionID); err != nil {
+		return "", err
+	}
+	var token sql.NullString
+	if err := tx.QueryRow("SELECT share_token FROM bookmark_collections WHERE id = ?", collectionID).Scan(&token); err != nil {
+		return "", err
+	}
+	if token.Valid {
+		return token.String, nil
+	}
+	newToken, err := newShareToken()
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("UPDATE bookmark_collections SET share_token = ? WHERE id = ?", newToken, collectionID); err != nil {
+		return "", err
+	}
+	return newToken, tx.Commit()
+}
+
+// unshareCollection revokes the share link of one of userID's collections.
+// Sharing again creates a new link.
+func unshareCollection(userID, collectionID int) error {
+	result, err := db.Exec(
+		"UPDATE bookmark_collections SET share_token = NULL WHERE id = ? AND user_id = ?",
+		collectionID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists bool
+		if err := db.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM bookmark_collections WHERE id = ? AND user_id = ?)",
+			collectionID, userID,
+		).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return errCollectionNotFound
+		}
+	}
+	return nil
+}
+
+// getSharedCollection returns the collection shared under token.
+// is_bookmarked is set for viewerID.
+func getSharedCollection(token string, viewerID int) (*SharedCollection, error) {
+	var id int
+	var c SharedCollection
+	var first, last string
+	err := db.QueryRow(`
+        SELECT c.id, c.name, c.description, u.first_name, u.last_name
+        FROM bookmark_collections c JOIN users u ON u.id = c.user_id
+        WHERE c.share_token = ?`, token,
+	).Scan(&id, &c.Name, &c.Description, &first, &last)
+	if err == sql.ErrNoRows {
+		return nil, errCollectionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.OwnerName = reviewAuthorName(first, last)
+	c.Resources, err = getCollectionResources(id, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ======== HTTP Handlers ========
+
+// handleBookmarks serves GET /api/me/bookmarks with an optional
+// collection={id} filter.
+func handleBookmarks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	collectionID := 0
+	if s := r.URL.Query().Get("collection"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil || id <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid collection id"})
+			return
+		}
+		collections, err := getCollections(userID, id)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if len(collections) == 0 {
+			writeBookmarkError(w, errCollectionNotFound)
+			return
+		}
+		collectionID = id
+	}
+	bookmarks, err := getBookmarks(userID, collectionID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, bookmarks)
+}
+
+// handleBookmark serves /api/me/bookmarks/{id}: PUT bookmarks the resource
+// and DELETE removes the bookmark.
+func handleBookmark(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	resourceID, ok := parseResourceID(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		err = addBookmark(userID, resourceID)
+	case http.MethodDelete:
+		err = removeBookmark(userID, resourceID)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use PUT or DELETE"})
+		return
+	}
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCollections serves /api/me/collections.
+//
+// GET lists the user's collections and POST creates one.
+func handleCollections(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		collections, err := getCollections(userID, 0)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, collections)
+
+	case http.MethodPost:
+		req, ok := parseCollectionRequest(w, r)
+		if !ok {
+			return
+		}
+		id, err := createCollection(userID, *req)
+		if err != nil {
+			writeBookmarkError(w, err)
+			return
+		}
+		collection, err := getCollection(userID, id)
+		if err != nil {
+			writeBookmarkError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, collection)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or POST"})
+	}
+}
+
+// handleCollection serves /api/me/collections/{id}.
+//
+// GET returns the collection with its resources, PUT renames it, and DELETE
+// removes it while keeping its bookmarks. Collections of other users are
+// reported as 404.
+func handleCollection(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	collectionID, ok := parseCollectionID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// handled after the switch
+
+	case http.MethodPut:
+		req, ok := parseCollectionRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := updateCollection(userID, collectionID, *req); err != nil {
+			writeBookmarkError(w, err)
+			return
+		}
+
+	case http.MethodDelete:
+		if err := deleteCollection(userID, collectionID); err != nil {
+			writeBookmarkError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET, PUT or DELETE"})
+		return
+	}
+
+	collection, err := getCollection(userID, collectionID)
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, collection)
+}
+
+// handleCollectionItem serves /api/me/collections/{id}/items/{resourceId}:
+// PUT adds the resource, bookmarking it if needed, and DELETE removes it.
+func handleCollectionItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	collectionID, ok := parseCollectionID(w, r)
+	if !ok {
+		return
+	}
+	resourceID, err := strconv.Atoi(r.PathValue("resourceId"))
+	if err != nil || resourceID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid resource id"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		err = addCollectionItem(userID, collectionID, resourceID)
+	case http.MethodDelete:
+		err = removeCollectionItem(userID, collectionID, resourceID)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use PUT or DELETE"})
+		return
+	}
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCollectionShare serves /api/me/collections/{id}/share: POST returns
+// the share link, creating it if needed, and DELETE revokes it.
+func handleCollectionShare(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	collectionID, ok := parseCollectionID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		token, err := shareCollection(userID, collectionID)
+		if err != nil {
+			writeBookmarkError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"share_url": collectionShareURL(token)})
+
+	case http.MethodDelete:
+		if err := unshareCollection(userID, collectionID); err != nil {
+			writeBookmarkError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST or DELETE"})
+	}
+}
+
+// handleSharedCollection serves GET /api/shared/collections/{token}. No
+// login is needed; revoked and unknown links are reported as 404.
+func handleSharedCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	token := r.PathValue("token")
+	if token == "" || len(token) > 64 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": errCollectionNotFound.Error()})
+		return
+	}
+	viewerID, _ := requestUserID(r)
+	collection, err := getSharedCollection(token, viewerID)
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, collection)
+}
+
+// parseCollectionID reads the {id} path value, writing a 400 response on
+// failure.
+func parseCollectionID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid collection id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// parseCollectionRequest decodes and validates a collection payload, writing
+// a 400 response on failure.
+func parseCollectionRequest(w http.ResponseWriter, r *http.Request) (*CollectionRequest, bool) {
+	defer r.Body.Close()
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return nil, false
+	}
+	if err := validateCollectionRequest(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	return &req, true
+}
+
+// writeBookmarkError maps bookmark and collection errors to HTTP responses.
+func writeBookmarkError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errCollectionNotFound), errors.Is(err, errBookmarkNotFound), errors.Is(err, errResourceNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, errCollectionNameTaken), errors.Is(err, errTooManyCollections):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestValidateCollectionRequest verifies collection names and descriptions
+// are required, trimmed and bounded.
+func TestValidateCollectionRequest(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		req     CollectionRequest
+		wantErr bool
+	}{
+		{"name only", CollectionRequest{Name: "Exam prep"}, false},
+		{"with description", CollectionRequest{Name: "Eigen", Description: "Videos for chapter 5"}, false},
+		{"blank name", CollectionRequest{Name: "   "}, true},
+		{"longest name", CollectionRequest{Name: strings.Repeat("é", maxCollectionNameLen)}, false},
+		{"name too long", CollectionRequest{Name: strings.Repeat("a", maxCollectionNameLen+1)}, true},
+		{"description too long", CollectionRequest{Name: "x", Description: strings.Repeat("a", maxCollectionDescLen+1)}, true},
+	}
+	for _, tt := range tests {
+		err := validateCollectionRequest(&tt.req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateCollectionRequest() observed err = %v, expected error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	req := CollectionRequest{Name: "  Exam prep ", Description: " week 3\n"}
+	if err := validateCollectionRequest(&req); err != nil || req.Name != "Exam prep" || req.Description != "week 3" {
+		t.Errorf("validateCollectionRequest() observed = %+v, err = %v, expected trimmed fields", req, err)
+	}
+}
+
+// TestShareTokens verifies share tokens are random, URL-safe and fit the
+// share_token column.
+func TestShareTokens(t *testing.T) {
+	t.Parallel()
+	a, err := newShareToken()
+	if err != nil {
+		t.Fatalf("newShareToken() observed err = %v", err)
+	}
+	b, _ := newShareToken()
+	if a == b {
+		t.Error("newShareToken() observed the same token twice")
+	}
+	if len(a) > 32 || strings.ContainsAny(a, "+/=") {
+		t.Errorf("newShareToken() observed = %q, expected at most 32 URL-safe characters", a)
+	}
+	if url := collectionShareURL(a); !strings.HasSuffix(url, "/shared/collections/"+a) || strings.Contains(url, "/api/") {
+		t.Errorf("collectionShareURL() observed = %q, expected the share page ending in the token", url)
+	}
+	if url := collectionShareURL(""); url != "" {
+		t.Errorf("collectionShareURL(\"\") observed = %q, expected: \"\"", url)
+	}
+}
+
+// TestBookmarkHandlersValidate verifies bad bookmark and collection requests
+// are refused before reaching the database.
+func TestBookmarkHandlersValidate(t *testing.T) {
+	t.Parallel()
+	ada := &User{ID: 7}
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		method   string
+		target   string
+		values   map[string]string
+		body     string
+		user     *User
+		expected int
+	}{
+		{"bookmarks logged out", handleBookmarks, http.MethodGet, "/api/me/bookmarks", nil, "", nil, http.StatusUnauthorized},
+		{"bookmarks bad collection", handleBookmarks, http.MethodGet, "/api/me/bookmarks?collection=x", nil, "", ada, http.StatusBadRequest},
+		{"bookmarks post", handleBookmarks, http.MethodPost, "/api/me/bookmarks", nil, "", ada, http.StatusMethodNotAllowed},
+		{"bookmark logged out", handleBookmark, http.MethodPut, "/api/me/bookmarks/1", map[string]string{"id": "1"}, "", nil, http.StatusUnauthorized},
+		{"bookmark bad id", handleBookmark, http.MethodPut, "/api/me/bookmarks/x", map[string]string{"id": "x"}, "", ada, http.StatusBadRequest},
+		{"bookmark post", handleBookmark, http.MethodPost, "/api/me/bookmarks/1", map[string]string{"id": "1"}, "", ada, http.StatusMethodNotAllowed},
+		{"collections logged out", handleCollections, http.MethodGet, "/api/me/collections", nil, "", nil, http.StatusUnauthorized},
+		{"collections blank name", handleCollections, http.MethodPost, "/api/me/collections", nil, `{"name":" "}`, ada, http.StatusBadRequest},
+		{"collections bad json", handleCollections, http.MethodPost, "/api/me/collections", nil, `{`, ada, http.StatusBadRequest},
+		{"collection bad id", handleCollection, http.MethodGet, "/api/me/collections/0", map[string]string{"id": "0"}, "", ada, http.StatusBadRequest},
+		{"collection patch", handleCollection, http.MethodPatch, "/api/me/collections/1", map[string]string{"id": "1"}, "", ada, http.StatusMethodNotAllowed},
+		{"item bad resource", handleCollectionItem, http.MethodPut, "/api/me/collections/1/items/x",
+			map[string]string{"id": "1", "resourceId": "x"}, "", ada, http.StatusBadRequest},
+		{"share logged out", handleCollectionShare, http.MethodPost, "/api/me/collections/1/share", map[string]string{"id": "1"}, "", nil, http.StatusUnauthorized},
+		{"share get", handleCollectionShare, http.MethodGet, "/api/me/collections/1/share", map[string]string{"id": "1"}, "", ada, http.StatusMethodNotAllowed},
+		{"shared long token", handleSharedCollection, http.MethodGet, "/api/shared/collections/x",
+			map[string]string{"token": strings.Repeat("x", 65)}, "", nil, http.StatusNotFound},
+		{"shared post", handleSharedCollection, http.MethodPost, "/api/shared/collections/abc", map[string]string{"token": "abc"}, "", nil, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		for k, v := range tt.values {
+			req.SetPathValue(k, v)
+		}
+		if tt.user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), authKey, &requestAuth{user: tt.user}))
+		}
+		rr := httptest.NewRecorder()
+		tt.handler(rr, req)
+		if rr.Code != tt.expected {
+			t.Errorf("%s: expected status %d, observed: %d (%s)", tt.name, tt.expected, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// TestCollectionOwnership verifies a user cannot read or change another
+// user's collection, and that the attempts leave it untouched.
+func TestCollectionOwnership(t *testing.T) {
+	useTestDB(t)
+	owner := createTestUser(t, "Ada", "Lovelace")
+	stranger := createTestUser(t, "Grace", "Hopper")
+	resourceID := createTestResource(t, true)
+	otherResourceID := createTestResource(t, true)
+
+	collectionID, err := createCollection(owner, CollectionRequest{Name: "Eigenvalues", Description: "Reading list"})
+	if err != nil {
+		t.Fatalf("createCollection observed error = %v", err)
+	}
+	if err := addCollectionItem(owner, collectionID, resourceID); err != nil {
+		t.Fatalf("addCollectionItem observed error = %v", err)
+	}
+	token, err := shareCollection(owner, collectionID)
+	if err != nil {
+		t.Fatalf("shareCollection observed error = %v", err)
+	}
+
+	attempts := map[string]func() error{
+		"getCollection": func() error {
+			_, err := getCollection(stranger, collectionID)
+			return err
+		},
+		"updateCollection": func() error {
+			return updateCollection(stranger, collectionID, CollectionRequest{Name: "Mine now"})
+		},
+		"addCollectionItem": func() error {
+			return addCollectionItem(stranger, collectionID, otherResourceID)
+		},
+		"removeCollectionItem": func() error {
+			return removeCollectionItem(stranger, collectionID, resourceID)
+		},
+		"shareCollection": func() error {
+			_, err := shareCollection(stranger, collectionID)
+			return err
+		},
+		"unshareCollection": func() error {
+			return unshareCollection(stranger, collectionID)
+		},
+		"deleteCollection": func() error {
+			return deleteCollection(stranger, collectionID)
+		},
+	}
+	for name, attempt := range attempts {
+		if err := attempt(); err != errCollectionNotFound {
+			t.Errorf("%s by another user observed error = %v, expected: %v", name, err, errCollectionNotFound)
+		}
+	}
+
+	c, err := getCollection(owner, collectionID)
+	if err != nil {
+		t.Fatalf("getCollection(owner) observed error = %v", err)
+	}
+	if c.Name != "Eigenvalues" || len(c.Resources) != 1 || c.Resources[0].ID != resourceID {
+		t.Errorf("getCollection(owner) observed name %q with %d resources, expected: %q with resource %d", c.Name, len(c.Resources), "Eigenvalues", resourceID)
+	}
+	if !strings.HasSuffix(c.ShareURL, "/"+token) {
+		t.Errorf("getCollection(owner) observed share_url = %q, expected to end with the token", c.ShareURL)
+	}
+	if _, err := getSharedCollection(token, stranger); err != nil {
+		t.Errorf("getSharedCollection observed error = %v, expected the link to still work", err)
+	}
+
+	var bookmarked bool
+	if err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM resource_bookmarks WHERE user_id = ? AND resource_id = ?)", stranger, otherResourceID,
+	).Scan(&bookmarked); err != nil {
+		t.Fatalf("reading bookmarks: %v", err)
+	}
+	if bookmarked {
+		t.Errorf("addCollectionItem by another user observed a bookmark, expected the transaction to roll back")
+	}
+}
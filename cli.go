@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ======== Command Line ========
+
+// cliCommand is a maintenance subcommand run as "g6labs <group> <name> ...".
+// Commands run against the configured database and exit instead of serving.
+type cliCommand struct {
+	usage string // arguments, shown in help
+	help  string
+	nargs int                       // exact number of arguments, or -1 for any
+	check func(args []string) error // optional; validates arguments before the database is opened
+	run   func(args []string, stdout io.Writer) error
+}
+
+// cliCommands maps "group name" to its command.
+var cliCommands = map[string]cliCommand{
+	"admin promote": {
+		usage: "<email>",
+		help:  "make an existing user an admin (use once to create the first admin)",
+		nargs: 1,
+		run:   cliPromoteAdmin,
+	},
+	"resources import": {
+		usage: "[-dry-run] [-format csv|json|yaml] <file>",
+		help:  "create or update resources from a file, matched by URL",
+		nargs: -1,
+		check: checkResourcesImportArgs,
+		run:   cliImportResources,
+	},
+	"resources check-links": {
+		help:  "check every resource link now and update the link report",
+		nargs: 0,
+		run:   cliCheckLinks,
+	},
+	"resources export": {
+		usage: "[-format csv|json|yaml] [file]",
+		help:  "write every resource to a file, or JSON to stdout",
+		nargs: -1,
+		check: checkResourcesExportArgs,
+		run:   cliExportResources,
+	},
+}
+
+// runCLI runs the subcommand in args and returns the process exit code:
+// 0 on success, 1 when the command fails and 2 for usage errors.
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	if len(args) < 2 {
+		cliUsage(stderr)
+		return 2
+	}
+	name := args[0] + " " + args[1]
+	cmd, ok := cliCommands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+		cliUsage(stderr)
+		return 2
+	}
+	rest := args[2:]
+	if cmd.nargs >= 0 && len(rest) != cmd.nargs {
+		fmt.Fprintf(stderr, "usage: g6labs %s %s\n", name, cmd.usage)
+		return 2
+	}
+	if cmd.check != nil {
+		if err := cmd.check(rest); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\nusage: g6labs %s %s\n", name, err, name, cmd.usage)
+			return 2
+		}
+	}
+
+	if err := InitDB(); err != nil {
+		fmt.Fprintf(stderr, "failed to connect to database: %v\n", err)
+		return 1
+	}
+	defer CloseDB()
+	if err := cmd.run(rest, stdout); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// cliUsage lists every command.
+func cliUsage(w io.Writer) {
+	names := make([]string, 0, len(cliCommands))
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "usage: g6labs               start the server")
+	fmt.Fprintln(w, "       g6labs <command>     run a maintenance command")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, name := range names {
+		cmd := cliCommands[name]
+		fmt.Fprintf(w, "  %-58s %s\n", strings.TrimSpace(name+" "+cmd.usage), cmd.help)
+	}
+}
+
+// cliPromoteAdmin implements "g6labs admin promote <email>".
+func cliPromoteAdmin(args []string, stdout io.Writer) error {
+	email := strings.TrimSpace(args[0])
+	if err := promoteAdmin(email); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s is now an admin\n", email)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestRunCLIUsageErrors verifies bad invocations exit with code 2 and a
+// usage message, without touching the database.
+func TestRunCLIUsageErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"No command", []string{"admin"}, "commands:"},
+		{"Unknown command", []string{"admin", "delete"}, `unknown command "admin delete"`},
+		{"Missing argument", []string{"admin", "promote"}, "usage: g6labs admin promote <email>"},
+		{"Extra argument", []string{"admin", "promote", "a@example.com", "b@example.com"}, "usage: g6labs admin promote <email>"},
+		{"Import without file", []string{"resources", "import", "-dry-run"}, "missing file"},
+		{"Import unknown format", []string{"resources", "import", "-format", "xml", "links.txt"}, `unknown format "xml"`},
+		{"Import unknown extension", []string{"resources", "import", "links.txt"}, "cannot tell the format"},
+		{"Export unknown flag", []string{"resources", "export", "-force"}, "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var stdout, stderr bytes.Buffer
+			if code := runCLI(tt.args, &stdout, &stderr); code != 2 {
+				t.Errorf("runCLI() observed exit code = %d, expected: 2", code)
+			}
+			if !strings.Contains(stderr.String(), tt.expected) {
+				t.Errorf("stderr observed = %q, expected to contain: %q", stderr.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ======== Resource Click-Through ========
+
+const (
+	// clickDedupWindow is how long repeat clicks by the same visitor on the
+	// same resource are recorded but not counted as new views.
+	clickDedupWindow  = 30 * time.Minute
+	maxClickStatsDays = 365
+)
+
+// ResourceClickStats summarizes clicks on one resource for the admin report.
+type ResourceClickStats struct {
+	ResourceID     int    `json:"resource_id"`
+	Title          string `json:"title"`
+	Clicks         int    `json:"clicks"`
+	CountedViews   int    `json:"counted_views"`
+	UniqueVisitors int    `json:"unique_visitors"`
+	ViewCount      int    `json:"view_count"`
+}
+
+// clickVisitor identifies who clicked, for deduplication. Logged-in users are
+// identified by account, so their clicks from several devices count once;
+// everyone else by IP address. The result is keyed with the app secret so
+// click rows never hold raw IP addresses.
+func clickVisitor(r *http.Request) string {
+	key := "ip:" + clientIP(r)
+	if userID, ok := requestUserID(r); ok {
+		key = "user:" + strconv.Itoa(userID)
+	}
+	mac := hmac.New(sha256.New, appSigningKey())
+	mac.Write([]byte("resource-click:" + key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// referrerHost returns the host part of the Referer header, or "". Only the
+// host is kept so click rows do not record which page a visitor was on.
+func referrerHost(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil {
+		return ""
+	}
+	return truncate(u.Host, 255)
+}
+
+// ======== DB Functions ========
+
+// getActiveResourceURL returns the URL of an active resource.
+func getActiveResourceURL(resourceID int) (string, error) {
+	var target string
+	err := db.QueryRow("SELECT url FROM resources WHERE id = ? AND is_active = TRUE", resourceID).Scan(&target)
+	if err == sql.ErrNoRows {
+		return "", errResourceNotFound
+	}
+	return target, err
+}
+
+// recordResourceClick stores a click event and, unless the same visitor
+// already had a counted click on the resource within clickDedupWindow,
+// increments resources.view_count. It reports whether the view counted.
+func recordResourceClick(resourceID, userID int, visitor, referrer string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Locking the resource row serializes clicks on it, so two quick clicks
+	// cannot both count.
+	var id int
+	if err := tx.QueryRow("SELECT id FROM resources WHERE id = ? FOR UPDATE", resourceID).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return false, errResourceNotFound
+		}
+		return false, err
+	}
+	var recent int
+	if err := tx.QueryRow(`
+        SELECT COUNT(*) FROM resource_clicks
+        WHERE resource_id = ? AND visitor = ? AND counted = TRUE
+          AND created_at > UTC_TIMESTAMP() - INTERVAL ? SECOND`,
+		resourceID, visitor, int(clickDedupWindow.Seconds()),
+	).Scan(&recent); err != nil {
+		return false, err
+	}
+	counted := recent == 0
+
+	var user any
+	if userID > 0 {
+		user = userID
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO resource_clicks (resource_id, user_id, visitor, referrer, counted, created_at) VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP())",
+		resourceID, user, visitor, nullIfEmpty(referrer), counted,
+	); err != nil {
+		return false, err
+	}
+	if counted {
+		if _, err := tx.Exec("UPDATE resources SET view_count = view_count + 1, updated_at = updated_at WHERE id = ?", resourceID); err != nil {
+			return false, err
+		}
+	}
+	return counted, tx.Commit()
+}
+
+// getClickStats returns click totals per resource over the last days days,
+// most clicked first.
+func getClickStats(days, limit int) ([]ResourceClickStats, error) {
+	rows, err := db.Query(`
+        SELECT r.id, r.title, COUNT(*), SUM(c.counted), COUNT(DISTINCT c.visitor), r.view_count
+        FROM resource_clicks c JOIN resources r ON r.id = c.resource_id
+        WHERE c.created_at > UTC_TIMESTAMP() - INTERVAL ? DAY
+        GROUP BY r.id
+        ORDER BY COUNT(*) DESC, r.id
+        LIMIT ?
+    `, days, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := []ResourceClickStats{}
+	for rows.Next() {
+		var s ResourceClickStats
+		if err := rows.Scan(&s.ResourceID, &s.Title, &s.Clicks, &s.CountedViews, &s.UniqueVisitors, &s.ViewCount); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// ======== HTTP Handlers ========
+
+// handleResourceClick serves GET /r/{id}: it records the click and redirects
+// to the resource. Failing to record a click never blocks the redirect.
+// HEAD requests, as sent by link previews, are redirected but not recorded.
+func handleResourceClick(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	resourceID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || resourceID <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	target, err := getActiveResourceURL(resourceID)
+	if err == errResourceNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to look up resource %d: %v", resourceID, err)
+		http.Error(w, "failed to open resource", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		userID, _ := requestUserID(r)
+		if _, err := recordResourceClick(resourceID, userID, clickVisitor(r), referrerHost(r)); err != nil {
+			log.Printf("failed to record click on resource %d: %v", resourceID, err)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handleClickStats serves GET /api/admin/resources/click-stats?days=30&limit=50.
+func handleClickStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	days, limit := 30, 50
+	if s := r.URL.Query().Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxClickStatsDays {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "days must be between 1 and 365"})
+			return
+		}
+		days = n
+	}
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 200 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 200"})
+			return
+		}
+		limit = n
+	}
+	stats, err := getClickStats(days, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestClickVisitor verifies clicks are keyed by account when logged in and by
+// IP otherwise, without storing the IP itself.
+func TestClickVisitor(t *testing.T) {
+	t.Parallel()
+	request := func(ip string, user *User) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/r/1", nil)
+		req.RemoteAddr = ip + ":50000"
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), authKey, &requestAuth{user: user}))
+		}
+		return req
+	}
+	ada := &User{ID: 7}
+
+	anon := clickVisitor(request("203.0.113.5", nil))
+	if anon != clickVisitor(request("203.0.113.5", nil)) {
+		t.Error("clickVisitor() observed different keys for the same IP")
+	}
+	if anon == clickVisitor(request("203.0.113.6", nil)) {
+		t.Error("clickVisitor() observed the same key for different IPs")
+	}
+	if strings.Contains(anon, "203.0.113.5") || len(anon) != 64 {
+		t.Errorf("clickVisitor() observed = %q, expected a 64-character hash", anon)
+	}
+	if clickVisitor(request("203.0.113.5", ada)) != clickVisitor(request("198.51.100.9", ada)) {
+		t.Error("clickVisitor() observed different keys for one user on two IPs")
+	}
+	if clickVisitor(request("203.0.113.5", ada)) == anon {
+		t.Error("clickVisitor() observed the same key for a user and an anonymous visitor")
+	}
+}
+
+// TestReferrerHost verifies only the referring host is kept.
+func TestReferrerHost(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"https://g6labs.example/resources?q=eigen": "g6labs.example",
+		"":          "",
+		"not a url": "",
+		"%zz":       "",
+	}
+	for referer, expected := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/r/1", nil)
+		req.Header.Set("Referer", referer)
+		if observed := referrerHost(req); observed != expected {
+			t.Errorf("referrerHost(%q) observed = %q, expected: %q", referer, observed, expected)
+		}
+	}
+}
+
+// TestHandleResourceClickValidates verifies bad requests are refused before
+// reaching the database.
+func TestHandleResourceClickValidates(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		method, id string
+		expected   int
+	}{
+		{http.MethodGet, "abc", http.StatusNotFound},
+		{http.MethodGet, "0", http.StatusNotFound},
+		{http.MethodPost, "1", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/r/"+tt.id, nil)
+		req.SetPathValue("id", tt.id)
+		rr := httptest.NewRecorder()
+		handleResourceClick(rr, req)
+		if rr.Code != tt.expected {
+			t.Errorf("%s /r/%s: expected status %d, observed: %d", tt.method, tt.id, tt.expected, rr.Code)
+		}
+	}
+}
+
+// TestHandleClickStatsValidates verifies out-of-range parameters get 400.
+func TestHandleClickStatsValidates(t *testing.T) {
+	t.Parallel()
+	for _, query := range []string{"days=0", "days=366", "days=x", "limit=0", "limit=201"} {
+		rr := httptest.NewRecorder()
+		handleClickStats(rr, httptest.NewRequest(http.MethodGet, "/api/admin/resources/click-stats?"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, observed: %d", query, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+// TestRecordResourceClickDedup verifies repeat clicks by one visitor within
+// clickDedupWindow are stored but counted as one view.
+func TestRecordResourceClickDedup(t *testing.T) {
+	useTestDB(t)
+	id := createTestResource(t, true)
+	click := func(visitor string, expected bool) {
+		t.Helper()
+		counted, err := recordResourceClick(id, 0, visitor, "")
+		if err != nil {
+			t.Fatalf("recordResourceClick(%s) observed error = %v", visitor, err)
+		}
+		if counted != expected {
+			t.Errorf("recordResourceClick(%s) observed counted = %v, expected: %v", visitor, counted, expected)
+		}
+	}
+
+	click("ada", true)
+	click("ada", false)
+	click("grace", true)
+
+	// Once the counted click is older than the window, the next one counts.
+	if _, err := db.Exec(
+		"UPDATE resource_clicks SET created_at = created_at - INTERVAL ? SECOND WHERE resource_id = ? AND visitor = ?",
+		int(clickDedupWindow.Seconds())+60, id, "ada",
+	); err != nil {
+		t.Fatalf("backdating clicks: %v", err)
+	}
+	click("ada", true)
+	click("ada", false)
+
+	var views, clicks int
+	if err := db.QueryRow(
+		"SELECT r.view_count, (SELECT COUNT(*) FROM resource_clicks WHERE resource_id = r.id) FROM resources r WHERE r.id = ?", id,
+	).Scan(&views, &clicks); err != nil {
+		t.Fatalf("reading counts: %v", err)
+	}
+	if views != 3 || clicks != 5 {
+		t.Errorf("observed %d views from %d clicks, expected: 3 views from 5 clicks", views, clicks)
+	}
+
+	if _, err := recordResourceClick(id+1000000, 0, "ada", ""); err != errResourceNotFound {
+		t.Errorf("recordResourceClick(unknown) observed error = %v, expected: %v", err, errResourceNotFound)
+	}
+}
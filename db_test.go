@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ============ TEST DATABASE ============
+
+// testDB is the database named by TEST_DB_DSN with schema.sql applied, or nil
+// when the DB-backed tests are skipped.
+var testDB *sql.DB
+
+// testFixtureSeq makes fixture emails and URLs unique within a run.
+var testFixtureSeq atomic.Int64
+
+// TestMain prepares the test database when TEST_DB_DSN is set, for example
+// "root:secret@tcp(localhost:3306)/g6labs_test". Use a scratch database:
+// schema.sql is applied to it, and tests add rows and delete them again.
+func TestMain(m *testing.M) {
+	if dsn := os.Getenv("TEST_DB_DSN"); dsn != "" {
+		var err error
+		if testDB, err = openTestDB(dsn); err != nil {
+			log.Fatalf("test database: %v", err)
+		}
+	}
+	code := m.Run()
+	if testDB != nil {
+		testDB.Close()
+	}
+	os.Exit(code)
+}
+
+// openTestDB applies schema.sql to the database at dsn and returns a handle
+// configured like InitDB's.
+func openTestDB(dsn string) (*sql.DB, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ParseTime = true
+
+	schema, err := os.ReadFile("schema.sql")
+	if err != nil {
+		return nil, err
+	}
+	setup := cfg.Clone()
+	setup.MultiStatements = true
+	setupDB, err := sql.Open("mysql", setup.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	defer setupDB.Close()
+	if _, err := setupDB.Exec(string(schema)); err != nil {
+		return nil, fmt.Errorf("applying schema.sql: %w", err)
+	}
+
+	conn, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// useTestDB points db at the test database until t ends, or skips t when
+// TEST_DB_DSN is not set. db is shared, so tests that call it must not be
+// parallel; parallel tests wait until they are done.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	if testDB == nil {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+	db = testDB
+	t.Cleanup(func() { db = nil })
+}
+
+// createTestUser inserts a verified user and deletes it, with everything it
+// owns, when t ends.
+func createTestUser(t *testing.T, first, last string) int {
+	t.Helper()
+	email := fmt.Sprintf("test-%d-%d@example.test", time.Now().UnixNano(), testFixtureSeq.Add(1))
+	result, err := db.Exec(
+		"INSERT INTO users (first_name, last_name, email, email_verified_at) VALUES (?, ?, ?, UTC_TIMESTAMP())",
+		first, last, email,
+	)
+	if err != nil {
+		t.Fatalf("creating test user: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	t.Cleanup(func() {
+		if _, err := testDB.Exec("DELETE FROM users WHERE id = ?", id); err != nil {
+			t.Errorf("deleting test user %d: %v", id, err)
+		}
+	})
+	return int(id)
+}
+
+// createTestResource inserts a resource of the first seeded type and deletes
+// it, with its clicks, reviews and link checks, when t ends.
+func createTestResource(t *testing.T, active bool) int {
+	t.Helper()
+	url := fmt.Sprintf("https://example.test/%d-%d", time.Now().UnixNano(), testFixtureSeq.Add(1))
+	result, err := db.Exec(`
+        INSERT INTO resources (title, url, type_id, is_active)
+        SELECT 'Test resource', ?, MIN(id), ? FROM resource_types`,
+		url, active,
+	)
+	if err != nil {
+		t.Fatalf("creating test resource: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	t.Cleanup(func() {
+		if _, err := testDB.Exec("DELETE FROM resources WHERE id = ?", id); err != nil {
+			t.Errorf("deleting test resource %d: %v", id, err)
+		}
+	})
+	return int(id)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ======== Email Verification ========
+
+const (
+	emailVerifyPurpose = "email-verify"
+	emailVerifyTTL     = 48 * time.Hour
+	// emailVerifyCooldown is the minimum time between verification emails.
+	emailVerifyCooldown = 2 * time.Minute
+)
+
+// emailVerifyClaim is the signed payload of a verification link. Binding the
+// email makes links sent to an old address useless after an email change.
+type emailVerifyClaim struct {
+	UserID int    `json:"uid"`
+	Email  string `json:"email"`
+}
+
+var errVerifyCooldown = errors.New("a verification email was sent recently; please wait before asking again")
+
+// emailVerificationMail builds the verification email for user.
+func emailVerificationMail(user *User) (Mail, error) {
+	token, err := signPayload(emailVerifyPurpose, emailVerifyClaim{UserID: user.ID, Email: user.Email}, emailVerifyTTL)
+	if err != nil {
+		return Mail{}, err
+	}
+	link := appBaseURL() + "/api/auth/verify?token=" + url.QueryEscape(token)
+	return Mail{
+		To:      user.Email,
+		Subject: "Verify your G6Labs email",
+		Body: "Hi " + user.FName + ",\n\n" +
+			"Please confirm that this is your email address by opening this link within 48 hours:\n\n" +
+			link + "\n\n" +
+			"If you did not create a G6Labs account, you can ignore this email.\n",
+	}, nil
+}
+
+// ======== DB Functions ========
+
+// claimVerificationSend records that a verification email is being sent to
+// userID. It returns errVerifyCooldown if one went out within
+// emailVerifyCooldown, and false if the email is already verified.
+func claimVerificationSend(userID int) (bool, error) {
+	now := time.Now().UTC()
+	result, err := db.Exec(`
+        UPDATE users SET verification_sent_at = ?
+        WHERE id = ? AND email_verified_at IS NULL
+        AND (verification_sent_at IS NULL OR verification_sent_at <= ?)
+    `, now, userID, now.Add(-emailVerifyCooldown))
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return true, nil
+	}
+
+	var verified bool
+	if err := db.QueryRow("SELECT email_verified_at IS NOT NULL FROM users WHERE id = ?", userID).Scan(&verified); err != nil {
+		return false, err
+	}
+	if verified {
+		return false, nil
+	}
+	return false, errVerifyCooldown
+}
+
+// sendVerificationEmail mails a verification link to user, subject to the cooldown.
+func sendVerificationEmail(user *User) error {
+	send, err := claimVerificationSend(user.ID)
+	if err != nil || !send {
+		return err
+	}
+	msg, err := emailVerificationMail(user)
+	if err != nil {
+		return err
+	}
+	sendMailAsync(msg)
+	return nil
+}
+
+// markEmailVerified verifies the email of the claim if it is still the
+// user's current address.
+func markEmailVerified(claim emailVerifyClaim) error {
+	result, err := db.Exec(
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, UTC_TIMESTAMP()) WHERE id = ? AND email = ?",
+		claim.UserID, claim.Email,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Either unchanged because already verified, or no longer matching.
+		var verified bool
+		err := db.QueryRow(
+			"SELECT email_verified_at IS NOT NULL FROM users WHERE id = ? AND email = ?",
+			claim.UserID, claim.Email,
+		).Scan(&verified)
+		if err == sql.ErrNoRows || (err == nil && !verified) {
+			return errSignatureInvalid
+		}
+		return err
+	}
+	return nil
+}
+
+// ======== Middleware ========
+
+// requireVerifiedEmail guards features that reach other users, such as
+// friends and study rooms: logged-in users must have verified their email.
+// Anonymous requests pass through so handlers still answer 401.
+func requireVerifiedEmail(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user := currentUser(r); user != nil && !user.EmailVerified {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "please verify your email address first"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ======== HTTP Handlers ========
+
+// handleVerifyEmail serves GET /api/auth/verify?token=..., the link sent by
+// email. On success the browser is sent to the dashboard.
+func handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	var claim emailVerifyClaim
+	if err := verifyPayload(emailVerifyPurpose, r.URL.Query().Get("token"), &claim); err != nil {
+		http.Error(w, "This verification link is invalid or has expired. Log in and request a new one.", http.StatusBadRequest)
+		return
+	}
+	if err := markEmailVerified(claim); err != nil {
+		if errors.Is(err, errSignatureInvalid) {
+			http.Error(w, "This verification link is no longer valid for your account.", http.StatusBadRequest)
+			return
+		}
+		log.Printf("failed to verify email of user %d: %v", claim.UserID, err)
+		http.Error(w, "failed to verify email", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/dashboard?email_verified=1", http.StatusSeeOther)
+}
+
+// handleResendVerification serves POST /api/auth/verify/resend, which mails a
+// new verification link to the logged-in user.
+func handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, AuthResponse{Success: false, Message: "use POST"})
+		return
+	}
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, AuthResponse{Success: false, Message: "login required"})
+		return
+	}
+	if user.EmailVerified {
+		writeJSON(w, http.StatusOK, AuthResponse{Success: true, Message: "email already verified"})
+		return
+	}
+	if err := sendVerificationEmail(user); err != nil {
+		if errors.Is(err, errVerifyCooldown) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(emailVerifyCooldown.Seconds())))
+			writeJSON(w, http.StatusTooManyRequests, AuthResponse{Success: false, Message: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to send verification email"})
+		return
+	}
+	writeJSON(w, http.StatusOK, AuthResponse{Success: true, Message: "verification email sent"})
+}
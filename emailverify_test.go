@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestRequireVerifiedEmail verifies that only logged-in users with an
+// unverified email are stopped.
+func TestRequireVerifiedEmail(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		auth     *requestAuth
+		expected int
+	}{
+		{"Anonymous", nil, http.StatusOK},
+		{"Verified", &requestAuth{user: &User{ID: 1, EmailVerified: true}}, http.StatusOK},
+		{"Unverified", &requestAuth{user: &User{ID: 2}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/api/friends", nil)
+			if tt.auth != nil {
+				req = req.WithContext(context.WithValue(req.Context(), authKey, tt.auth))
+			}
+			rr := httptest.NewRecorder()
+			requireVerifiedEmail(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})(rr, req)
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, observed: %d", tt.expected, rr.Code)
+			}
+		})
+	}
+}
+
+// TestHandleVerifyEmailRejectsBadTokens verifies that forged, expired and
+// differently purposed tokens never verify an address.
+func TestHandleVerifyEmailRejectsBadTokens(t *testing.T) {
+	t.Parallel()
+	claim := emailVerifyClaim{UserID: 1, Email: "ada@example.com"}
+	expired, _ := signPayload(emailVerifyPurpose, claim, -time.Minute)
+	otherPurpose, _ := signPayload(oauthFlowPurpose, claim, time.Hour)
+
+	tests := map[string]string{
+		"Missing token":       "",
+		"Forged token":        "e30.forged",
+		"Expired token":       expired,
+		"Token for other use": otherPurpose,
+	}
+	for name, token := range tests {
+		token := token
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			handleVerifyEmail(rr, httptest.NewRequest(http.MethodGet, "/api/auth/verify?token="+url.QueryEscape(token), nil))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, observed: %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ======== Account Erasure ========
+
+// erasureStep removes or anonymizes a user's rows in one table. Every ?
+// placeholder in where is bound to the user's ID.
+type erasureStep struct {
+	table string
+	where string
+	set   string // columns to overwrite instead of deleting the rows
+}
+
+// erasureSteps list every table holding data of a user, children first.
+// Foreign keys would cascade most of these on their own; spelling them out
+// keeps erasure complete even if a constraint is missing or changed, and
+// TestErasureCoversSchema fails when a new table is not listed here.
+var erasureSteps = []erasureStep{
+	{table: "journal_entry_tags", where: "entry_id IN (SELECT id FROM journal_entries WHERE user_id = ?)"},
+	{table: "journal_entries", where: "user_id = ?"},
+	{table: "study_room_messages", where: "user_id = ? OR room_id IN (SELECT id FROM study_rooms WHERE owner_id = ?)"},
+	{table: "study_room_members", where: "user_id = ? OR room_id IN (SELECT id FROM study_rooms WHERE owner_id = ?)"},
+	{table: "study_rooms", where: "owner_id = ?"},
+	{table: "friendships", where: "requester_id = ? OR addressee_id = ?"},
+	{table: "user_blocks", where: "blocker_id = ? OR blocked_id = ?"},
+	{table: "friend_request_mails", where: "requester_id = ? OR addressee_id = ?"},
+	{table: "activity_events", where: "user_id = ?"},
+	{table: "user_trophies", where: "user_id = ?"},
+	{table: "xp_ledger", where: "user_id = ?"},
+	{table: "sessions", where: "user_id = ?"},
+	{table: "api_tokens", where: "user_id = ?"},
+	{table: "user_identities", where: "user_id = ?"},
+	{table: "password_resets", where: "user_id = ?"},
+	{table: "user_totp", where: "user_id = ?"},
+	{table: "user_recovery_codes", where: "user_id = ?"},
+	{table: "user_preferences", where: "user_id = ?"},
+	{table: "review_flags", where: "user_id = ? OR review_id IN (SELECT id FROM resource_reviews WHERE user_id = ?)"},
+	{table: "resource_reviews", where: "user_id = ?"},
+	{table: "bookmark_collection_items", where: "collection_id IN (SELECT id FROM bookmark_collections WHERE user_id = ?)"},
+	{table: "bookmark_collections", where: "user_id = ?"},
+	{table: "resource_bookmarks", where: "user_id = ?"},
+	// Click analytics keep their counts but can no longer be tied to the user.
+	{table: "resource_clicks", where: "user_id = ?", set: "user_id = NULL, visitor = ''"},
+	// The audit trail keeps its counts but loses everything that identifies
+	// the user, including failed logins recorded only by email.
+	{table: "auth_events", where: "user_id = ? OR email = (SELECT email FROM users WHERE id = ?)",
+		set: "user_id = NULL, email = '', ip = '', detail = ''"},
+	{table: "users", where: "id = ?"},
+}
+
+// statement returns the SQL of s and its arguments for userID.
+func (s erasureStep) statement(userID int) (string, []any) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", s.table, s.where)
+	if s.set != "" {
+		query = fmt.Sprintf("UPDATE %s SET %s WHERE %s", s.table, s.set, s.where)
+	}
+	args := make([]any, strings.Count(s.where, "?"))
+	for i := range args {
+		args[i] = userID
+	}
+	return query, args
+}
+
+// eraseUser permanently removes userID and all of their data in one
+// transaction, then disconnects them and their owned rooms from live sync.
+// Ratings of the resources they reviewed are recomputed without them.
+// Erasing a user that no longer exists succeeds.
+func eraseUser(userID int) error {
+	owned, err := queryIDs("SELECT id FROM study_rooms WHERE owner_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	joined, err := queryIDs("SELECT room_id FROM study_room_members WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	reviewed, err := queryIDs("SELECT resource_id FROM resource_reviews WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, step := range erasureSteps {
+		query, args := step.statement(userID)
+		if _, err := tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("%s: %w", step.table, err)
+		}
+	}
+	for _, id := range reviewed {
+		if err := refreshResourceRating(tx, id); err != nil {
+			return fmt.Errorf("resources: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, id := range owned {
+		closeRoom(id)
+	}
+	for _, id := range joined {
+		kickFromRoom(id, userID)
+	}
+	return nil
+}
+
+// ======== Erasure Requests ========
+
+// requestErasure queues the erasure of userID and logs them out everywhere.
+// It returns the request ID for processErasure.
+func requestErasure(userID int) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("INSERT INTO erasure_requests (user_id, requested_at) VALUES (?, UTC_TIMESTAMP())", userID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// processErasure erases the user of a pending request and marks it done. On
+// failure the error is kept on the request and the job retries it later.
+func processErasure(requestID int64, userID int) error {
+	if err := eraseUser(userID); err != nil {
+		if _, dbErr := db.Exec(
+			"UPDATE erasure_requests SET attempts = attempts + 1, last_error = ? WHERE id = ?",
+			truncate(err.Error(), 255), requestID,
+		); dbErr != nil {
+			log.Printf("failed to record erasure error for request %d: %v", requestID, dbErr)
+		}
+		return err
+	}
+	_, err := db.Exec(
+		"UPDATE erasure_requests SET completed_at = UTC_TIMESTAMP(), attempts = attempts + 1, last_error = NULL WHERE id = ?",
+		requestID,
+	)
+	return err
+}
+
+// processPendingErasures works through every unfinished erasure request,
+// including ones queued by staff directly in the database.
+func processPendingErasures() error {
+	rows, err := db.Query("SELECT id, user_id FROM erasure_requests WHERE completed_at IS NULL ORDER BY id")
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id     int64
+		userID int
+	}
+	var queue []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.userID); err != nil {
+			rows.Close()
+			return err
+		}
+		queue = append(queue, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range queue {
+		if err := processErasure(p.id, p.userID); err != nil {
+			log.Printf("failed to erase user %d (request %d): %v", p.userID, p.id, err)
+		}
+	}
+	return nil
+}
+
+// startErasureJob processes pending erasure requests every interval until
+// the process exits.
+func startErasureJob(interval time.Duration) {
+	go func() {
+		for {
+			if err := processPendingErasures(); err != nil {
+				log.Printf("failed to process erasure requests: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// truncate shortens s to at most n bytes.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
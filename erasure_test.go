@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestErasureCoversSchema verifies that every table keyed to users in
+// schema.sql is erased, so new tables cannot silently keep personal data.
+func TestErasureCoversSchema(t *testing.T) {
+	t.Parallel()
+	schema, err := os.ReadFile("schema.sql")
+	if err != nil {
+		t.Fatalf("reading schema.sql: %v", err)
+	}
+	erased := map[string]bool{}
+	for _, step := range erasureSteps {
+		erased[step.table] = true
+	}
+
+	tableRE := regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS (\w+) \((.*?)\) ENGINE`)
+	for _, m := range tableRE.FindAllStringSubmatch(string(schema), -1) {
+		table, body := m[1], m[2]
+		if strings.Contains(body, "REFERENCES users(id)") && !erased[table] {
+			t.Errorf("table %s references users but has no erasure step", table)
+		}
+	}
+}
+
+// TestErasureStepsDeleteUserLast verifies child rows go before the user row,
+// which the auth_events step still reads the email from.
+func TestErasureStepsDeleteUserLast(t *testing.T) {
+	t.Parallel()
+	last := erasureSteps[len(erasureSteps)-1]
+	if last.table != "users" || last.set != "" {
+		t.Errorf("last erasure step observed = %+v, expected: delete from users", last)
+	}
+}
+
+// TestErasureStepStatement verifies placeholders are bound to the user ID and
+// anonymizing steps update instead of deleting.
+func TestErasureStepStatement(t *testing.T) {
+	t.Parallel()
+	query, args := erasureStep{table: "friendships", where: "requester_id = ? OR addressee_id = ?"}.statement(7)
+	if query != "DELETE FROM friendships WHERE requester_id = ? OR addressee_id = ?" {
+		t.Errorf("query observed = %q", query)
+	}
+	if len(args) != 2 || args[0] != 7 || args[1] != 7 {
+		t.Errorf("args observed = %v, expected: [7 7]", args)
+	}
+
+	query, _ = erasureStep{table: "auth_events", where: "user_id = ?", set: "email = ''"}.statement(7)
+	if !strings.HasPrefix(query, "UPDATE auth_events SET email = ''") {
+		t.Errorf("query observed = %q, expected an UPDATE", query)
+	}
+}
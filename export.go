@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ======== Personal Data Export ========
+
+// exportFile is one JSON file of a data export. query selects the user's
+// rows; every ? placeholder is bound to the user's ID. Secrets such as
+// password hashes, token hashes and TOTP secrets are never selected.
+type exportFile struct {
+	name   string
+	query  string
+	single bool // the file holds one object rather than a list
+}
+
+// exportFiles are the files of GET /api/me/export, one per kind of data.
+var exportFiles = []exportFile{
+	{name: "profile.json", single: true, query: `
+        SELECT id, first_name, last_name, email, avatar, role, password_hash IS NOT NULL AS has_password,
+               email_verified_at, created_at, updated_at
+        FROM users WHERE id = ?`},
+	{name: "preferences.json", single: true, query: `
+        SELECT email_notifications, updates, newsletter, streak_reminders, mute,
+               stay_signed_in, smooth_animations, focus_mode, updated_at
+        FROM user_preferences WHERE user_id = ?`},
+	{name: "login_providers.json", query: `
+        SELECT provider, subject, email, created_at, last_login_at
+        FROM user_identities WHERE user_id = ? ORDER BY provider`},
+	{name: "two_factor.json", query: `
+        SELECT enabled_at, created_at FROM user_totp WHERE user_id = ?`},
+	{name: "sessions.json", query: `
+        SELECT created_at, expires_at, user_agent, ip
+        FROM sessions WHERE user_id = ? ORDER BY created_at`},
+	{name: "api_tokens.json", query: `
+        SELECT name, prefix, scopes, created_at, last_used_at, expires_at, revoked_at
+        FROM api_tokens WHERE user_id = ? ORDER BY created_at`},
+	{name: "password_resets.json", query: `
+        SELECT created_at, expires_at, used_at
+        FROM password_resets WHERE user_id = ? ORDER BY created_at`},
+	{name: "security_log.json", query: `
+        SELECT kind, ip, detail, created_at
+        FROM auth_events WHERE user_id = ? ORDER BY created_at`},
+	{name: "computation_history.json", query: `
+        SELECT kind, created_at FROM activity_events WHERE user_id = ? ORDER BY created_at`},
+	{name: "quiz_attempts.json", query: `
+        SELECT ref AS quiz, amount AS xp, created_at
+        FROM xp_ledger WHERE user_id = ? AND reason = '` + XPReasonQuiz + `' ORDER BY created_at`},
+	{name: "solved_problems.json", query: `
+        SELECT ref AS problem, amount AS xp, created_at
+        FROM xp_ledger WHERE user_id = ? AND reason = '` + XPReasonProblem + `' ORDER BY created_at`},
+	{name: "xp_ledger.json", query: `
+        SELECT amount, reason, ref, created_at FROM xp_ledger WHERE user_id = ? ORDER BY created_at`},
+	{name: "trophies.json", query: `
+        SELECT t.slug, t.name, ut.awarded_at
+        FROM user_trophies ut JOIN trophies t ON t.id = ut.trophy_id
+        WHERE ut.user_id = ? ORDER BY ut.awarded_at`},
+	{name: "journal.json", query: `
+        SELECT e.id, e.title, e.body, GROUP_CONCAT(t.tag ORDER BY t.tag) AS tags, e.created_at, e.updated_at
+        FROM journal_entries e LEFT JOIN journal_entry_tags t ON t.entry_id = e.id
+        WHERE e.user_id = ? GROUP BY e.id ORDER BY e.created_at`},
+	{name: "friends.json", query: `
+        SELECT IF(f.requester_id = ?, 'sent', 'received') AS direction, f.status,
+               u.first_name, u.last_name, f.created_at, f.updated_at
+        FROM friendships f
+        JOIN users u ON u.id = IF(f.requester_id = ?, f.addressee_id, f.requester_id)
+        WHERE f.requester_id = ? OR f.addressee_id = ?
+        ORDER BY f.created_at`},
+	{name: "blocked_users.json", query: `
+        SELECT u.first_name, u.last_name, b.created_at
+        FROM user_blocks b JOIN users u ON u.id = b.blocked_id
+        WHERE b.blocker_id = ? ORDER BY b.created_at`},
+	{name: "study_rooms.json", query: `
+        SELECT r.id, r.name, r.owner_id = ? AS is_owner, r.workspace, r.created_at, m.joined_at
+        FROM study_rooms r LEFT JOIN study_room_members m ON m.room_id = r.id AND m.user_id = ?
+        WHERE r.owner_id = ? OR m.user_id IS NOT NULL
+        ORDER BY r.created_at`},
+	{name: "resource_clicks.json", query: `
+        SELECT c.resource_id, r.title, c.created_at
+        FROM resource_clicks c JOIN resources r ON r.id = c.resource_id
+        WHERE c.user_id = ? ORDER BY c.created_at`},
+	{name: "reviews.json", query: `
+        SELECT v.resource_id, r.title, v.rating, v.body, v.status, v.created_at, v.updated_at
+        FROM resource_reviews v JOIN resources r ON r.id = v.resource_id
+        WHERE v.user_id = ? ORDER BY v.created_at`},
+	{name: "review_flags.json", query: `
+        SELECT f.review_id, f.reason, f.created_at
+        FROM review_flags f WHERE f.user_id = ? ORDER BY f.created_at`},
+	{name: "bookmarks.json", query: `
+        SELECT b.resource_id, r.title, r.url, b.created_at
+        FROM resource_bookmarks b JOIN resources r ON r.id = b.resource_id
+        WHERE b.user_id = ? ORDER BY b.created_at`},
+	{name: "collections.json", query: `
+        SELECT c.id, c.name, c.description, c.share_token IS NOT NULL AS shared,
+               GROUP_CONCAT(i.resource_id ORDER BY i.added_at) AS resource_ids, c.created_at, c.updated_at
+        FROM bookmark_collections c LEFT JOIN bookmark_collection_items i ON i.collection_id = c.id
+        WHERE c.user_id = ? GROUP BY c.id ORDER BY c.created_at`},
+	{name: "chat_messages.json", query: `
+        SELECT m.room_id, r.name AS room, m.body, m.created_at
+        FROM study_room_messages m JOIN study_rooms r ON r.id = m.room_id
+        WHERE m.user_id = ? ORDER BY m.created_at`},
+}
+
+// exportReadme explains the archive to whoever opens it.
+const exportReadme = `G6Labs personal data export
+
+Each .json file holds one kind of data tied to your account. Times are UTC.
+Passwords, login tokens, recovery codes and two-factor secrets are not
+included.
+
+Other users appear by name only.
+`
+
+// queryExportRows runs query with userID bound to every placeholder and
+// returns the rows as JSON-ready maps keyed by column name.
+func queryExportRows(query string, userID int) ([]map[string]any, error) {
+	args := make([]any, strings.Count(query, "?"))
+	for i := range args {
+		args[i] = userID
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]any{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]any, len(columns))
+		for i, col := range columns {
+			row[col] = exportValue(values[i])
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// exportValue converts a scanned column into a JSON-friendly value. The
+// driver returns text columns as bytes.
+func exportValue(v any) any {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC()
+	default:
+		return v
+	}
+}
+
+// buildExport collects every export file of userID as JSON.
+func buildExport(userID int) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(exportFiles))
+	for _, f := range exportFiles {
+		rows, err := queryExportRows(f.query, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		var v any = rows
+		if f.single {
+			v = nil
+			if len(rows) > 0 {
+				v = rows[0]
+			}
+		}
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		files[f.name] = data
+	}
+	return files, nil
+}
+
+// ======== HTTP Handlers ========
+
+// handleExport serves GET /api/me/export, a ZIP archive of all data tied to
+// the logged-in user. Everything is read before the response starts, so a
+// failure still yields a proper error status.
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	files, err := buildExport(userID)
+	if err != nil {
+		log.Printf("failed to export data of user %d: %v", userID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to export data"})
+		return
+	}
+
+	now := time.Now().UTC()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="g6labs-export-%s.zip"`, now.Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	if err := writeExportZip(w, files, now); err != nil {
+		log.Printf("failed to write data export of user %d: %v", userID, err)
+	}
+}
+
+// writeExportZip writes files and a README as a ZIP archive, in exportFiles order.
+func writeExportZip(w io.Writer, files map[string][]byte, modified time.Time) error {
+	zw := zip.NewWriter(w)
+	write := func(name string, data []byte) error {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	}
+	if err := write("README.txt", []byte(exportReadme)); err != nil {
+		return err
+	}
+	for _, f := range exportFiles {
+		if err := write(f.name, files[f.name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
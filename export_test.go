@@ -0,0 +1,81 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHandleExportRequiresLogin verifies anonymous requests get 401.
+func TestHandleExportRequiresLogin(t *testing.T) {
+	t.Parallel()
+	rr := httptest.NewRecorder()
+	handleExport(rr, httptest.NewRequest(http.MethodGet, "/api/me/export", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, observed: %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+// TestExportQueriesSkipSecrets verifies no export selects a stored secret.
+func TestExportQueriesSkipSecrets(t *testing.T) {
+	t.Parallel()
+	for _, f := range exportFiles {
+		for _, secret := range []string{"token_hash", "code_hash", "secret", "SELECT *"} {
+			if strings.Contains(f.query, secret) {
+				t.Errorf("%s selects %q", f.name, secret)
+			}
+		}
+		// password_hash may only be reduced to a flag.
+		if strings.Contains(f.query, "password_hash") && !strings.Contains(f.query, "password_hash IS NOT NULL") {
+			t.Errorf("%s selects password_hash", f.name)
+		}
+	}
+}
+
+// TestWriteExportZip verifies the archive holds the README and every file.
+func TestWriteExportZip(t *testing.T) {
+	t.Parallel()
+	files := map[string][]byte{}
+	for _, f := range exportFiles {
+		files[f.name] = []byte("[]")
+	}
+	var buf bytes.Buffer
+	if err := writeExportZip(&buf, files, time.Now()); err != nil {
+		t.Fatalf("writeExportZip() observed error = %v, expected: nil", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() observed error = %v", err)
+	}
+	if len(zr.File) != len(exportFiles)+1 {
+		t.Fatalf("archive observed %d files, expected: %d", len(zr.File), len(exportFiles)+1)
+	}
+	if zr.File[0].Name != "README.txt" {
+		t.Errorf("first file observed = %q, expected: README.txt", zr.File[0].Name)
+	}
+	for i, f := range exportFiles {
+		if zr.File[i+1].Name != f.name {
+			t.Errorf("file %d observed = %q, expected: %q", i+1, zr.File[i+1].Name, f.name)
+		}
+	}
+}
+
+// TestExportValue verifies driver values become readable JSON values.
+func TestExportValue(t *testing.T) {
+	t.Parallel()
+	if observed := exportValue([]byte("Ada")); observed != "Ada" {
+		t.Errorf("exportValue([]byte) observed = %v, expected: Ada", observed)
+	}
+	local := time.Date(2025, 1, 2, 3, 4, 5, 0, time.FixedZone("X", 3600))
+	if observed := exportValue(local).(time.Time); observed.Location() != time.UTC || !observed.Equal(local) {
+		t.Errorf("exportValue(time) observed = %v, expected the same instant in UTC", observed)
+	}
+	if observed := exportValue(nil); observed != nil {
+		t.Errorf("exportValue(nil) observed = %v, expected: nil", observed)
+	}
+}
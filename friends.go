@@ -0,0 +1,578 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== Types ========
+
+// Friendship statuses stored in friendships.status.
+const (
+	FriendPending  = "pending"
+	FriendAccepted = "accepted"
+	FriendDeclined = "declined"
+)
+
+// Friend is another user as seen from the current user's friend list. Email
+// is only shown for accepted friends, so requests and blocks cannot be used to
+// look up addresses.
+type Friend struct {
+	ID     int       `json:"id"`
+	FName  string    `json:"fName"`
+	LName  string    `json:"lName"`
+	Email  string    `json:"email,omitempty"`
+	Avatar string    `json:"avatar"`
+	Status string    `json:"status"`
+	Since  time.Time `json:"since"`
+}
+
+// FriendsResponse is the JSON payload returned by GET /api/friends.
+type FriendsResponse struct {
+	Friends  []Friend `json:"friends"`
+	Incoming []Friend `json:"incoming"` // pending requests sent to the user
+	Outgoing []Friend `json:"outgoing"` // pending requests sent by the user
+	Blocked  []Friend `json:"blocked"`
+}
+
+// FriendRequest is the JSON payload for sending a request or blocking a user.
+// New users are named by exact email; user_id only names users already in
+// the caller's friend list, so IDs cannot be enumerated.
+type FriendRequest struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+const (
+	// friendDeclineCooldown is how long a declined request cannot be sent
+	// again by its requester.
+	friendDeclineCooldown = 30 * 24 * time.Hour
+	// friendMailCooldown is how long after mailing a pair about a request
+	// another request between them is sent without an email.
+	friendMailCooldown = 7 * 24 * time.Hour
+)
+
+var (
+	errFriendSelf     = errors.New("you cannot befriend yourself")
+	errFriendBlocked  = errors.New("friend request not allowed")
+	errFriendExists   = errors.New("friend request already exists")
+	errFriendDeclined = errors.New("your friend request was declined recently; try again later")
+	errFriendNotFound = errors.New("friend request not found")
+	errUserNotFound   = errors.New("user not found")
+	errFriendNoTarget = errors.New("user_id or email is required")
+)
+
+// friendRequestMail tells to that from sent them a friend request.
+func friendRequestMail(to, from *User) Mail {
+	return Mail{
+		To:      to.Email,
+		Subject: from.FName + " " + from.LName + " sent you a friend request on G6Labs",
+		Body: "Hi " + to.FName + ",\n\n" +
+			from.FName + " " + from.LName + " would like to be friends on G6Labs. Accept or decline the request here:\n\n" +
+			appBaseURL() + "/dashboard\n\n" +
+			"You can turn off email notifications in the dashboard settings.\n",
+	}
+}
+
+// ======== DB Functions ========
+
+// resolveFriendTarget returns the user ID referenced by userID's
+// FriendRequest. An ID must belong to a friend, a pending request in either
+// direction or a blocked user; anyone else has to be named by email.
+func resolveFriendTarget(userID int, req FriendRequest) (int, error) {
+	if req.UserID > 0 {
+		var id int
+		err := db.QueryRow(`
+            SELECT u.id FROM users u
+            WHERE u.id = ?
+            AND (EXISTS (SELECT 1 FROM friendships f
+                         WHERE (f.requester_id = ? AND f.addressee_id = u.id) OR (f.requester_id = u.id AND f.addressee_id = ?))
+                 OR EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = ? AND b.blocked_id = u.id))`,
+			req.UserID, userID, userID, userID,
+		).Scan(&id)
+		if err == sql.ErrNoRows {
+			return 0, errUserNotFound
+		}
+		return id, err
+	}
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		return 0, errFriendNoTarget
+	}
+	user, err := getUserByEmail(email)
+	if err == sql.ErrNoRows {
+		return 0, errUserNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// isBlockedEither reports whether a or b has blocked the other.
+func isBlockedEither(a, b int) (bool, error) {
+	var n int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM user_blocks
+         WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)`,
+		a, b, b, a,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// areFriends reports whether a and b have an accepted friendship.
+func areFriends(a, b int) (bool, error) {
+	var n int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM friendships
+         WHERE status = 'accepted'
+         AND ((requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?))`,
+		a, b, b, a,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// sendFriendRequest creates a pending request from userID to targetID.
+//
+// If targetID already asked userID, the existing request is accepted instead.
+// A declined request may be sent again by its requester once
+// friendDeclineCooldown has passed, and by the user who declined it at once.
+func sendFriendRequest(userID, targetID int) (string, error) {
+	if userID == targetID {
+		return "", errFriendSelf
+	}
+	blocked, err := isBlockedEither(userID, targetID)
+	if err != nil {
+		return "", err
+	}
+	if blocked {
+		return "", errFriendBlocked
+	}
+
+	// A pending request in the other direction turns into a friendship.
+	result, err := db.Exec(
+		"UPDATE friendships SET status = 'accepted' WHERE requester_id = ? AND addressee_id = ? AND status = 'pending'",
+		targetID, userID,
+	)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return FriendAccepted, nil
+	}
+
+	var status string
+	var declinedRecently bool
+	err = db.QueryRow(
+		`SELECT status, requester_id = ? AND updated_at > UTC_TIMESTAMP() - INTERVAL ? SECOND FROM friendships
+         WHERE (requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?)`,
+		userID, int(friendDeclineCooldown.Seconds()), userID, targetID, targetID, userID,
+	).Scan(&status, &declinedRecently)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = db.Exec(
+			"INSERT INTO friendships (requester_id, addressee_id, status) VALUES (?, ?, 'pending')",
+			userID, targetID,
+		)
+		return FriendPending, err
+	case err != nil:
+		return "", err
+	case status == FriendDeclined && declinedRecently:
+		return "", errFriendDeclined
+	case status == FriendDeclined:
+		// Re-requesting after a decline replaces the old row with a fresh one.
+		if _, err := db.Exec(
+			`DELETE FROM friendships
+             WHERE (requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?)`,
+			userID, targetID, targetID, userID,
+		); err != nil {
+			return "", err
+		}
+		_, err = db.Exec(
+			"INSERT INTO friendships (requester_id, addressee_id, status) VALUES (?, ?, 'pending')",
+			userID, targetID,
+		)
+		return FriendPending, err
+	default:
+		return "", errFriendExists
+	}
+}
+
+// claimFriendRequestMail reports whether userID's new request to targetID
+// should be mailed, recording the send. A pair is mailed at most once per
+// friendMailCooldown, however often the request is cancelled and sent again.
+func claimFriendRequestMail(userID, targetID int) (bool, error) {
+	result, err := db.Exec(`
+        INSERT INTO friend_request_mails (requester_id, addressee_id, sent_at) VALUES (?, ?, UTC_TIMESTAMP())
+        ON DUPLICATE KEY UPDATE sent_at = IF(sent_at < UTC_TIMESTAMP() - INTERVAL ? SECOND, VALUES(sent_at), sent_at)
+    `, userID, targetID, int(friendMailCooldown.Seconds()))
+	if err != nil {
+		return false, err
+	}
+	// 1 for a new row, 2 for an updated one, 0 when still cooling down.
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// respondFriendRequest accepts or declines the pending request requesterID sent to userID.
+func respondFriendRequest(userID, requesterID int, accept bool) error {
+	status := FriendDeclined
+	if accept {
+		status = FriendAccepted
+	}
+	result, err := db.Exec(
+		"UPDATE friendships SET status = ? WHERE requester_id = ? AND addressee_id = ? AND status = 'pending'",
+		status, requesterID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errFriendNotFound
+	}
+	return nil
+}
+
+// removeFriendship deletes the friendship or pending request between userID
+// and otherID, and removes each from the other's study rooms. Declined
+// requests stay, so deleting one cannot skip friendDeclineCooldown.
+func removeFriendship(userID, otherID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`DELETE FROM friendships
+         WHERE ((requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?))
+         AND status IN ('pending', 'accepted')`,
+		userID, otherID, otherID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errFriendNotFound
+	}
+	removed, err := removeFromEachOthersRooms(tx, userID, otherID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, m := range removed {
+		kickFromRoom(m.roomID, m.userID)
+	}
+	return nil
+}
+
+// blockUser blocks targetID for userID, drops any friendship or pending
+// request between them and removes each from the other's study rooms. A
+// declined request is kept for friendDeclineCooldown.
+func blockUser(userID, targetID int) error {
+	if userID == targetID {
+		return errFriendSelf
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`DELETE FROM friendships
+         WHERE ((requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?))
+         AND status IN ('pending', 'accepted')`,
+		userID, targetID, targetID, userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"INSERT IGNORE INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?)",
+		userID, targetID,
+	); err != nil {
+		return err
+	}
+	removed, err := removeFromEachOthersRooms(tx, userID, targetID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, m := range removed {
+		kickFromRoom(m.roomID, m.userID)
+	}
+	return nil
+}
+
+// unblockUser removes a block userID placed on targetID.
+func unblockUser(userID, targetID int) error {
+	result, err := db.Exec("DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?", userID, targetID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errFriendNotFound
+	}
+	return nil
+}
+
+// getFriends returns userID's friends, pending requests in both directions,
+// and blocked users.
+func getFriends(userID int) (*FriendsResponse, error) {
+	resp := &FriendsResponse{Friends: []Friend{}, Incoming: []Friend{}, Outgoing: []Friend{}, Blocked: []Friend{}}
+
+	rows, err := db.Query(`
+        SELECT u.id, u.first_name, u.last_name, IF(f.status = 'accepted', u.email, ''), COALESCE(u.avatar, ''),
+        f.status, f.updated_at, f.requester_id = ?
+        FROM friendships f
+        JOIN users u ON u.id = IF(f.requester_id = ?, f.addressee_id, f.requester_id)
+        WHERE (f.requester_id = ? OR f.addressee_id = ?) AND f.status IN ('pending', 'accepted')
+        ORDER BY u.first_name, u.last_name
+    `, userID, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f Friend
+		var sentByMe bool
+		if err := rows.Scan(&f.ID, &f.FName, &f.LName, &f.Email, &f.Avatar, &f.Status, &f.Since, &sentByMe); err != nil {
+			return nil, err
+		}
+		switch {
+		case f.Status == FriendAccepted:
+			resp.Friends = append(resp.Friends, f)
+		case sentByMe:
+			resp.Outgoing = append(resp.Outgoing, f)
+		default:
+			resp.Incoming = append(resp.Incoming, f)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	blockRows, err := db.Query(`
+        SELECT u.id, u.first_name, u.last_name, COALESCE(u.avatar, ''), b.created_at
+        FROM user_blocks b
+        JOIN users u ON u.id = b.blocked_id
+        WHERE b.blocker_id = ?
+        ORDER BY b.created_at DESC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer blockRows.Close()
+	for blockRows.Next() {
+		f := Friend{Status: "blocked"}
+		if err := blockRows.Scan(&f.ID, &f.FName, &f.LName, &f.Avatar, &f.Since); err != nil {
+			return nil, err
+		}
+		resp.Blocked = append(resp.Blocked, f)
+	}
+	return resp, blockRows.Err()
+}
+
+// ======== HTTP Handlers ========
+
+// handleFriends serves GET /api/friends.
+func handleFriends(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	friends, err := getFriends(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, friends)
+}
+
+// handleFriendRequests serves POST /api/friends/requests, which sends a friend
+// request to the user named in the body.
+func handleFriendRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	userID, targetID, ok := parseFriendTarget(w, r)
+	if !ok {
+		return
+	}
+	status, err := sendFriendRequest(userID, targetID)
+	if err != nil {
+		writeFriendError(w, err)
+		return
+	}
+	mail := false
+	if status == FriendPending {
+		if mail, err = claimFriendRequestMail(userID, targetID); err != nil {
+			log.Printf("failed to claim friend request mail for user %d: %v", targetID, err)
+		}
+	}
+	if mail {
+		from := currentUser(r)
+		sendUserMail(targetID, MailTopicNotifications, func(recipient *User) Mail {
+			return friendRequestMail(recipient, from)
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": status})
+}
+
+// handleFriendRequestAction serves POST /api/friends/requests/{userId}/{action},
+// where action is "accept" or "decline".
+func handleFriendRequestAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	requesterID, err := strconv.Atoi(r.PathValue("userId"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		return
+	}
+
+	var accept bool
+	switch r.PathValue("action") {
+	case "accept":
+		accept = true
+	case "decline":
+		accept = false
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown action"})
+		return
+	}
+	if err := respondFriendRequest(userID, requesterID, accept); err != nil {
+		writeFriendError(w, err)
+		return
+	}
+	status := FriendDeclined
+	if accept {
+		status = FriendAccepted
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": status})
+}
+
+// handleFriend serves DELETE /api/friends/{userId}, which removes a friend or
+// cancels a pending request in either direction.
+func handleFriend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use DELETE"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	otherID, err := strconv.Atoi(r.PathValue("userId"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		return
+	}
+	if err := removeFriendship(userID, otherID); err != nil {
+		writeFriendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleFriendBlocks serves POST /api/friends/blocks, which blocks the user
+// named in the body.
+func handleFriendBlocks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	userID, targetID, ok := parseFriendTarget(w, r)
+	if !ok {
+		return
+	}
+	if err := blockUser(userID, targetID); err != nil {
+		writeFriendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "blocked"})
+}
+
+// handleFriendBlock serves DELETE /api/friends/blocks/{userId}.
+func handleFriendBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use DELETE"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	targetID, err := strconv.Atoi(r.PathValue("userId"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		return
+	}
+	if err := unblockUser(userID, targetID); err != nil {
+		writeFriendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseFriendTarget resolves the current user and the target user from a
+// FriendRequest body, writing an error response on failure.
+func parseFriendTarget(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return 0, 0, false
+	}
+	defer r.Body.Close()
+	var req FriendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return 0, 0, false
+	}
+	targetID, err := resolveFriendTarget(userID, req)
+	if err != nil {
+		writeFriendError(w, err)
+		return 0, 0, false
+	}
+	return userID, targetID, true
+}
+
+// writeFriendError maps friend repository errors to HTTP responses.
+func writeFriendError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errUserNotFound), errors.Is(err, errFriendNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errFriendExists), errors.Is(err, errFriendDeclined):
+		status = http.StatusConflict
+	case errors.Is(err, errFriendBlocked):
+		status = http.StatusForbidden
+	case errors.Is(err, errFriendSelf), errors.Is(err, errFriendNoTarget):
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
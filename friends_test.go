@@ -0,0 +1,137 @@
+package main
+
+import "testing"
+
+// TestFriendTargetsHideEmails verifies strangers can only be named by email
+// and that only accepted friends are listed with their address.
+func TestFriendTargetsHideEmails(t *testing.T) {
+	useTestDB(t)
+	ada := createTestUser(t, "Ada", "Lovelace")
+	grace := createTestUser(t, "Grace", "Hopper")
+	alan := createTestUser(t, "Alan", "Turing")
+	email := func(userID int) string {
+		t.Helper()
+		var email string
+		if err := db.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&email); err != nil {
+			t.Fatalf("reading test user email: %v", err)
+		}
+		return email
+	}
+	listed := func(step string) *FriendsResponse {
+		t.Helper()
+		friends, err := getFriends(ada)
+		if err != nil {
+			t.Fatalf("%s: getFriends observed error = %v", step, err)
+		}
+		return friends
+	}
+
+	if _, err := resolveFriendTarget(ada, FriendRequest{UserID: grace}); err != errUserNotFound {
+		t.Errorf("resolveFriendTarget(stranger's id) observed error = %v, expected: %v", err, errUserNotFound)
+	}
+	target, err := resolveFriendTarget(ada, FriendRequest{Email: email(grace)})
+	if err != nil || target != grace {
+		t.Fatalf("resolveFriendTarget(email) observed = %d, %v, expected: %d", target, err, grace)
+	}
+	if _, err := sendFriendRequest(ada, grace); err != nil {
+		t.Fatalf("sendFriendRequest observed error = %v", err)
+	}
+	if target, err := resolveFriendTarget(ada, FriendRequest{UserID: grace}); err != nil || target != grace {
+		t.Errorf("resolveFriendTarget(pending request's id) observed = %d, %v, expected: %d", target, err, grace)
+	}
+	if out := listed("pending").Outgoing; len(out) != 1 || out[0].Email != "" {
+		t.Errorf("pending: observed outgoing = %+v, expected one request without email", out)
+	}
+
+	if err := respondFriendRequest(grace, ada, true); err != nil {
+		t.Fatalf("respondFriendRequest observed error = %v", err)
+	}
+	if friends := listed("accepted").Friends; len(friends) != 1 || friends[0].Email != email(grace) {
+		t.Errorf("accepted: observed friends = %+v, expected grace with email", friends)
+	}
+
+	if err := blockUser(ada, alan); err != nil {
+		t.Fatalf("blockUser observed error = %v", err)
+	}
+	if blocked := listed("blocked").Blocked; len(blocked) != 1 || blocked[0].Email != "" {
+		t.Errorf("blocked: observed blocked = %+v, expected one user without email", blocked)
+	}
+}
+
+// TestFriendRequestCooldowns verifies re-sending a cancelled request does not
+// mail the addressee again and that a declined requester has to wait.
+func TestFriendRequestCooldowns(t *testing.T) {
+	useTestDB(t)
+	ada := createTestUser(t, "Ada", "Lovelace")
+	grace := createTestUser(t, "Grace", "Hopper")
+	claim := func(step string, expected bool) {
+		t.Helper()
+		mail, err := claimFriendRequestMail(ada, grace)
+		if err != nil {
+			t.Fatalf("%s: claimFriendRequestMail observed error = %v", step, err)
+		}
+		if mail != expected {
+			t.Errorf("%s: claimFriendRequestMail observed = %v, expected: %v", step, mail, expected)
+		}
+	}
+
+	claim("first request", true)
+	claim("re-sent request", false)
+	if _, err := db.Exec(
+		"UPDATE friend_request_mails SET sent_at = sent_at - INTERVAL ? SECOND WHERE requester_id = ?",
+		int(friendMailCooldown.Seconds())+60, ada,
+	); err != nil {
+		t.Fatalf("backdating mail: %v", err)
+	}
+	claim("request after the cooldown", true)
+
+	if _, err := sendFriendRequest(ada, grace); err != nil {
+		t.Fatalf("sendFriendRequest observed error = %v", err)
+	}
+	if err := respondFriendRequest(grace, ada, false); err != nil {
+		t.Fatalf("respondFriendRequest observed error = %v", err)
+	}
+	if err := removeFriendship(ada, grace); err != errFriendNotFound {
+		t.Errorf("removeFriendship(declined) observed error = %v, expected: %v", err, errFriendNotFound)
+	}
+	if _, err := sendFriendRequest(ada, grace); err != errFriendDeclined {
+		t.Errorf("sendFriendRequest(declined) observed error = %v, expected: %v", err, errFriendDeclined)
+	}
+	if status, err := sendFriendRequest(grace, ada); err != nil || status != FriendPending {
+		t.Errorf("sendFriendRequest(by the decliner) observed = %q, %v, expected: %q", status, err, FriendPending)
+	}
+}
+
+// TestUnfriendLeavesRooms verifies unfriending removes each user from the
+// other's rooms, as room members must be friends of the owner.
+func TestUnfriendLeavesRooms(t *testing.T) {
+	useTestDB(t)
+	ada := createTestUser(t, "Ada", "Lovelace")
+	grace := createTestUser(t, "Grace", "Hopper")
+	if _, err := sendFriendRequest(ada, grace); err != nil {
+		t.Fatalf("sendFriendRequest observed error = %v", err)
+	}
+	if err := respondFriendRequest(grace, ada, true); err != nil {
+		t.Fatalf("respondFriendRequest observed error = %v", err)
+	}
+	roomID, err := createRoom(ada, CreateRoomRequest{Name: "Exam prep", MemberIDs: []int{grace}})
+	if err != nil {
+		t.Fatalf("createRoom observed error = %v", err)
+	}
+
+	if err := removeFriendship(grace, ada); err != nil {
+		t.Fatalf("removeFriendship observed error = %v", err)
+	}
+	for _, tc := range []struct {
+		userID   int
+		expected bool
+	}{{ada, true}, {grace, false}} {
+		member, err := isRoomMember(roomID, tc.userID)
+		if err != nil {
+			t.Fatalf("isRoomMember observed error = %v", err)
+		}
+		if member != tc.expected {
+			t.Errorf("isRoomMember(%d) after unfriending observed = %v, expected: %v", tc.userID, member, tc.expected)
+		}
+	}
+}
@@ -10,6 +10,20 @@ window.addEventListener('DOMContentLoaded', () => {
         window.location.href = '/login';
     }
 
+    // The server session is the source of truth; drop stale local data if it expired
+    fetch('/api/me').then(async response => {
+        if (response.status === 401) {
+            localStorage.removeItem('user');
+            window.location.href = '/login';
+            return;
+        }
+        const data = await response.json();
+        if (data.user) {
+            localStorage.setItem('user', JSON.stringify(data.user));
+            checkEmailVerification(data.user);
+        }
+    }).catch(error => console.error('Error checking session:', error));
+
     // Setup event listeners after DOM is loaded
     const homeBtn = document.getElementById('G6Logo');
     const logoutBtn = document.getElementById('logoutBtn');
@@ -23,15 +37,27 @@ window.addEventListener('DOMContentLoaded', () => {
 
     //method to logout user and return to homepage
     if (logoutBtn) {
-        logoutBtn.addEventListener('click', () => {
+        logoutBtn.addEventListener('click', async () => {
             console.log('Logout button clicked');
-            // Clear user data from localStorage
+            // End the server session, then clear user data from localStorage
+            try {
+                await fetch('/api/auth/logout', { method: 'POST' });
+            } catch (error) {
+                console.error('Error logging out:', error);
+            }
             localStorage.removeItem('user');
             // Redirect to homepage
             window.location.href = '/';
         });
     }
 
+    // Load trophy and level progress for the logged-in session
+    if (user) {
+        loadTrophies();
+        loadProgress();
+        loadPreferences();
+    }
+
     // Handle avatar selection
     const avatarRadios = document.querySelectorAll('.avatarRadio');
     
@@ -47,17 +73,257 @@ window.addEventListener('DOMContentLoaded', () => {
     avatarRadios.forEach(radio => {
         radio.addEventListener('change', (e) => {
             if (e.target.checked) {
-                const currentUser = JSON.parse(localStorage.getItem('user'));
-                if (currentUser) {
-                    currentUser.avatar = e.target.value;
-                    localStorage.setItem('user', JSON.stringify(currentUser));
-                    console.log('Avatar updated:', e.target.value);
-                }
+                updateProfile({ avatar: e.target.value });
             }
         });
     });
+
+    // Names in the profile card save when the field loses focus
+    const nameInputs = { fName: document.getElementById('fNameInput'), lName: document.getElementById('lNameInput') };
+    Object.entries(nameInputs).forEach(([field, input]) => {
+        if (!input) return;
+        input.value = (user && user[field]) || '';
+        input.addEventListener('change', async () => {
+            const saved = await updateProfile({ [field]: input.value });
+            if (!saved) {
+                input.value = JSON.parse(localStorage.getItem('user'))[field] || '';
+            }
+        });
+    });
+
+    const currentEmail = document.getElementById('currentEmail');
+    if (currentEmail && user) {
+        currentEmail.value = user.email || '';
+        currentEmail.readOnly = true;
+    }
+
+    const saveChangesBtn = document.getElementById('saveChangesBtn');
+    if (saveChangesBtn) {
+        saveChangesBtn.addEventListener('click', saveAccountSettings);
+    }
+    // The browser downloads the ZIP archive from the attachment response
+    const exportDataBtn = document.getElementById('exportDataBtn');
+    if (exportDataBtn) {
+        exportDataBtn.addEventListener('click', () => {
+            window.location.href = '/api/me/export';
+        });
+    }
+    const deleteAccountBtn = document.getElementById('deleteAccountBtn');
+    if (deleteAccountBtn) {
+        deleteAccountBtn.addEventListener('click', deleteAccount);
+    }
 });
 
+// Save profile fields on the server and refresh the cached user; returns whether it worked
+async function updateProfile(fields) {
+    try {
+        const response = await fetch('/api/me', {
+            method: 'PATCH',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(fields)
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            alert(data.message || 'Failed to update profile.');
+            return false;
+        }
+        localStorage.setItem('user', JSON.stringify(data.user));
+        document.getElementById('welcomeMessage').textContent = `Welcome to G6Labs, ${data.user.fName}!`;
+        return true;
+    } catch (error) {
+        console.error('Error updating profile:', error);
+        return false;
+    }
+}
+
+// Apply the password and email fields of the settings card
+async function saveAccountSettings() {
+    const currentPassword = document.getElementById('currentPassword').value;
+    const newPassword = document.getElementById('newPassword').value;
+    const confirmPassword = document.getElementById('confirmPassword').value;
+    const newEmail = document.getElementById('newEmail').value.trim();
+
+    if (!newPassword && !newEmail) {
+        alert('Enter a new password or a new email address.');
+        return;
+    }
+    if (newPassword && newPassword !== confirmPassword) {
+        alert('New passwords do not match.');
+        return;
+    }
+
+    const messages = [];
+    try {
+        if (newPassword) {
+            const response = await fetch('/api/me/password', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ current_password: currentPassword, new_password: newPassword })
+            });
+            const data = await response.json();
+            messages.push(data.message);
+            if (response.ok) {
+                ['currentPassword', 'newPassword', 'confirmPassword'].forEach(id => document.getElementById(id).value = '');
+            }
+        }
+        if (newEmail) {
+            const response = await fetch('/api/me/email', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ email: newEmail, password: currentPassword })
+            });
+            const data = await response.json();
+            messages.push(data.message);
+            if (response.ok) {
+                document.getElementById('newEmail').value = '';
+            }
+        }
+    } catch (error) {
+        console.error('Error saving settings:', error);
+        messages.push('Failed to save changes.');
+    }
+    alert(messages.join('\n'));
+}
+
+// Permanently delete the account after confirming with the password (or email for provider accounts)
+async function deleteAccount() {
+    const user = JSON.parse(localStorage.getItem('user'));
+    const answer = prompt('This permanently deletes your account, progress, rooms and friends.\nEnter your password to confirm (or your email if you log in with a provider):');
+    if (answer === null) return;
+    try {
+        const response = await fetch('/api/me', {
+            method: 'DELETE',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(answer.trim().toLowerCase() === (user.email || '').toLowerCase()
+                ? { confirm: answer }
+                : { password: answer })
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            alert(data.message || 'Failed to delete account.');
+            return;
+        }
+        localStorage.removeItem('user');
+        window.location.href = '/';
+    } catch (error) {
+        console.error('Error deleting account:', error);
+    }
+}
+
+// Settings checkboxes and the preference each one stores
+const preferenceCheckboxes = {
+    emailCB: 'email_notifications',
+    updatesCB: 'updates',
+    newsletterCB: 'newsletter',
+    streakCB: 'streak_reminders',
+    muteCB: 'mute',
+    staySignedInCB: 'stay_signed_in',
+    smoothAnimationsCB: 'smooth_animations',
+    focusCB: 'focus_mode'
+};
+
+// Load saved preferences into the checkboxes and save every change
+async function loadPreferences() {
+    try {
+        const response = await fetch('/api/me/preferences');
+        if (!response.ok) return;
+        let prefs = await response.json();
+        applyPreferences(prefs);
+
+        Object.entries(preferenceCheckboxes).forEach(([id, name]) => {
+            const checkbox = document.getElementById(id);
+            if (!checkbox) return;
+            checkbox.checked = prefs[name];
+            checkbox.addEventListener('change', async () => {
+                const updated = { ...prefs, [name]: checkbox.checked };
+                const saved = await fetch('/api/me/preferences', {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(updated)
+                });
+                if (!saved.ok) {
+                    checkbox.checked = prefs[name];
+                    alert('Failed to save settings.');
+                    return;
+                }
+                prefs = await saved.json();
+                applyPreferences(prefs);
+            });
+        });
+    } catch (error) {
+        console.error('Error loading preferences:', error);
+    }
+}
+
+// Apply display preferences to the page and share them with other pages
+function applyPreferences(prefs) {
+    document.body.classList.toggle('reduceMotion', !prefs.smooth_animations);
+    document.body.classList.toggle('focusMode', prefs.focus_mode);
+    localStorage.setItem('preferences', JSON.stringify(prefs));
+}
+
+// Confirm a just-followed verification link, or offer to resend it once per visit
+async function checkEmailVerification(user) {
+    const params = new URLSearchParams(window.location.search);
+    if (params.get('email_verified') === '1') {
+        alert('Thanks, your email address is verified!');
+        history.replaceState(null, '', '/dashboard');
+        return;
+    }
+    if (params.get('email_changed') === '1') {
+        alert(`Your email address is now ${user.email}.`);
+        history.replaceState(null, '', '/dashboard');
+        return;
+    }
+    if (user.emailVerified || sessionStorage.getItem('verifyPrompted')) {
+        return;
+    }
+    sessionStorage.setItem('verifyPrompted', '1');
+    if (!confirm('Please verify your email address to use friends and study rooms. Send a new verification email?')) {
+        return;
+    }
+    try {
+        const response = await fetch('/api/auth/verify/resend', { method: 'POST' });
+        const data = await response.json();
+        alert(data.message || 'Failed to send verification email.');
+    } catch (error) {
+        console.error('Error resending verification email:', error);
+    }
+}
+
+// Fetch the user's trophies and show how many have been collected
+async function loadTrophies() {
+    try {
+        const response = await fetch('/api/me/trophies');
+        if (!response.ok) return;
+        const data = await response.json();
+        const value = document.querySelector('.trophiesCard .cardValue');
+        if (value) {
+            value.textContent = data.earned;
+            value.title = data.trophies.filter(t => t.earned).map(t => t.name).join(', ');
+        }
+    } catch (error) {
+        console.error('Error loading trophies:', error);
+    }
+}
+
+// Fetch the user's level, XP and streak for the progression card
+async function loadProgress() {
+    try {
+        const response = await fetch('/api/me/progress');
+        if (!response.ok) return;
+        const data = await response.json();
+        const inLevel = data.xp - data.level_xp;
+        const levelSpan = data.next_level_xp - data.level_xp;
+        document.querySelector('.levelText').textContent = `Level ${data.level}`;
+        document.querySelector('.xpText').textContent = `${inLevel} / ${levelSpan} XP`;
+        document.querySelector('.xpBarFill').style.width = `${Math.round(100 * inLevel / levelSpan)}%`;
+        document.querySelector('.streakNumber').textContent = data.streak;
+    } catch (error) {
+        console.error('Error loading progress:', error);
+    }
+}
+
 const dashboardBtn = document.getElementById('dashboardBtn');
 const profileBtn = document.getElementById('profileBtn');
 const customizeBtn = document.getElementById('customizeBtn');
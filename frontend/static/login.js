@@ -35,6 +35,17 @@ document.addEventListener("DOMContentLoaded", function () {
     });
   }
 
+  // A provider login with two-factor authentication lands here with a challenge
+  const params = new URLSearchParams(window.location.search);
+  if (params.get("challenge")) {
+    completeTwoFactorLogin(params.get("challenge"), params.get("return_to") || "/dashboard");
+  }
+
+  const forgotBtn = document.getElementById("forgotBtn");
+  if (forgotBtn) {
+    forgotBtn.addEventListener("click", requestPasswordReset);
+  }
+
   const googleLoginBtn = document.getElementById("googleLoginBtn");
   if (googleLoginBtn) {
     googleLoginBtn.addEventListener("click", function () {
@@ -61,6 +72,11 @@ async function loginUser() {
 
     const data = await response.json();
 
+    if (data.twoFactorRequired) {
+      await completeTwoFactorLogin(data.challenge, "/dashboard");
+      return;
+    }
+
     if (response.ok && data.success) {
       alert("Login successful!");
       // Store user info in localStorage
@@ -75,6 +91,59 @@ async function loginUser() {
   }
 }
 
+// Second login step for accounts with two-factor authentication
+async function completeTwoFactorLogin(challenge, returnTo) {
+  const code = prompt("Enter the 6-digit code from your authenticator app, or a recovery code:");
+  if (!code) {
+    return;
+  }
+
+  try {
+    const response = await fetch("/api/auth/login/2fa", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ challenge: challenge, code: code.trim() }),
+    });
+    const data = await response.json();
+
+    if (response.ok && data.success) {
+      localStorage.setItem("user", JSON.stringify(data.user));
+      const isLocal = returnTo.startsWith("/") && !returnTo.startsWith("//") && !returnTo.includes("\\");
+      window.location.href = isLocal ? returnTo : "/dashboard";
+    } else {
+      alert(data.message || "Invalid two-factor code.");
+    }
+  } catch (error) {
+    console.error("Error completing two-factor login:", error);
+    alert("An error occurred. Please try again later.");
+  }
+}
+
+async function requestPasswordReset() {
+  const current = document.getElementById("emailField").value.trim();
+  const email = prompt("Enter the email of your account:", current);
+  if (!email) {
+    return;
+  }
+
+  try {
+    const response = await fetch("/api/auth/forgot", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ email: email.trim() }),
+    });
+    const data = await response.json();
+    alert(data.message || "Failed to request a password reset.");
+  } catch (error) {
+    console.error("Error requesting password reset:", error);
+    alert("An error occurred. Please try again later.");
+  }
+}
+
 function validateEmail() {
   const emailField = document.getElementById("emailField");
   const emailRegex = /^[^\s@]+@[^\s@]+\.[^\s@]+$/;
@@ -0,0 +1,61 @@
+document.addEventListener("DOMContentLoaded", function () {
+  const homeBtn = document.getElementById("G6Logo");
+  if (homeBtn) {
+    homeBtn.addEventListener("click", () => {
+      window.location.href = "/";
+    });
+  }
+
+  const backBtn = document.getElementById("backBtn");
+  if (backBtn) {
+    backBtn.addEventListener("click", function (e) {
+      e.preventDefault();
+      window.location.href = "/login";
+    });
+  }
+
+  const authForm = document.querySelector(".authForm");
+  if (authForm) {
+    authForm.addEventListener("submit", async function (e) {
+      e.preventDefault();
+      await resetPassword();
+    });
+  }
+});
+
+async function resetPassword() {
+  const token = new URLSearchParams(window.location.search).get("token");
+  const password = document.getElementById("passwordField").value.trim();
+  const confirm = document.getElementById("confirmField").value.trim();
+
+  if (!token) {
+    alert("This reset link is incomplete. Please request a new one.");
+    return;
+  }
+  if (password === "" || password !== confirm) {
+    alert("Please enter the same new password twice.");
+    return;
+  }
+
+  try {
+    const response = await fetch("/api/auth/reset", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ token: token, password: password }),
+    });
+    const data = await response.json();
+
+    if (response.ok && data.success) {
+      alert("Your password was updated. Please log in.");
+      localStorage.removeItem("user");
+      window.location.href = "/login";
+    } else {
+      alert(data.message || "Failed to reset password.");
+    }
+  } catch (error) {
+    console.error("Error resetting password:", error);
+    alert("An error occurred. Please try again later.");
+  }
+}
@@ -3,9 +3,15 @@ let currentFilters = {
     skill: '',
     types: [],
     tags: [],
-    search: ''
+    tagMode: 'any',
+    search: '',
+    sort: ''
 };
 
+// Number of resources requested per page, and how many are shown so far
+const PAGE_SIZE = 24;
+let loadedCount = 0;
+
 // Abort controller for canceling stale requests
 let abortController = null;
 
@@ -29,6 +35,7 @@ async function loadFilters() {
             <label>
                 <input type="checkbox" name="type" value="${t.id}">
                 ${t.name}
+                <span class="facet-count"></span>
             </label>
         `;
     });
@@ -39,15 +46,18 @@ async function loadFilters() {
         <label style="--tag-color: ${t.color}">
             <input type="checkbox" name="tag" value="${t.id}">
             <span class="tag-badge">${t.name}</span>
+            <span class="facet-count"></span>
         </label>
     `;
     });
 }
 
-// fetchResources fetches all of the items found in the database upon initial load
-async function fetchResources() {
+// fetchResources fetches the first page of resources matching the filters,
+// or the next page when append is true
+async function fetchResources(append = false) {
     const grid = document.getElementById('resourcesGrid');
     const resultCount = document.getElementById('resultCount');
+    const loadMore = document.getElementById('loadMore');
     
     // Cancel any pending request
     if (abortController) {
@@ -70,6 +80,16 @@ async function fetchResources() {
     }
     if (currentFilters.tags.length > 0) {
         params.set('tags', currentFilters.tags.join(','));
+        params.set('tag_mode', currentFilters.tagMode);
+    }
+    if (currentFilters.sort) {
+        params.set('sort', currentFilters.sort);
+    }
+    params.set('limit', PAGE_SIZE);
+    params.set('offset', append ? loadedCount : 0);
+    if (append) {
+        // Facet counts do not change between pages
+        params.set('facets', 'false');
     }
 
     const url = `/api/resources?${params}`;
@@ -84,10 +104,15 @@ async function fetchResources() {
             throw new Error(`Search failed: ${response.status}`);
         }
         
-        const resources = await response.json();
+        const page = await response.json();
         
-        resultCount.textContent = resources.length;
-        renderGrid(resources);
+        resultCount.textContent = page.total;
+        renderGrid(page.items, append);
+        loadedCount = (append ? loadedCount : 0) + page.items.length;
+        loadMore.hidden = !page.has_more;
+        if (page.facets) {
+            renderFacets(page.facets);
+        }
         
     } catch (err) {
         // Ignore abort errors (expected when canceling stale requests)
@@ -99,6 +124,7 @@ async function fetchResources() {
         console.error('Search error:', err);
         grid.innerHTML = '<p class="search-error">Something went wrong. Please try again.</p>';
         resultCount.textContent = '0';
+        loadMore.hidden = true;
         
     } finally {
         grid.classList.remove('loading');
@@ -126,13 +152,44 @@ function highlightMatch(text, query) {
     return escaped.replace(regex, '<mark>$1</mark>');
 }
 
-// renderGrid is a helper method that injects the html elements of each resource found in the database
-function renderGrid(resources) {
+// renderFacets shows how many resources each filter option would match, e.g. "(12)",
+// and disables options that would match nothing unless they are already selected
+function renderFacets(facets) {
+    const groups = [
+        ['#skillFilters', input => facets.skill_levels[input.value.toLowerCase()]],
+        ['#typeFilters', input => facets.types[input.value]],
+        ['#tagFilters', input => facets.tags[input.value]]
+    ];
+    groups.forEach(([selector, countOf]) => {
+        document.querySelectorAll(`${selector} input`).forEach(input => {
+            if (!input.value) {
+                return; // the "All" skill option
+            }
+            const label = input.closest('label');
+            let span = label.querySelector('.facet-count');
+            if (!span) {
+                span = document.createElement('span');
+                span.className = 'facet-count';
+                label.appendChild(span);
+            }
+            const count = countOf(input) || 0;
+            span.textContent = `(${count})`;
+            input.disabled = count === 0 && !input.checked;
+            label.classList.toggle('facet-empty', input.disabled);
+        });
+    });
+}
+
+// renderGrid is a helper method that injects the html elements of each resource found in the database,
+// after the cards already shown when append is true
+function renderGrid(resources, append = false) {
     const grid = document.getElementById('resourcesGrid');
-    grid.innerHTML = '';
+    if (!append) {
+        grid.innerHTML = '';
+    }
     
     // No results message
-    if (resources.length === 0) {
+    if (resources.length === 0 && !append) {
         const searchTerm = currentFilters.search;
         const message = searchTerm && searchTerm.length >= MIN_SEARCH_CHARS
             ? `No resources found for "${escapeHtml(searchTerm)}". Try a different search or adjust your filters.`
@@ -150,7 +207,7 @@ function renderGrid(resources) {
             <h3>${highlightMatch(r.title, query)}</h3>
             <p>${highlightMatch(r.description, query)}</p>
             <span class="skill-badge">${escapeHtml(r.skill_level)}</span>
-            <a href="${escapeHtml(r.url)}" target="_blank">View</a>
+            <a href="/r/${encodeURIComponent(r.id)}" target="_blank">View</a>
         `;
         grid.appendChild(card);
     });
@@ -189,9 +246,29 @@ document.getElementById('tagFilters').addEventListener('change', (e) => {
     fetchResources();
 });
 
+// event listener for the match all learning styles toggle
+document.getElementById('tagModeAll').addEventListener('change', (e) => {
+    currentFilters.tagMode = e.target.checked ? 'all' : 'any';
+    if (currentFilters.tags.length > 0) {
+        fetchResources();
+    }
+});
+
+// event listener for the sort menu
+document.getElementById('sortSelect').addEventListener('change', (e) => {
+    currentFilters.sort = e.target.value;
+    fetchResources();
+});
+
+// event listener for the load more btn
+document.getElementById('loadMore').addEventListener('click', () => {
+    fetchResources(true);
+});
+
 // event listener for the clear btn
 document.getElementById('clearFilters').addEventListener('click', (e) => {
-    currentFilters = { skill: '', types: [], tags: [], search: '' };
+    currentFilters = { skill: '', types: [], tags: [], tagMode: 'any', search: '', sort: currentFilters.sort };
+    document.getElementById('tagModeAll').checked = false;
     document.querySelectorAll('#skillFilters input').forEach(rb => rb.checked = false);
     document.querySelectorAll('#typeFilters input').forEach(cb => cb.checked = false);
     document.querySelectorAll('#tagFilters input').forEach(cb => cb.checked = false);
@@ -215,6 +292,8 @@ document.addEventListener('DOMContentLoaded', () => {
         if (searchInput) searchInput.value = searchQuery;
     }
     
-    loadFilters();
-    fetchResources();
+    // Filters load first so facet counts have labels to fill in
+    loadFilters()
+        .catch(err => console.error('Filter load error:', err))
+        .then(() => fetchResources());
 });
@@ -0,0 +1,75 @@
+// ============ DATA LOADING ============
+
+// shareToken returns the token at the end of /shared/collections/{token}
+function shareToken() {
+    const parts = window.location.pathname.split('/');
+    return decodeURIComponent(parts[parts.length - 1] || '');
+}
+
+// fetchCollection loads the shared collection and renders it, or a message
+// when the link is unknown or no longer shared
+async function fetchCollection() {
+    const grid = document.getElementById('resourcesGrid');
+    grid.classList.add('loading');
+
+    try {
+        const response = await fetch(`/api/shared/collections/${encodeURIComponent(shareToken())}`);
+        if (response.status === 404) {
+            grid.innerHTML = '<p class="no-results">This collection does not exist or is no longer shared.</p>';
+            return;
+        }
+        if (!response.ok) {
+            throw new Error(`Loading failed: ${response.status}`);
+        }
+
+        const collection = await response.json();
+        document.title = `${collection.name} - Shared Collection`;
+        document.getElementById('collectionName').textContent = collection.name;
+        document.getElementById('collectionOwner').textContent = `Shared by ${collection.owner_name}`;
+        document.getElementById('collectionDescription').textContent = collection.description || '';
+        renderGrid(collection.resources || []);
+
+    } catch (err) {
+        console.error('Collection error:', err);
+        grid.innerHTML = '<p class="search-error">Something went wrong. Please try again.</p>';
+
+    } finally {
+        grid.classList.remove('loading');
+    }
+}
+
+// Escape HTML to prevent XSS
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text || '';
+    return div.innerHTML;
+}
+
+// renderGrid injects the html elements of each resource in the collection
+function renderGrid(resources) {
+    const grid = document.getElementById('resourcesGrid');
+    grid.innerHTML = '';
+
+    if (resources.length === 0) {
+        grid.innerHTML = '<p class="no-results">This collection is empty.</p>';
+        return;
+    }
+
+    resources.forEach(r => {
+        const card = document.createElement('div');
+        card.className = 'resource-card';
+        card.innerHTML = `
+            <h3>${escapeHtml(r.title)}</h3>
+            <p>${escapeHtml(r.description)}</p>
+            <span class="skill-badge">${escapeHtml(r.skill_level)}</span>
+            <a href="/r/${encodeURIComponent(r.id)}" target="_blank">View</a>
+        `;
+        grid.appendChild(card);
+    });
+}
+
+// ============ INITIALIZATION ============
+// on load render page functions
+document.addEventListener('DOMContentLoaded', () => {
+    fetchCollection();
+});
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ======== Types ========
+
+// UserIdentity is a provider account linked to a user.
+type UserIdentity struct {
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// IdentitiesResponse lists how a user can log in.
+type IdentitiesResponse struct {
+	HasPassword bool           `json:"has_password"`
+	Identities  []UserIdentity `json:"identities"`
+}
+
+var (
+	errIdentityTaken          = errors.New("this provider account is already linked to another user")
+	errIdentityProviderLinked = errors.New("another account of this provider is already linked; unlink it first")
+	errIdentityEmailInUse     = errors.New("an account with this email already exists; log in and link this provider from your account")
+	errIdentityUnverified     = errors.New("an unverified account with this email already exists; verify the email or reset its password, then log in and link this provider from your account")
+	errIdentityNoEmail        = errors.New("the provider did not share an email address")
+	errIdentityNotFound       = errors.New("provider not linked")
+	errIdentityLastLogin      = errors.New("cannot remove your only way to log in; set a password or link another provider first")
+	errPasswordAlreadySet     = errors.New("a password is already set")
+)
+
+// ======== DB Functions ========
+
+// getIdentityUser returns the user linked to a provider account.
+func getIdentityUser(provider, subject string) (*User, error) {
+	user := &User{}
+	err := db.QueryRow(`
+        SELECT u.id, u.first_name, u.last_name, u.email, COALESCE(u.avatar, ''), u.email_verified_at IS NOT NULL, u.role
+        FROM user_identities i
+        JOIN users u ON u.id = i.user_id
+        WHERE i.provider = ? AND i.subject = ?
+    `, provider, subject).Scan(&user.ID, &user.FName, &user.LName, &user.Email, &user.Avatar, &user.EmailVerified, &user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// insertIdentity links id to userID inside tx.
+func insertIdentity(tx *sql.Tx, userID int, id *ExternalIdentity) error {
+	var n int
+	if err := tx.QueryRow(
+		"SELECT COUNT(*) FROM user_identities WHERE user_id = ? AND provider = ?",
+		userID, id.Provider,
+	).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return errIdentityProviderLinked
+	}
+	_, err := tx.Exec(
+		"INSERT INTO user_identities (user_id, provider, subject, email, last_login_at) VALUES (?, ?, ?, ?, UTC_TIMESTAMP())",
+		userID, id.Provider, id.Subject, id.Email,
+	)
+	return err
+}
+
+// loginWithIdentity returns the user a provider account logs in as.
+//
+// An already linked account logs in its user. Otherwise, a user with the same
+// email is linked only when both the provider and the user verified that
+// email: an unverified account may have been signed up by someone else, who
+// would keep its password, sessions and tokens after the link. Such accounts
+// must be linked from a session with link=1. If no user has the email, a new
+// account without a password is created.
+func loginWithIdentity(id *ExternalIdentity) (*User, error) {
+	user, err := getIdentityUser(id.Provider, id.Subject)
+	if err == nil {
+		if _, err := db.Exec(
+			"UPDATE user_identities SET email = ?, last_login_at = UTC_TIMESTAMP() WHERE provider = ? AND subject = ?",
+			id.Email, id.Provider, id.Subject,
+		); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+	if id.Email == "" {
+		return nil, errIdentityNoEmail
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user = &User{FName: id.FName, LName: id.LName, Email: id.Email, Role: RoleStudent}
+	err = tx.QueryRow(
+		"SELECT id, first_name, last_name, COALESCE(avatar, ''), email_verified_at IS NOT NULL, role FROM users WHERE email = ? FOR UPDATE",
+		id.Email,
+	).Scan(&user.ID, &user.FName, &user.LName, &user.Avatar, &user.EmailVerified, &user.Role)
+	switch {
+	case err == nil:
+		if !id.EmailVerified {
+			return nil, errIdentityEmailInUse
+		}
+		if !user.EmailVerified {
+			return nil, errIdentityUnverified
+		}
+	case err == sql.ErrNoRows:
+		var verifiedAt any
+		if id.EmailVerified {
+			verifiedAt = time.Now().UTC()
+		}
+		result, err := tx.Exec(
+			"INSERT INTO users (first_name, last_name, email, password_hash, avatar, email_verified_at) VALUES (?, ?, ?, NULL, ?, ?)",
+			id.FName, id.LName, id.Email, id.Picture, verifiedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		newID, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		user.ID = int(newID)
+		user.Avatar = id.Picture
+		user.EmailVerified = id.EmailVerified
+	default:
+		return nil, err
+	}
+
+	if err := insertIdentity(tx, user.ID, id); err != nil {
+		return nil, err
+	}
+	return user, tx.Commit()
+}
+
+// linkIdentity links a provider account to userID. Linking an account that
+// is already linked to userID succeeds without changes.
+func linkIdentity(userID int, id *ExternalIdentity) error {
+	owner, err := getIdentityUser(id.Provider, id.Subject)
+	if err == nil {
+		if owner.ID != userID {
+			return errIdentityTaken
+		}
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := insertIdentity(tx, userID, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getIdentities lists userID's linked providers and whether a password is set.
+func getIdentities(userID int) (*IdentitiesResponse, error) {
+	resp := &IdentitiesResponse{Identities: []UserIdentity{}}
+	if err := db.QueryRow(
+		"SELECT password_hash IS NOT NULL FROM users WHERE id = ?", userID,
+	).Scan(&resp.HasPassword); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+        SELECT provider, COALESCE(email, ''), created_at, last_login_at
+        FROM user_identities
+        WHERE user_id = ?
+        ORDER BY provider
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i UserIdentity
+		if err := rows.Scan(&i.Provider, &i.Email, &i.CreatedAt, &i.LastLoginAt); err != nil {
+			return nil, err
+		}
+		resp.Identities = append(resp.Identities, i)
+	}
+	return resp, rows.Err()
+}
+
+// unlinkIdentity removes userID's link to provider unless it is their only
+// way to log in.
+func unlinkIdentity(userID int, provider string) error {
+	current, err := getIdentities(userID)
+	if err != nil {
+		return err
+	}
+	linked := false
+	for _, i := range current.Identities {
+		linked = linked || i.Provider == provider
+	}
+	if !linked {
+		return errIdentityNotFound
+	}
+	if !current.HasPassword && len(current.Identities) == 1 {
+		return errIdentityLastLogin
+	}
+	_, err = db.Exec("DELETE FROM user_identities WHERE user_id = ? AND provider = ?", userID, provider)
+	return err
+}
+
+// setInitialPassword adds a password to an account created through a provider.
+func setInitialPassword(userID int, password string) error {
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(
+		"UPDATE users SET password_hash = ? WHERE id = ? AND password_hash IS NULL",
+		hashed, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errPasswordAlreadySet
+	}
+	return nil
+}
+
+// ======== HTTP Handlers ========
+
+// handleIdentities serves GET /api/me/identities, listing the providers
+// linked to the user and whether they have a password. New providers are
+// linked through /auth/{provider}/login?link=1.
+func handleIdentities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	resp, err := getIdentities(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleIdentity serves DELETE /api/me/identities/{provider}, which unlinks a provider.
+func handleIdentity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use DELETE"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	if err := unlinkIdentity(userID, r.PathValue("provider")); err != nil {
+		writeIdentityError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleIdentityPassword serves POST /api/me/identities/password, which sets
+// a password on an account that was created through a provider.
+func handleIdentityPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	defer r.Body.Close()
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if err := validateNewPassword(req.Password); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := setInitialPassword(userID, req.Password); err != nil {
+		writeIdentityError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeIdentityError maps identity errors to HTTP statuses.
+func writeIdentityError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errIdentityNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, errIdentityLastLogin), errors.Is(err, errPasswordAlreadySet):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== Types ========
+
+// JournalEntry is one study-log note owned by a user. Body is Markdown and may
+// contain live matrix blocks (see parseMatrixBlocks).
+type JournalEntry struct {
+	ID        int           `json:"id"`
+	Title     string        `json:"title"`
+	Body      string        `json:"body"`
+	Tags      []string      `json:"tags"`
+	Blocks    []MatrixBlock `json:"blocks,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// JournalEntryRequest is the JSON payload for creating or replacing an entry.
+type JournalEntryRequest struct {
+	Title string   `json:"title"`
+	Body  string   `json:"body"`
+	Tags  []string `json:"tags"`
+}
+
+// MatrixBlock is a live computation embedded in a journal body as a fenced
+// code block tagged "matrix", for example:
+//
+//	```matrix
+//	{"op": "rref", "A": [[1, 2], [3, 4]]}
+//	```
+//
+// Only the inputs are stored; Result is recomputed every time the entry is
+// rendered so notes always reflect the current matrix engine.
+type MatrixBlock struct {
+	Index  int    `json:"index"` // position of the block within the body
+	Op     string `json:"op,omitempty"`
+	A      Matrix `json:"A"`
+	B      Matrix `json:"B,omitempty"`
+	Result Matrix `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+const (
+	maxJournalTitleLen = 200
+	maxJournalTags     = 20
+	maxJournalTagLen   = 50
+)
+
+// matrixBlockOps maps block operation names to the matrix API endpoints that
+// evaluate them. An empty op just displays A.
+var matrixBlockOps = map[string]string{
+	"add":      "/api/matrix/add",
+	"subtract": "/api/matrix/subtract",
+	"multiply": "/api/matrix/multiply",
+	"rref":     "/api/matrix/rref",
+}
+
+// ======== Matrix Blocks ========
+
+// parseMatrixBlocks extracts every ```matrix fenced block from body.
+//
+// It returns an error naming the first block whose JSON is malformed or whose
+// op is unknown, so invalid notes are rejected when saved.
+func parseMatrixBlocks(body string) ([]MatrixBlock, error) {
+	var blocks []MatrixBlock
+	lines := strings.Split(body, "\n")
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != "```matrix" {
+			continue
+		}
+		var src strings.Builder
+		closed := false
+		for i++; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "```" {
+				closed = true
+				break
+			}
+			src.WriteString(lines[i])
+			src.WriteByte('\n')
+		}
+		index := len(blocks)
+		if !closed {
+			return nil, fmt.Errorf("matrix block %d is not closed", index)
+		}
+
+		block := MatrixBlock{Index: index}
+		if err := json.Unmarshal([]byte(src.String()), &block); err != nil {
+			return nil, fmt.Errorf("matrix block %d: invalid JSON: %w", index, err)
+		}
+		block.Index = index
+		block.Op = strings.ToLower(strings.TrimSpace(block.Op))
+		if _, ok := matrixBlockOps[block.Op]; block.Op != "" && !ok {
+			return nil, fmt.Errorf("matrix block %d: unknown op %q", index, block.Op)
+		}
+		block.Result, block.Error = nil, ""
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// evaluateMatrixBlocks computes the result of each block in place. Errors are
+// reported per block so one bad computation does not hide the others.
+func evaluateMatrixBlocks(blocks []MatrixBlock) {
+	for i := range blocks {
+		b := &blocks[i]
+		var res Matrix
+		var err error
+		if b.Op == "" {
+			err = validateRect(b.A)
+			res = b.A
+		} else {
+			body, _ := json.Marshal(TwoMatrixRequest{A: b.A, B: b.B})
+			res, err = runMatrixEndpoint(matrixBlockOps[b.Op], body)
+		}
+		if err != nil {
+			b.Error = err.Error()
+			continue
+		}
+		b.Result = res
+	}
+}
+
+// normalizeJournalTags trims, lowercases and de-duplicates tags. Commas are
+// refused because listings read tags back as one comma-separated string.
+func normalizeJournalTags(tags []string) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if strings.Contains(t, ",") {
+			return nil, fmt.Errorf("tag %q must not contain a comma", t)
+		}
+		if len(t) > maxJournalTagLen {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", t, maxJournalTagLen)
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	if len(out) > maxJournalTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxJournalTags)
+	}
+	return out, nil
+}
+
+// validateJournalRequest checks an entry payload and normalizes its fields.
+func validateJournalRequest(req *JournalEntryRequest) error {
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		return errors.New("title is required")
+	}
+	if len(req.Title) > maxJournalTitleLen {
+		return fmt.Errorf("title is longer than %d characters", maxJournalTitleLen)
+	}
+	if _, err := parseMatrixBlocks(req.Body); err != nil {
+		return err
+	}
+	tags, err := normalizeJournalTags(req.Tags)
+	if err != nil {
+		return err
+	}
+	req.Tags = tags
+	return nil
+}
+
+// ======== DB Functions ========
+
+// errJournalNotFound is returned when an entry does not exist or belongs to
+// another user; the two cases are deliberately indistinguishable.
+var errJournalNotFound = errors.New("journal entry not found")
+
+// setJournalTags replaces the tags of entryID inside tx.
+func setJournalTags(tx *sql.Tx, entryID int, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM journal_entry_tags WHERE entry_id = ?", entryID); err != nil {
+		return err
+	}
+	for _, t := range tags {
+		if _, err := tx.Exec("INSERT INTO journal_entry_tags (entry_id, tag) VALUES (?, ?)", entryID, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createJournalEntry inserts a new entry with its tags for userID.
+func createJournalEntry(userID int, req JournalEntryRequest) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO journal_entries (user_id, title, body) VALUES (?, ?, ?)",
+		userID, req.Title, req.Body,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := setJournalTags(tx, int(id), req.Tags); err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+// updateJournalEntry replaces the title, body and tags of an entry owned by userID.
+func updateJournalEntry(userID, entryID int, req JournalEntryRequest) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owner int
+	err = tx.QueryRow("SELECT user_id FROM journal_entries WHERE id = ? FOR UPDATE", entryID).Scan(&owner)
+	if err == sql.ErrNoRows || (err == nil && owner != userID) {
+		return errJournalNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE journal_entries SET title = ?, body = ? WHERE id = ?",
+		req.Title, req.Body, entryID,
+	); err != nil {
+		return err
+	}
+	if err := setJournalTags(tx, entryID, req.Tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteJournalEntry removes an entry owned by userID; its tags cascade.
+func deleteJournalEntry(userID, entryID int) error {
+	result, err := db.Exec("DELETE FROM journal_entries WHERE id = ? AND user_id = ?", entryID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errJournalNotFound
+	}
+	return nil
+}
+
+// getJournalEntries returns userID's entries, newest first, optionally limited
+// to one entry, a tag, and a full-text search over title and body.
+func getJournalEntries(userID, entryID int, tag, search string) ([]JournalEntry, error) {
+	query := `
+        SELECT e.id, e.title, e.body, e.created_at, e.updated_at,
+        COALESCE(GROUP_CONCAT(t.tag ORDER BY t.tag SEPARATOR ','), '')
+        FROM journal_entries e
+        LEFT JOIN journal_entry_tags t ON e.id = t.entry_id
+        WHERE e.user_id = ?
+    `
+	args := []interface{}{userID}
+
+	if entryID > 0 {
+		query += " AND e.id = ?"
+		args = append(args, entryID)
+	}
+
+	// Same split as GetResources: FULLTEXT ignores very short words.
+	if search != "" {
+		if len(search) < 3 {
+			query += " AND (e.title LIKE ? OR e.body LIKE ?)"
+			pattern := "%" + search + "%"
+			args = append(args, pattern, pattern)
+		} else {
+			query += " AND MATCH(e.title, e.body) AGAINST(? IN NATURAL LANGUAGE MODE)"
+			args = append(args, search)
+		}
+	}
+
+	if tag != "" {
+		query += " AND EXISTS (SELECT 1 FROM journal_entry_tags ft WHERE ft.entry_id = e.id AND ft.tag = ?)"
+		args = append(args, strings.ToLower(strings.TrimSpace(tag)))
+	}
+
+	query += " GROUP BY e.id ORDER BY e.updated_at DESC, e.id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []JournalEntry{}
+	for rows.Next() {
+		var e JournalEntry
+		var tags string
+		if err := rows.Scan(&e.ID, &e.Title, &e.Body, &e.CreatedAt, &e.UpdatedAt, &tags); err != nil {
+			return nil, err
+		}
+		e.Tags = []string{}
+		if tags != "" {
+			e.Tags = strings.Split(tags, ",")
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// getJournalEntry returns one entry owned by userID with its matrix blocks evaluated.
+func getJournalEntry(userID, entryID int) (*JournalEntry, error) {
+	entries, err := getJournalEntries(userID, entryID, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errJournalNotFound
+	}
+	e := entries[0]
+	blocks, err := parseMatrixBlocks(e.Body)
+	if err != nil {
+		return nil, err
+	}
+	evaluateMatrixBlocks(blocks)
+	e.Blocks = blocks
+	return &e, nil
+}
+
+// ======== HTTP Handlers ========
+
+// handleJournal serves /api/journal.
+//
+// GET lists the user's entries (optional query params: q, tag).
+// POST creates an entry and returns it with evaluated matrix blocks.
+func handleJournal(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := getJournalEntries(userID, 0, r.URL.Query().Get("tag"), strings.TrimSpace(r.URL.Query().Get("q")))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+
+	case http.MethodPost:
+		req, ok := parseJournalRequest(w, r)
+		if !ok {
+			return
+		}
+		id, err := createJournalEntry(userID, *req)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		entry, err := getJournalEntry(userID, id)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusCreated, entry)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or POST"})
+	}
+}
+
+// handleJournalEntry serves /api/journal/{id}.
+//
+// GET returns the entry with its matrix blocks re-evaluated, PUT replaces its
+// title, body and tags, and DELETE removes it. Entries of other users are
+// reported as 404.
+func handleJournalEntry(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	entryID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || entryID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid entry id"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// handled after the switch
+
+	case http.MethodPut:
+		req, ok := parseJournalRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := updateJournalEntry(userID, entryID, *req); err != nil {
+			writeJournalError(w, err)
+			return
+		}
+
+	case http.MethodDelete:
+		if err := deleteJournalEntry(userID, entryID); err != nil {
+			writeJournalError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET, PUT or DELETE"})
+		return
+	}
+
+	entry, err := getJournalEntry(userID, entryID)
+	if err != nil {
+		writeJournalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// parseJournalRequest decodes and validates an entry payload, writing a 400
+// response on failure.
+func parseJournalRequest(w http.ResponseWriter, r *http.Request) (*JournalEntryRequest, bool) {
+	defer r.Body.Close()
+	var req JournalEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return nil, false
+	}
+	if err := validateJournalRequest(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	return &req, true
+}
+
+// writeJournalError maps journal repository errors to HTTP responses.
+func writeJournalError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errJournalNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseMatrixBlocks verifies extraction and validation of ```matrix blocks.
+func TestParseMatrixBlocks(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		body      string
+		expected  []MatrixBlock
+		expectErr bool
+	}{
+		{
+			name:     "No blocks",
+			body:     "# Notes\nJust text.\n```go\nfmt.Println()\n```",
+			expected: nil,
+		},
+		{
+			name:      "Bare matrix must be wrapped in an object",
+			body:      "Start\n```matrix\n[[1]]\n```\n",
+			expectErr: true,
+		},
+		{
+			name: "Two blocks keep their order",
+			body: "```matrix\n{\"A\": [[1, 2]]}\n```\ntext\n  ```matrix\n{\"op\": \"RREF\", \"A\": [[2, 4], [1, 3]]}\n  ```",
+			expected: []MatrixBlock{
+				{Index: 0, A: Matrix{{1, 2}}},
+				{Index: 1, Op: "rref", A: Matrix{{2, 4}, {1, 3}}},
+			},
+		},
+		{
+			name:      "Unknown op",
+			body:      "```matrix\n{\"op\": \"invert\", \"A\": [[1]]}\n```",
+			expectErr: true,
+		},
+		{
+			name:      "Unclosed block",
+			body:      "```matrix\n{\"A\": [[1]]}\n",
+			expectErr: true,
+		},
+		{
+			name:      "Invalid JSON",
+			body:      "```matrix\n{\"A\": [[1,]]}\n```",
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := parseMatrixBlocks(tt.body)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("parseMatrixBlocks() error status: observed error = %v, want expected error: %v", err, tt.expectErr)
+			}
+			if !tt.expectErr && !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("parseMatrixBlocks() observed = %+v, expected: %+v", actual, tt.expected)
+			}
+		})
+	}
+}
+
+// TestEvaluateMatrixBlocks verifies that blocks are computed with the matrix engine
+// and that errors are reported per block.
+func TestEvaluateMatrixBlocks(t *testing.T) {
+	t.Parallel()
+	blocks := []MatrixBlock{
+		{Index: 0, A: Matrix{{1, 2}}},
+		{Index: 1, Op: "multiply", A: Matrix{{1, 2}}, B: Matrix{{3}, {4}}},
+		{Index: 2, Op: "add", A: Matrix{{1}}, B: Matrix{{1, 2}}},
+		{Index: 3, Op: "rref", A: Matrix{{2, 4}, {1, 3}}},
+	}
+	evaluateMatrixBlocks(blocks)
+
+	if !reflect.DeepEqual(blocks[0].Result, Matrix{{1, 2}}) {
+		t.Errorf("display block result = %v", blocks[0].Result)
+	}
+	if !reflect.DeepEqual(blocks[1].Result, Matrix{{11}}) {
+		t.Errorf("multiply block result = %v", blocks[1].Result)
+	}
+	if blocks[2].Error == "" || blocks[2].Result != nil {
+		t.Errorf("add block with mismatched dimensions: result = %v, error = %q", blocks[2].Result, blocks[2].Error)
+	}
+	if !matricesAlmostEqual(blocks[3].Result, Matrix{{1, 0}, {0, 1}}) {
+		t.Errorf("rref block result = %v", blocks[3].Result)
+	}
+}
+
+// TestNormalizeJournalTags verifies tags are trimmed, lowercased and
+// de-duplicated, and that commas are refused.
+func TestNormalizeJournalTags(t *testing.T) {
+	t.Parallel()
+	observed, err := normalizeJournalTags([]string{" Eigen ", "eigen", "", "QR"})
+	if err != nil || !reflect.DeepEqual(observed, []string{"eigen", "qr"}) {
+		t.Errorf("normalizeJournalTags() observed = %v, err = %v, expected: [eigen qr]", observed, err)
+	}
+	for _, tags := range [][]string{{"eigen,qr"}, {strings.Repeat("a", maxJournalTagLen+1)}} {
+		if _, err := normalizeJournalTags(tags); err == nil {
+			t.Errorf("normalizeJournalTags(%q) observed no error, expected one", tags)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ======== Dead-Link Checker ========
+
+const (
+	linkCheckInterval     = 24 * time.Hour
+	linkCheckMaxFailures  = 3 // consecutive failed checks before a resource is hidden
+	linkCheckConcurrency  = 8 // hosts checked at the same time
+	linkCheckHostDelay    = 2 * time.Second
+	linkCheckRetries      = 2
+	linkCheckRetryDelay   = 5 * time.Second
+	linkCheckTimeout      = 15 * time.Second
+	linkCheckUserAgent    = "G6LabsLinkChecker/1.0 (+https://github.com/sfyatee/likeag6)"
+	maxLinkCheckErrorSize = 255
+)
+
+// linkTarget is one resource URL to check.
+type linkTarget struct {
+	ID  int
+	URL string
+}
+
+// linkResult is the outcome of checking one URL. Status is 0 when no HTTP
+// response was received.
+type linkResult struct {
+	Status  int
+	Latency time.Duration
+	Err     string
+}
+
+// ok reports whether the link works: any final status below 400 after
+// redirects.
+func (r linkResult) ok() bool {
+	return r.Err == "" && r.Status > 0 && r.Status < 400
+}
+
+// LinkReportEntry is one resource in the admin link report.
+type LinkReportEntry struct {
+	ResourceID          int        `json:"resource_id"`
+	Title               string     `json:"title"`
+	Url                 string     `json:"url"`
+	IsActive            bool       `json:"is_active"`
+	StatusCode          *int       `json:"status_code"`
+	Error               string     `json:"error,omitempty"`
+	LatencyMs           int        `json:"latency_ms"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	CheckedAt           time.Time  `json:"checked_at"`
+	DeactivatedAt       *time.Time `json:"deactivated_at"`
+}
+
+// linkChecker checks URLs with bounded concurrency. Each host is checked by
+// one goroutine at a time with a delay between requests, so no site sees
+// more than one request in flight from us.
+type linkChecker struct {
+	client      *http.Client
+	concurrency int
+	hostDelay   time.Duration
+	retries     int
+	retryDelay  time.Duration
+	userAgent   string
+}
+
+// newLinkChecker returns a checker with the production settings.
+func newLinkChecker() *linkChecker {
+	return &linkChecker{
+		client:      &http.Client{Timeout: linkCheckTimeout},
+		concurrency: linkCheckConcurrency,
+		hostDelay:   linkCheckHostDelay,
+		retries:     linkCheckRetries,
+		retryDelay:  linkCheckRetryDelay,
+		userAgent:   linkCheckUserAgent,
+	}
+}
+
+// retryable reports whether a failed check may succeed if tried again:
+// network errors, rate limiting and server errors. Client errors such as
+// 404 are final.
+func (r linkResult) retryable() bool {
+	return r.Status == 0 || r.Status == http.StatusTooManyRequests || r.Status >= 500
+}
+
+// request sends one method request to rawURL and discards the body.
+func (c *linkChecker) request(ctx context.Context, method, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// check tries rawURL once: HEAD first, then GET when the server refuses HEAD
+// or answers it with an error, since many sites handle HEAD badly.
+func (c *linkChecker) check(ctx context.Context, rawURL string) linkResult {
+	start := time.Now()
+	status, err := c.request(ctx, http.MethodHead, rawURL)
+	if err != nil || status >= 400 {
+		status, err = c.request(ctx, http.MethodGet, rawURL)
+	}
+	result := linkResult{Status: status, Latency: time.Since(start)}
+	if err != nil {
+		result.Err = truncate(err.Error(), maxLinkCheckErrorSize)
+	}
+	return result
+}
+
+// checkWithRetries checks rawURL, retrying retryable failures with a growing
+// delay.
+func (c *linkChecker) checkWithRetries(ctx context.Context, rawURL string) linkResult {
+	result := c.check(ctx, rawURL)
+	for attempt := 1; attempt <= c.retries && !result.ok() && result.retryable(); attempt++ {
+		if !sleepCtx(ctx, time.Duration(attempt)*c.retryDelay) {
+			break
+		}
+		result = c.check(ctx, rawURL)
+	}
+	return result
+}
+
+// checkAll checks every target and returns the results by resource ID.
+// Targets are grouped by host; at most concurrency hosts are checked at
+// once, and each host's links are checked one after another.
+func (c *linkChecker) checkAll(ctx context.Context, targets []linkTarget) map[int]linkResult {
+	byHost := map[string][]linkTarget{}
+	var hosts []string
+	for _, t := range targets {
+		host := ""
+		if u, err := url.Parse(t.URL); err == nil {
+			host = strings.ToLower(u.Host)
+		}
+		if _, seen := byHost[host]; !seen {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], t)
+	}
+
+	results := make(map[int]linkResult, len(targets))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(c.concurrency, 1))
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(group []linkTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			for i, t := range group {
+				if i > 0 && !sleepCtx(ctx, c.hostDelay) {
+					return
+				}
+				result := c.checkWithRetries(ctx, t.URL)
+				mu.Lock()
+				results[t.ID] = result
+				mu.Unlock()
+			}
+		}(byHost[host])
+	}
+	wg.Wait()
+	return results
+}
+
+// sleepCtx waits for d and reports false if ctx ends first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ======== DB Functions ========
+
+// getLinkTargets returns the resources to check: every active one, plus
+// those the checker itself hid so they come back once their link recovers.
+func getLinkTargets() ([]linkTarget, error) {
+	rows, err := db.Query(`
+        SELECT r.id, r.url FROM resources r
+        LEFT JOIN resource_link_checks c ON c.resource_id = r.id
+        WHERE r.is_active = TRUE OR c.deactivated_at IS NOT NULL
+        ORDER BY r.id
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var targets []linkTarget
+	for rows.Next() {
+		var t linkTarget
+		if err := rows.Scan(&t.ID, &t.URL); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// recordLinkResult stores the result of checking resourceID. After
+// maxFailures consecutive failures an active resource is hidden, and a
+// resource the checker hid is shown again once its link works.
+func recordLinkResult(resourceID int, result linkResult, maxFailures int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	var deactivated sql.NullTime
+	err = tx.QueryRow(
+		"SELECT consecutive_failures, deactivated_at FROM resource_link_checks WHERE resource_id = ? FOR UPDATE",
+		resourceID,
+	).Scan(&failures, &deactivated)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if result.ok() {
+		failures = 0
+	} else {
+		failures++
+	}
+
+	var status any
+	if result.Status > 0 {
+		status = result.Status
+	}
+	if _, err := tx.Exec(`
+        INSERT INTO resource_link_checks (resource_id, status_code, error, latency_ms, consecutive_failures, checked_at)
+        VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP())
+        ON DUPLICATE KEY UPDATE status_code = VALUES(status_code), error = VALUES(error),
+            latency_ms = VALUES(latency_ms), consecutive_failures = VALUES(consecutive_failures),
+            checked_at = VALUES(checked_at)`,
+		resourceID, status, nullIfEmpty(result.Err), result.Latency.Milliseconds(), failures,
+	); err != nil {
+		return err
+	}
+
+	// Hiding only touches active resources, so a resource the checker hid
+	// before an admin showed it again is hidden again rather than skipped.
+	switch {
+	case !result.ok() && failures >= maxFailures:
+		res, err := tx.Exec("UPDATE resources SET is_active = FALSE WHERE id = ? AND is_active = TRUE", resourceID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			if _, err := tx.Exec("UPDATE resource_link_checks SET deactivated_at = UTC_TIMESTAMP() WHERE resource_id = ?", resourceID); err != nil {
+				return err
+			}
+			log.Printf("link checker: hid resource %d after %d failed checks", resourceID, failures)
+		}
+	case result.ok() && deactivated.Valid:
+		if _, err := tx.Exec("UPDATE resources SET is_active = TRUE WHERE id = ?", resourceID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE resource_link_checks SET deactivated_at = NULL WHERE resource_id = ?", resourceID); err != nil {
+			return err
+		}
+		log.Printf("link checker: restored resource %d", resourceID)
+	}
+	return tx.Commit()
+}
+
+// checkResourceLinks checks every target resource with c and records the
+// results. It returns how many links were checked and how many failed.
+func checkResourceLinks(ctx context.Context, c *linkChecker) (checked, failed int, err error) {
+	targets, err := getLinkTargets()
+	if err != nil {
+		return 0, 0, err
+	}
+	results := c.checkAll(ctx, targets)
+	for id, result := range results {
+		// A resource deleted during the run cannot be recorded; skip it.
+		if err := recordLinkResult(id, result, linkCheckMaxFailures); err != nil {
+			log.Printf("failed to record link check of resource %d: %v", id, err)
+			continue
+		}
+		checked++
+		if !result.ok() {
+			failed++
+		}
+	}
+	return checked, failed, ctx.Err()
+}
+
+// startLinkChecker checks resource links every interval until the process
+// exits.
+func startLinkChecker(interval time.Duration) {
+	go func() {
+		c := newLinkChecker()
+		for {
+			checked, failed, err := checkResourceLinks(context.Background(), c)
+			if err != nil {
+				log.Printf("failed to check resource links: %v", err)
+			} else {
+				log.Printf("link checker: %d links checked, %d failing", checked, failed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// getLinkReport returns the latest check of every checked resource, most
+// failures first. With failingOnly, links that work are left out.
+func getLinkReport(failingOnly bool) ([]LinkReportEntry, error) {
+	query := `
+        SELECT r.id, r.title, r.url, r.is_active, c.status_code, COALESCE(c.error, ''),
+        c.latency_ms, c.consecutive_failures, c.checked_at, c.deactivated_at
+        FROM resource_link_checks c JOIN resources r ON r.id = c.resource_id
+    `
+	if failingOnly {
+		query += " WHERE c.consecutive_failures > 0"
+	}
+	query += " ORDER BY c.consecutive_failures DESC, r.id"
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []LinkReportEntry{}
+	for rows.Next() {
+		var e LinkReportEntry
+		var status sql.NullInt64
+		var deactivated sql.NullTime
+		if err := rows.Scan(&e.ResourceID, &e.Title, &e.Url, &e.IsActive, &status, &e.Error,
+			&e.LatencyMs, &e.ConsecutiveFailures, &e.CheckedAt, &deactivated); err != nil {
+			return nil, err
+		}
+		if status.Valid {
+			s := int(status.Int64)
+			e.StatusCode = &s
+		}
+		if deactivated.Valid {
+			e.DeactivatedAt = &deactivated.Time
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ======== HTTP Handlers ========
+
+// handleLinkReport serves GET /api/admin/resources/link-report. By default
+// only failing links are listed; ?all=true lists every checked resource.
+func handleLinkReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	entries, err := getLinkReport(r.URL.Query().Get("all") != "true")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// ======== Commands ========
+
+// cliCheckLinks implements "g6labs resources check-links", which runs one
+// check right away instead of waiting for the schedule.
+func cliCheckLinks(args []string, stdout io.Writer) error {
+	checked, failed, err := checkResourceLinks(context.Background(), newLinkChecker())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%d links checked, %d failing\n", checked, failed)
+	return nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testLinkChecker returns a checker with no waits, for use against
+// httptest servers.
+func testLinkChecker(client *http.Client) *linkChecker {
+	return &linkChecker{client: client, concurrency: 4, retries: 2, userAgent: "test"}
+}
+
+// TestLinkCheckerCheck verifies how responses are classified, including the
+// GET fallback for servers that reject HEAD.
+func TestLinkCheckerCheck(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) })
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/ok", http.StatusMovedPermanently) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantOK     bool
+	}{
+		{"/ok", http.StatusOK, true},
+		{"/gone", http.StatusNotFound, false},
+		{"/no-head", http.StatusOK, true},
+		{"/moved", http.StatusOK, true},
+	}
+	c := testLinkChecker(srv.Client())
+	for _, tt := range tests {
+		result := c.check(context.Background(), srv.URL+tt.path)
+		if result.Status != tt.wantStatus || result.ok() != tt.wantOK {
+			t.Errorf("check(%s) observed = %+v, expected status %d ok=%v", tt.path, result, tt.wantStatus, tt.wantOK)
+		}
+	}
+
+	closed := httptest.NewServer(mux)
+	closed.Close()
+	if result := c.check(context.Background(), closed.URL+"/ok"); result.ok() || result.Status != 0 || result.Err == "" {
+		t.Errorf("check(closed server) observed = %+v, expected a network error", result)
+	}
+}
+
+// TestLinkCheckerRetries verifies server errors are retried and client
+// errors are not.
+func TestLinkCheckerRetries(t *testing.T) {
+	t.Parallel()
+	var flaky, missing atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		// HEAD and GET of the first attempt fail; the retry succeeds.
+		if flaky.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		missing.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := testLinkChecker(srv.Client())
+	if result := c.checkWithRetries(context.Background(), srv.URL+"/flaky"); !result.ok() {
+		t.Errorf("checkWithRetries(/flaky) observed = %+v, expected success after a retry", result)
+	}
+	if result := c.checkWithRetries(context.Background(), srv.URL+"/missing"); result.ok() {
+		t.Errorf("checkWithRetries(/missing) observed = %+v, expected failure", result)
+	}
+	if n := missing.Load(); n != 2 {
+		t.Errorf("requests to /missing observed = %d, expected: 2 (HEAD and GET, no retry)", n)
+	}
+}
+
+// TestLinkCheckerCheckAllPoliteness verifies every target gets a result, a
+// host never sees two requests at once, and at most concurrency hosts are
+// checked at the same time.
+func TestLinkCheckerCheckAllPoliteness(t *testing.T) {
+	t.Parallel()
+	const hosts, perHost, concurrency = 5, 4, 2
+
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	maxPerHost, active, maxActive := 0, 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight[r.Host]++
+		if inFlight[r.Host] == 1 {
+			active++
+		}
+		maxPerHost = max(maxPerHost, inFlight[r.Host])
+		maxActive = max(maxActive, active)
+		mu.Unlock()
+
+		time.Sleep(2 * time.Millisecond)
+
+		mu.Lock()
+		inFlight[r.Host]--
+		if inFlight[r.Host] == 0 {
+			active--
+		}
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/dead") {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer srv.Close()
+
+	// Every site*.test name dials the test server, so the checker sees
+	// separate hosts and the handler tells them apart by the Host header.
+	client := srv.Client()
+	var dialer net.Dialer
+	client.Transport = &http.Transport{DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, srv.Listener.Addr().String())
+	}}
+	var targets []linkTarget
+	for h := 0; h < hosts; h++ {
+		for i := 0; i < perHost; i++ {
+			path := fmt.Sprintf("/page%d", i)
+			if i == perHost-1 {
+				path = "/dead"
+			}
+			targets = append(targets, linkTarget{ID: h*perHost + i + 1, URL: fmt.Sprintf("http://site%d.test%s", h, path)})
+		}
+	}
+
+	c := testLinkChecker(client)
+	c.concurrency = concurrency
+	results := c.checkAll(context.Background(), targets)
+	if len(results) != len(targets) {
+		t.Fatalf("checkAll() observed %d results, expected: %d", len(results), len(targets))
+	}
+	for _, target := range targets {
+		if dead := strings.HasSuffix(target.URL, "/dead"); results[target.ID].ok() == dead {
+			t.Errorf("result of %s observed = %+v, expected ok=%v", target.URL, results[target.ID], !dead)
+		}
+	}
+	if maxPerHost != 1 {
+		t.Errorf("max requests in flight per host observed = %d, expected: 1", maxPerHost)
+	}
+	if maxActive > concurrency {
+		t.Errorf("max hosts checked at once observed = %d, expected at most: %d", maxActive, concurrency)
+	}
+}
+
+// TestLinkResultOK verifies which results count as working links.
+func TestLinkResultOK(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		result    linkResult
+		ok, retry bool
+	}{
+		{linkResult{Status: 200}, true, false},
+		{linkResult{Status: 304}, true, false},
+		{linkResult{Status: 404}, false, false},
+		{linkResult{Status: 429}, false, true},
+		{linkResult{Status: 502}, false, true},
+		{linkResult{Err: "timeout"}, false, true},
+	}
+	for _, tt := range tests {
+		if tt.result.ok() != tt.ok || (!tt.ok && tt.result.retryable() != tt.retry) {
+			t.Errorf("%+v observed ok=%v retryable=%v, expected ok=%v retryable=%v",
+				tt.result, tt.result.ok(), tt.result.retryable(), tt.ok, tt.retry)
+		}
+	}
+}
+
+// linkState returns whether resourceID is active, its consecutive link
+// failures and whether the checker hid it.
+func linkState(t *testing.T, resourceID int) (active bool, failures int, hidden bool) {
+	t.Helper()
+	var deactivated *time.Time
+	err := db.QueryRow(`
+        SELECT r.is_active, COALESCE(c.consecutive_failures, 0), c.deactivated_at
+        FROM resources r LEFT JOIN resource_link_checks c ON c.resource_id = r.id
+        WHERE r.id = ?`, resourceID,
+	).Scan(&active, &failures, &deactivated)
+	if err != nil {
+		t.Fatalf("reading link state of resource %d: %v", resourceID, err)
+	}
+	return active, failures, deactivated != nil
+}
+
+// TestRecordLinkResultTransitions verifies the checker hides a resource after
+// maxFailures failed checks, restores it once the link works, and leaves
+// resources alone after an admin changes them.
+func TestRecordLinkResultTransitions(t *testing.T) {
+	useTestDB(t)
+	const maxFailures = 3
+	broken := linkResult{Status: http.StatusNotFound}
+	working := linkResult{Status: http.StatusOK}
+	record := func(id int, result linkResult) {
+		t.Helper()
+		if err := recordLinkResult(id, result, maxFailures); err != nil {
+			t.Fatalf("recordLinkResult(%d) observed error = %v", id, err)
+		}
+	}
+	expect := func(step string, id int, active bool, failures int, hidden bool) {
+		t.Helper()
+		a, f, h := linkState(t, id)
+		if a != active || f != failures || h != hidden {
+			t.Errorf("%s: observed active = %v, failures = %d, hidden = %v, expected: %v, %d, %v",
+				step, a, f, h, active, failures, hidden)
+		}
+	}
+
+	id := createTestResource(t, true)
+	for i := 1; i < maxFailures; i++ {
+		record(id, broken)
+	}
+	expect("below the limit", id, true, maxFailures-1, false)
+	record(id, broken)
+	expect("at the limit", id, false, maxFailures, true)
+	record(id, broken)
+	expect("still broken", id, false, maxFailures+1, true)
+	record(id, working)
+	expect("link works again", id, true, 0, false)
+
+	// A success in between starts the count again.
+	record(id, broken)
+	record(id, working)
+	record(id, broken)
+	expect("interrupted failures", id, true, 1, false)
+
+	// A resource an admin hid stays hidden when its link works.
+	manual := createTestResource(t, true)
+	record(manual, broken)
+	if err := setResourceActive(manual, false); err != nil {
+		t.Fatalf("setResourceActive() observed error = %v", err)
+	}
+	record(manual, working)
+	expect("hidden by an admin", manual, false, 0, false)
+
+	// Showing a resource the checker hid through PUT starts it afresh, so
+	// the checker hides it again once the link keeps failing.
+	rewritten := createTestResource(t, true)
+	for i := 0; i < maxFailures; i++ {
+		record(rewritten, broken)
+	}
+	expect("hidden by the checker", rewritten, false, maxFailures, true)
+	current, err := getAdminResource(rewritten)
+	if err != nil {
+		t.Fatalf("getAdminResource() observed error = %v", err)
+	}
+	yes := true
+	req := ResourceRequest{
+		Title: current.Title, Url: current.Url, TypeID: current.Type_id, SkillLevel: current.Skill_level,
+		IsFree: &yes, IsActive: &yes,
+	}
+	if err := updateResource(rewritten, req); err != nil {
+		t.Fatalf("updateResource() observed error = %v", err)
+	}
+	expect("shown through PUT", rewritten, true, 0, false)
+	for i := 0; i < maxFailures; i++ {
+		record(rewritten, broken)
+	}
+	expect("failing after PUT", rewritten, false, maxFailures, true)
+}
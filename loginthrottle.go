@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+)
+
+// ======== Audit Events ========
+
+// Kinds of auth_events rows.
+const (
+	AuthEventLoginFailed     = "login_failed"
+	AuthEventLoginBlocked    = "login_blocked" // refused by throttling, password not checked
+	AuthEventLoginSucceeded  = "login_succeeded"
+	AuthEventPasswordChanged = "password_changed"
+	AuthEventEmailChanged    = "email_changed"
+)
+
+// recordAuthEvent writes an audit event. userID is 0 when the email matches
+// no account. Failures are logged rather than returned so auditing never
+// blocks a login.
+func recordAuthEvent(kind string, userID int, email, ip, detail string) {
+	log.Printf("auth: %s user=%d email=%q ip=%s %s", kind, userID, email, ip, detail)
+	if db == nil {
+		return
+	}
+	var uid any
+	if userID != 0 {
+		uid = userID
+	}
+	if _, err := db.Exec(
+		"INSERT INTO auth_events (user_id, email, ip, kind, detail, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		uid, email, ip, kind, detail, time.Now().UTC(),
+	); err != nil {
+		log.Printf("failed to record auth event %s: %v", kind, err)
+	}
+}
+
+// normalizeLoginEmail is the throttling key of an email address.
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ======== Throttling ========
+
+// throttlePolicy turns a number of recent failed logins into a wait time.
+type throttlePolicy struct {
+	Window       time.Duration // failures older than this are forgotten
+	FreeAttempts int           // failures allowed without delay
+	BaseDelay    time.Duration // delay after the first counted failure, doubled after each further one
+	MaxDelay     time.Duration
+	LockoutAfter int // failures that lock the key out entirely
+	Lockout      time.Duration
+}
+
+var (
+	// accountThrottle protects one account from guessing, wherever it comes from.
+	accountThrottle = throttlePolicy{
+		Window:       time.Hour,
+		FreeAttempts: 3,
+		BaseDelay:    2 * time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockoutAfter: 10,
+		Lockout:      15 * time.Minute,
+	}
+	// ipThrottle slows one address guessing across many accounts. It is
+	// looser, since classrooms and campuses share addresses.
+	ipThrottle = throttlePolicy{
+		Window:       time.Hour,
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockoutAfter: 100,
+		Lockout:      time.Hour,
+	}
+)
+
+// delay returns how long to wait after the last of failures failed attempts.
+func (p throttlePolicy) delay(failures int) time.Duration {
+	if failures >= p.LockoutAfter {
+		return p.Lockout
+	}
+	if failures < p.FreeAttempts {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := p.FreeAttempts; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// retryAfter returns how long from now the key must wait, given its recent
+// failures and the time of the last one.
+func (p throttlePolicy) retryAfter(failures int, last, now time.Time) time.Duration {
+	wait := last.Add(p.delay(failures)).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// loginRetryAfter returns how long a login for email from ip must wait; zero
+// means the attempt may proceed. Account failures count from the last
+// successful login, so the owner logging in clears them.
+func loginRetryAfter(email, ip string) (time.Duration, error) {
+	now := time.Now().UTC()
+
+	var accountFailures int
+	var accountLast sql.NullTime
+	if err := db.QueryRow(`
+        SELECT COUNT(*), MAX(created_at) FROM auth_events
+        WHERE email = ? AND kind = ? AND created_at > ?
+        AND created_at > COALESCE(
+            (SELECT MAX(created_at) FROM auth_events WHERE email = ? AND kind = ?),
+            '1970-01-01')
+    `, email, AuthEventLoginFailed, now.Add(-accountThrottle.Window), email, AuthEventLoginSucceeded,
+	).Scan(&accountFailures, &accountLast); err != nil {
+		return 0, err
+	}
+
+	var ipFailures int
+	var ipLast sql.NullTime
+	if err := db.QueryRow(
+		"SELECT COUNT(*), MAX(created_at) FROM auth_events WHERE ip = ? AND kind = ? AND created_at > ?",
+		ip, AuthEventLoginFailed, now.Add(-ipThrottle.Window),
+	).Scan(&ipFailures, &ipLast); err != nil {
+		return 0, err
+	}
+
+	return max(
+		accountThrottle.retryAfter(accountFailures, accountLast.Time, now),
+		ipThrottle.retryAfter(ipFailures, ipLast.Time, now),
+	), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestThrottleDelay verifies free attempts, exponential backoff, its cap and lockout.
+func TestThrottleDelay(t *testing.T) {
+	t.Parallel()
+	p := throttlePolicy{
+		FreeAttempts: 3,
+		BaseDelay:    2 * time.Second,
+		MaxDelay:     10 * time.Second,
+		LockoutAfter: 8,
+		Lockout:      15 * time.Minute,
+	}
+	tests := map[int]time.Duration{
+		0: 0,
+		2: 0,
+		3: 2 * time.Second,
+		4: 4 * time.Second,
+		5: 8 * time.Second,
+		6: 10 * time.Second,
+		7: 10 * time.Second,
+		8: 15 * time.Minute,
+		9: 15 * time.Minute,
+	}
+	for failures, expected := range tests {
+		if got := p.delay(failures); got != expected {
+			t.Errorf("delay(%d) observed = %v, expected: %v", failures, got, expected)
+		}
+	}
+}
+
+// TestThrottleRetryAfter verifies the wait counts from the last failure.
+func TestThrottleRetryAfter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	if got := accountThrottle.retryAfter(10, now.Add(-5*time.Minute), now); got != 10*time.Minute {
+		t.Errorf("retryAfter() during lockout observed = %v, expected: %v", got, 10*time.Minute)
+	}
+	if got := accountThrottle.retryAfter(10, now.Add(-time.Hour), now); got != 0 {
+		t.Errorf("retryAfter() after lockout observed = %v, expected: 0", got)
+	}
+}
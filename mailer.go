@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ======== Mail ========
+
+// Mail is a plain-text email.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers mail. SMTP is used in production; development setups
+// write mail to a file or the log instead.
+type Mailer interface {
+	Send(msg Mail) error
+}
+
+// mailer is the Mailer used by the application, set up by InitMailer.
+var mailer Mailer = &logMailer{}
+
+// InitMailer selects SMTP when SMTP_HOST is set, and the log sink otherwise.
+func InitMailer() {
+	host := envOr("SMTP_HOST", "")
+	if host == "" {
+		path := envOr("MAIL_LOG_FILE", "")
+		if path == "" {
+			log.Println(" SMTP_HOST not set; outgoing mail is written to the log.")
+		} else {
+			log.Printf(" SMTP_HOST not set; outgoing mail is written to %s.", path)
+		}
+		mailer = &logMailer{path: path}
+		return
+	}
+
+	m := &smtpMailer{
+		addr: net.JoinHostPort(host, envOr("SMTP_PORT", "587")),
+		from: envOr("MAIL_FROM", "G6Labs <no-reply@localhost>"),
+	}
+	if user := envOr("SMTP_USERNAME", ""); user != "" {
+		m.auth = smtp.PlainAuth("", user, envOr("SMTP_PASSWORD", ""), host)
+	}
+	mailer = m
+}
+
+// appBaseURL is the public origin used in links sent by mail.
+func appBaseURL() string {
+	return strings.TrimRight(envOr("APP_BASE_URL", "http://localhost:8080"), "/")
+}
+
+// sendMailAsync sends msg in the background and logs failures, so slow mail
+// servers do not hold up requests or reveal whether an address exists.
+func sendMailAsync(msg Mail) {
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			log.Printf("failed to send mail %q: %v", msg.Subject, err)
+		}
+	}()
+}
+
+// headerValue strips line breaks so a value cannot inject mail headers.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// formatMail renders msg as an RFC 5322 message from from.
+func formatMail(from string, msg Mail) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// smtpMailer sends mail through an SMTP server, using STARTTLS when offered.
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m *smtpMailer) Send(msg Mail) error {
+	envelopeFrom := m.from
+	if start, end := strings.Index(m.from, "<"), strings.Index(m.from, ">"); start >= 0 && end > start {
+		envelopeFrom = m.from[start+1 : end]
+	}
+	return smtp.SendMail(m.addr, m.auth, envelopeFrom, []string{headerValue(msg.To)}, formatMail(m.from, msg))
+}
+
+// logMailer appends mail to a file, or to the log when path is empty.
+type logMailer struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (m *logMailer) Send(msg Mail) error {
+	data := formatMail("G6Labs <no-reply@localhost>", msg)
+	if m.path == "" {
+		log.Printf("mail:\n%s", data)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, "\r\n\r\n"...)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFormatMailStripsHeaderInjection verifies that line breaks in header
+// values cannot add headers to a message.
+func TestFormatMailStripsHeaderInjection(t *testing.T) {
+	t.Parallel()
+	data := string(formatMail("G6Labs <no-reply@localhost>", Mail{
+		To:      "ada@example.com\r\nBcc: eve@example.com",
+		Subject: "Hello\nX-Injected: yes",
+		Body:    "line one\nline two",
+	}))
+	headers, body, _ := strings.Cut(data, "\r\n\r\n")
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") || strings.HasPrefix(line, "X-Injected:") {
+			t.Errorf("Injected header observed: %q", line)
+		}
+	}
+	if body != "line one\r\nline two" {
+		t.Errorf("Body observed = %q, expected: %q", body, "line one\r\nline two")
+	}
+}
+
+// TestLogMailerWritesFile verifies that the development sink appends mail to its file.
+func TestLogMailerWritesFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := &logMailer{path: path}
+	for _, subject := range []string{"First", "Second"} {
+		if err := m.Send(Mail{To: "ada@example.com", Subject: subject, Body: "hi"}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !strings.Contains(string(data), "Subject: First") || !strings.Contains(string(data), "Subject: Second") {
+		t.Errorf("Expected both messages in the log file, observed: %q", data)
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"log"
 	"math"
 	"net/http"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"time"
 )
 
 // ---------- Utils: open browser ----------
@@ -240,6 +242,7 @@ func handleAdd(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, OneMatrixResponse{Error: err.Error()})
 		return
 	}
+	trackActivity(r, ActivityMatrixAdd)
 	writeJSON(w, http.StatusOK, OneMatrixResponse{Result: res})
 }
 
@@ -257,6 +260,7 @@ func handleSub(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, OneMatrixResponse{Error: err.Error()})
 		return
 	}
+	trackActivity(r, ActivityMatrixSubtract)
 	writeJSON(w, http.StatusOK, OneMatrixResponse{Result: res})
 }
 
@@ -274,6 +278,7 @@ func handleMul(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, OneMatrixResponse{Error: err.Error()})
 		return
 	}
+	trackActivity(r, ActivityMatrixMultiply)
 	writeJSON(w, http.StatusOK, OneMatrixResponse{Result: res})
 }
 
@@ -291,10 +296,16 @@ func handleRREF(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, OneMatrixResponse{Error: err.Error()})
 		return
 	}
+	trackActivity(r, ActivityMatrixRREF)
 	writeJSON(w, http.StatusOK, OneMatrixResponse{Result: res})
 }
 
 func main() {
+	// "g6labs <command> ..." runs a maintenance command instead of the server.
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	// Initialize database connection
 	if err := InitDB(); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
@@ -302,6 +313,11 @@ func main() {
 	defer CloseDB()
 
 	InitOAuth()
+	InitMailer()
+	startSessionCleanup(time.Hour)
+	startStreakReminders(time.Hour)
+	startErasureJob(10 * time.Minute)
+	startLinkChecker(linkCheckInterval)
 
 	// Serve frontend files
 	frontendDir := "frontend"
@@ -320,6 +336,8 @@ func main() {
 	dashboardPage := filepath.Join(frontendDir, "dashboard.html")
 	assistPage := filepath.Join(frontendDir, "problemAssistance.html")
 	resourcesPage := filepath.Join(frontendDir, "resources.html")
+	resetPasswordPage := filepath.Join(frontendDir, "resetPassword.html")
+	sharedCollectionPage := filepath.Join(frontendDir, "sharedCollection.html")
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
@@ -339,31 +357,109 @@ func main() {
 			http.ServeFile(w, r, dashboardPage)
 		case "/resources":
 			http.ServeFile(w, r, resourcesPage)
+		case "/reset-password":
+			http.ServeFile(w, r, resetPasswordPage)
 		default:
 			http.NotFound(w, r)
 		}
 	})
+	// Share links of bookmark collections; the page loads /api/shared/collections/{token}
+	http.HandleFunc("/shared/collections/{token}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, sharedCollectionPage)
+	})
 
 	// API routes
-	http.HandleFunc("/api/matrix/add", handleAdd)
-	http.HandleFunc("/api/matrix/subtract", handleSub)
-	http.HandleFunc("/api/matrix/multiply", handleMul)
-	http.HandleFunc("/api/matrix/rref", handleRREF)
-
-	http.HandleFunc("/api/assist/health", handleAssistHealth)
-	http.HandleFunc("/api/assist/chat", handleAssistChat)
+	// API tokens must carry the scope of each route group; see requireScope.
+	http.HandleFunc("/api/matrix/add", requireScope(ScopeMatrixRead, handleAdd))
+	http.HandleFunc("/api/matrix/subtract", requireScope(ScopeMatrixRead, handleSub))
+	http.HandleFunc("/api/matrix/multiply", requireScope(ScopeMatrixRead, handleMul))
+	http.HandleFunc("/api/matrix/rref", requireScope(ScopeMatrixRead, handleRREF))
+
+	http.HandleFunc("/api/assist/health", requireScope(ScopeAssistChat, handleAssistHealth))
+	http.HandleFunc("/api/assist/chat", requireScope(ScopeAssistChat, handleAssistChat))
 	// Resources routes
-	http.HandleFunc("/api/resources/types", handleGetResourceTypes)
-	http.HandleFunc("/api/resources/tags", handleGetResourceTags)
-	http.HandleFunc("/api/resources", handleGetResources)
+	http.HandleFunc("/api/resources/types", requireScope(ScopeResourcesRead, handleGetResourceTypes))
+	http.HandleFunc("/api/resources/tags", requireScope(ScopeResourcesRead, handleGetResourceTags))
+	http.HandleFunc("/api/resources", requireScope(ScopeResourcesRead, handleGetResources))
+	http.HandleFunc("/api/resources/{id}/reviews", requireScope(ScopeResourcesRead, handleResourceReviews))
+	http.HandleFunc("/r/{id}", handleResourceClick)
 
 	// Auth routes
 	http.HandleFunc("/api/auth/signup", handleSignup)
 	http.HandleFunc("/api/auth/login", handleLogin)
+	http.HandleFunc("/api/auth/login/2fa", handleTwoFactorLogin)
+	http.HandleFunc("/api/auth/logout", handleLogout)
+	http.HandleFunc("/api/auth/forgot", handleForgotPassword)
+	http.HandleFunc("/api/auth/reset", handleResetPassword)
+	http.HandleFunc("/api/auth/verify", handleVerifyEmail)
+	http.HandleFunc("/api/auth/verify/resend", handleResendVerification)
+	http.HandleFunc("/api/auth/verify/email-change", handleConfirmEmailChange)
+
+	// Current-user routes
+	http.HandleFunc("/api/me", handleMe)
+	http.HandleFunc("/api/me/email", handleChangeEmail)
+	http.HandleFunc("/api/me/password", handleChangePassword)
+	http.HandleFunc("/api/me/preferences", handlePreferences)
+	http.HandleFunc("/api/me/export", handleExport)
+	http.HandleFunc("/api/me/tokens", handleAPITokens)
+	http.HandleFunc("/api/me/tokens/{id}", handleAPIToken)
+	http.HandleFunc("/api/me/2fa", handleTwoFactor)
+	http.HandleFunc("/api/me/2fa/enroll", handleTwoFactorEnroll)
+	http.HandleFunc("/api/me/2fa/verify", handleTwoFactorVerify)
+	http.HandleFunc("/api/me/identities", handleIdentities)
+	http.HandleFunc("/api/me/identities/password", handleIdentityPassword)
+	http.HandleFunc("/api/me/identities/{provider}", handleIdentity)
+	http.HandleFunc("/api/me/trophies", handleGetMyTrophies)
+	http.HandleFunc("/api/me/progress", handleGetMyProgress)
+	http.HandleFunc("/api/me/quizzes", handleRecordQuiz)
+	http.HandleFunc("/api/me/problems", handleRecordProblem)
+	http.HandleFunc("/api/me/bookmarks", handleBookmarks)
+	http.HandleFunc("/api/me/bookmarks/{id}", handleBookmark)
+	http.HandleFunc("/api/me/collections", handleCollections)
+	http.HandleFunc("/api/me/collections/{id}", handleCollection)
+	http.HandleFunc("/api/me/collections/{id}/items/{resourceId}", handleCollectionItem)
+	http.HandleFunc("/api/me/collections/{id}/share", handleCollectionShare)
+	http.HandleFunc("/api/shared/collections/{token}", handleSharedCollection)
+
+	// Journal routes
+	http.HandleFunc("/api/journal", handleJournal)
+	http.HandleFunc("/api/journal/{id}", handleJournalEntry)
+
+	// Friends, study room and review routes reach other users and need a
+	// verified email.
+	http.HandleFunc("/api/friends", requireVerifiedEmail(handleFriends))
+	http.HandleFunc("/api/friends/{userId}", requireVerifiedEmail(handleFriend))
+	http.HandleFunc("/api/friends/requests", requireVerifiedEmail(handleFriendRequests))
+	http.HandleFunc("/api/friends/requests/{userId}/{action}", requireVerifiedEmail(handleFriendRequestAction))
+	http.HandleFunc("/api/friends/blocks", requireVerifiedEmail(handleFriendBlocks))
+	http.HandleFunc("/api/friends/blocks/{userId}", requireVerifiedEmail(handleFriendBlock))
+	http.HandleFunc("/api/rooms", requireVerifiedEmail(handleRooms))
+	http.HandleFunc("/api/rooms/{id}", requireVerifiedEmail(handleRoom))
+	http.HandleFunc("/api/rooms/{id}/members", requireVerifiedEmail(handleRoomMembers))
+	http.HandleFunc("/api/rooms/{id}/members/{userId}", requireVerifiedEmail(handleRoomMember))
+	http.HandleFunc("/api/rooms/{id}/ws", requireVerifiedEmail(handleRoomSocket))
+	http.HandleFunc("/api/resources/{id}/reviews/me", requireVerifiedEmail(handleMyReview))
+	http.HandleFunc("/api/reviews/{id}/flag", requireVerifiedEmail(handleFlagReview))
+
+	// Admin APIs, guarded by role permissions
+	http.HandleFunc("/api/admin/users", requirePermission(PermManageUsers, handleAdminUsers))
+	http.HandleFunc("/api/admin/users/{id}/role", requirePermission(PermManageUsers, handleAdminUserRole))
+	http.HandleFunc("/api/admin/resources", requirePermission(PermManageResources, handleAdminResources))
+	http.HandleFunc("/api/admin/resources/link-report", requirePermission(PermManageResources, handleLinkReport))
+	http.HandleFunc("/api/admin/resources/click-stats", requirePermission(PermManageResources, handleClickStats))
+	http.HandleFunc("/api/admin/resources/{id}", requirePermission(PermManageResources, handleAdminResource))
+	http.HandleFunc("/api/admin/resources/{id}/activate", requirePermission(PermManageResources, handleAdminResourceActive(true)))
+	http.HandleFunc("/api/admin/resources/{id}/deactivate", requirePermission(PermManageResources, handleAdminResourceActive(false)))
+	http.HandleFunc("/api/admin/resources/{id}/tags", requirePermission(PermManageResources, handleAdminResourceTags))
+	http.HandleFunc("/api/admin/resource-tags", requirePermission(PermManageResources, handleAdminResourceTagList))
+	http.HandleFunc("/api/admin/resource-tags/{id}", requirePermission(PermManageResources, handleAdminResourceTag))
+	http.HandleFunc("/api/admin/reviews", requirePermission(PermModerate, handleModerationQueue))
+	http.HandleFunc("/api/admin/reviews/{id}", requirePermission(PermModerate, handleModerateReview))
 
 	// OAuth routes
-	http.HandleFunc("/auth/google/login", handleGoogleLogin)
-	http.HandleFunc("/auth/google/callback", handleGoogleCallback)
+	http.HandleFunc("/api/auth/providers", handleOAuthProviders)
+	http.HandleFunc("/auth/{provider}/login", handleOAuthLogin)
+	http.HandleFunc("/auth/{provider}/callback", handleOAuthCallback)
 
 	// Start
 	port := 8080
@@ -372,7 +468,8 @@ func main() {
 	go openBrowser(url)
 	fmt.Println("Press CTRL+C to stop")
 
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
+	// Resolve the session cookie of every request before routing it.
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), withCurrentUser(http.DefaultServeMux)); err != nil {
 		log.Fatal(err)
 	}
 }
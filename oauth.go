@@ -3,41 +3,242 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
 	"golang.org/x/oauth2/google"
 )
 
-//  OAuth2 config
-var googleOAuthConfig *oauth2.Config
+// ======== Providers ========
 
-func InitOAuth() {
-	clientID := os.Getenv("GOOGLE_CLIENT_ID")
-	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
-	redirectURL := os.Getenv("GOOGLE_REDIRECT_URL")
-	if redirectURL == "" {
-		redirectURL = "http://localhost:8080/auth/google/callback"
+// ExternalIdentity is the account a provider vouches for after login.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string // stable account ID at the provider
+	Email         string
+	EmailVerified bool
+	FName         string
+	LName         string
+	Picture       string
+}
+
+// OAuthProvider is a login provider usable at /auth/{provider}/login.
+type OAuthProvider interface {
+	// Config returns the OAuth2 client configuration of the provider.
+	Config() *oauth2.Config
+	// Identity fetches the account behind an access token.
+	Identity(ctx context.Context, token *oauth2.Token) (*ExternalIdentity, error)
+}
+
+// oauthProviders holds the configured providers by route name.
+var oauthProviders = map[string]OAuthProvider{}
+
+// oidcProvider speaks OpenID Connect: the account comes from the standard
+// userinfo endpoint, which Google and any discovery-configured issuer serve.
+type oidcProvider struct {
+	name        string
+	config      *oauth2.Config
+	userInfoURL string
+}
+
+func (p *oidcProvider) Config() *oauth2.Config { return p.config }
+
+func (p *oidcProvider) Identity(ctx context.Context, token *oauth2.Token) (*ExternalIdentity, error) {
+	var claims struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"` // some issuers send "true"
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+		Name          string `json:"name"`
+		Picture       string `json:"picture"`
+	}
+	if err := getProviderJSON(ctx, p.config.Client(ctx, token), p.userInfoURL, &claims); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("userinfo response has no subject")
 	}
 
-	if clientID == "" || clientSecret == "" {
-		log.Println(" GOOGLE_CLIENT_ID or GOOGLE_CLIENT_SECRET not set; Google OAuth will not work.")
+	id := &ExternalIdentity{
+		Provider: p.name,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		FName:    claims.GivenName,
+		LName:    claims.FamilyName,
+		Picture:  claims.Picture,
+	}
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+	if id.FName == "" && id.LName == "" {
+		id.FName, id.LName = splitDisplayName(claims.Name)
 	}
+	return id, nil
+}
+
+// githubProvider logs in with GitHub, which is OAuth2 only and exposes the
+// account and its verified emails through its REST API.
+type githubProvider struct {
+	config  *oauth2.Config
+	apiBase string
+}
+
+func (p *githubProvider) Config() *oauth2.Config { return p.config }
 
-	googleOAuthConfig = &oauth2.Config{
+func (p *githubProvider) Identity(ctx context.Context, token *oauth2.Token) (*ExternalIdentity, error) {
+	client := p.config.Client(ctx, token)
+
+	var account struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := getProviderJSON(ctx, client, p.apiBase+"/user", &account); err != nil {
+		return nil, err
+	}
+	if account.ID == 0 {
+		return nil, errors.New("GitHub user response has no id")
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getProviderJSON(ctx, client, p.apiBase+"/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	id := &ExternalIdentity{
+		Provider: "github",
+		Subject:  strconv.FormatInt(account.ID, 10),
+		Picture:  account.AvatarURL,
+	}
+	for _, e := range emails {
+		if e.Primary {
+			id.Email, id.EmailVerified = e.Email, e.Verified
+		}
+	}
+	id.FName, id.LName = splitDisplayName(account.Name)
+	if id.FName == "" {
+		id.FName = account.Login
+	}
+	return id, nil
+}
+
+// getProviderJSON GETs url with client and decodes a JSON response into v.
+func getProviderJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// splitDisplayName splits "Ada King Lovelace" into "Ada" and "King Lovelace".
+func splitDisplayName(name string) (string, string) {
+	first, last, _ := strings.Cut(strings.TrimSpace(name), " ")
+	return first, strings.TrimSpace(last)
+}
+
+// oidcDiscovery is the subset of an OpenID provider configuration document we use.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// discoverOIDCProvider builds a provider from the discovery document at
+// discoveryURL (usually <issuer>/.well-known/openid-configuration).
+func discoverOIDCProvider(ctx context.Context, name, discoveryURL string, config *oauth2.Config) (*oidcProvider, error) {
+	var doc oidcDiscovery
+	if err := getProviderJSON(ctx, http.DefaultClient, discoveryURL, &doc); err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserinfoEndpoint == "" {
+		return nil, errors.New("OIDC discovery: document lacks authorization, token or userinfo endpoint")
+	}
+	config.Endpoint = oauth2.Endpoint{AuthURL: doc.AuthorizationEndpoint, TokenURL: doc.TokenEndpoint}
+	return &oidcProvider{name: name, config: config, userInfoURL: doc.UserinfoEndpoint}, nil
+}
+
+// providerConfig reads <PREFIX>_CLIENT_ID, _CLIENT_SECRET and _REDIRECT_URL.
+// It returns nil when the client credentials are not set.
+func providerConfig(prefix, name string, scopes []string) *oauth2.Config {
+	clientID := envOr(prefix+"_CLIENT_ID", "")
+	clientSecret := envOr(prefix+"_CLIENT_SECRET", "")
+	if clientID == "" || clientSecret == "" {
+		return nil
+	}
+	return &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
-		RedirectURL:  redirectURL,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
+		RedirectURL:  envOr(prefix+"_REDIRECT_URL", "http://localhost:8080/auth/"+name+"/callback"),
+		Scopes:       scopes,
+	}
+}
+
+// InitOAuth registers every provider whose credentials are configured.
+func InitOAuth() {
+	if cfg := providerConfig("GOOGLE", "google", []string{"openid", "email", "profile"}); cfg != nil {
+		cfg.Endpoint = google.Endpoint
+		oauthProviders["google"] = &oidcProvider{
+			name:        "google",
+			config:      cfg,
+			userInfoURL: "https://openidconnect.googleapis.com/v1/userinfo",
+		}
+	} else {
+		log.Println(" GOOGLE_CLIENT_ID or GOOGLE_CLIENT_SECRET not set; Google OAuth will not work.")
+	}
+
+	if cfg := providerConfig("GITHUB", "github", []string{"read:user", "user:email"}); cfg != nil {
+		cfg.Endpoint = github.Endpoint
+		oauthProviders["github"] = &githubProvider{config: cfg, apiBase: "https://api.github.com"}
+	}
+
+	if discoveryURL := envOr("OIDC_DISCOVERY_URL", ""); discoveryURL != "" {
+		name := envOr("OIDC_PROVIDER_NAME", "oidc")
+		cfg := providerConfig("OIDC", name, strings.Fields(envOr("OIDC_SCOPES", "openid email profile")))
+		if cfg == nil {
+			log.Println(" OIDC_CLIENT_ID or OIDC_CLIENT_SECRET not set; OIDC login will not work.")
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		p, err := discoverOIDCProvider(ctx, name, discoveryURL, cfg)
+		if err != nil {
+			log.Printf(" %v; OIDC login will not work.", err)
+			return
+		}
+		oauthProviders[name] = p
 	}
 }
 
@@ -50,12 +251,125 @@ func generateState() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-var oauthState string
+// OAuth login flow cookie. It carries the state and PKCE verifier of one
+// browser's login attempt, signed so the browser cannot alter it.
+const (
+	oauthFlowCookieName = "g6_oauth"
+	oauthFlowTTL        = 10 * time.Minute
+	oauthFlowPurpose    = "oauth-flow"
+)
+
+// oauthFlow is the per-browser state of an in-progress OAuth login.
+type oauthFlow struct {
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Verifier   string `json:"verifier"`
+	ReturnTo   string `json:"return_to"`
+	LinkUserID int    `json:"link_user_id,omitempty"` // set when linking to a logged-in account
+}
+
+// sanitizeReturnTo keeps return_to only if it is a local path, which prevents
+// the login flow from being used as an open redirect. Browsers drop tabs and
+// newlines and read backslashes as slashes, so "/\t/evil.example" would
+// otherwise become the protocol-relative "//evil.example".
+func sanitizeReturnTo(returnTo string) string {
+	const fallback = "/dashboard"
+	for _, c := range returnTo {
+		if c < 0x20 || c == 0x7f || c == '\\' {
+			return fallback
+		}
+	}
+	u, err := url.Parse(returnTo)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil {
+		return fallback
+	}
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+		return fallback
+	}
+	return returnTo
+}
+
+// setOAuthFlowCookie stores flow in a signed, short-lived cookie scoped to /auth/.
+func setOAuthFlowCookie(w http.ResponseWriter, flow oauthFlow) error {
+	value, err := signPayload(oauthFlowPurpose, flow, oauthFlowTTL)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthFlowCookieName,
+		Value:    value,
+		Path:     "/auth/",
+		MaxAge:   int(oauthFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   sessionCookieSecure(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
 
-// /auth/google/login
-func handleGoogleLogin(w http.ResponseWriter, r *http.Request) {
-	if googleOAuthConfig == nil || googleOAuthConfig.ClientID == "" {
-		http.Error(w, "Google OAuth not configured", http.StatusInternalServerError)
+// popOAuthFlowCookie reads and clears the flow cookie. A flow can be used once.
+func popOAuthFlowCookie(w http.ResponseWriter, r *http.Request) (*oauthFlow, error) {
+	cookie, err := r.Cookie(oauthFlowCookieName)
+	if err != nil {
+		return nil, errors.New("login session not found; please start again")
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthFlowCookieName,
+		Value:    "",
+		Path:     "/auth/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   sessionCookieSecure(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	var flow oauthFlow
+	if err := verifyPayload(oauthFlowPurpose, cookie.Value, &flow); err != nil {
+		return nil, errors.New("login session expired or invalid; please start again")
+	}
+	return &flow, nil
+}
+
+// exchangeIdentity trades an authorization code for the provider's account,
+// proving possession of the PKCE verifier.
+func exchangeIdentity(ctx context.Context, provider OAuthProvider, code, verifier string) (*ExternalIdentity, error) {
+	token, err := provider.Config().Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+	id, err := provider.Identity(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+	return id, nil
+}
+
+// ======== HTTP Handlers ========
+
+// handleOAuthProviders serves GET /api/auth/providers and lists the
+// configured login providers, so the login page can offer a button for each.
+func handleOAuthProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	names := make([]string, 0, len(oauthProviders))
+	for name := range oauthProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string][]string{"providers": names})
+}
+
+// /auth/{provider}/login
+//
+// Optional query parameter return_to names the local page to open after
+// login. With link=1, a logged-in user links the provider account to their
+// own account instead of logging in.
+func handleOAuthLogin(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	provider, ok := oauthProviders[name]
+	if !ok {
+		http.Error(w, "unknown or unconfigured login provider "+strconv.Quote(name), http.StatusNotFound)
 		return
 	}
 
@@ -64,25 +378,54 @@ func handleGoogleLogin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to generate state", http.StatusInternalServerError)
 		return
 	}
-	oauthState = state // NOTE: for real prod, use per-user state with cookies
+	flow := oauthFlow{
+		Provider: name,
+		State:    state,
+		Verifier: oauth2.GenerateVerifier(),
+		ReturnTo: sanitizeReturnTo(r.URL.Query().Get("return_to")),
+	}
+	if r.URL.Query().Get("link") == "1" {
+		userID, ok := requestUserID(r)
+		if !ok || !isSessionRequest(r) {
+			http.Error(w, "log in before linking another account", http.StatusUnauthorized)
+			return
+		}
+		flow.LinkUserID = userID
+	}
+	if err := setOAuthFlowCookie(w, flow); err != nil {
+		http.Error(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
 
-	url := googleOAuthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
+	url := provider.Config().AuthCodeURL(state, oauth2.S256ChallengeOption(flow.Verifier))
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
-// /auth/google/callback
-func handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
-	// Check for errors from Google OAuth
+// /auth/{provider}/callback
+func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+
+	// Check for errors from the provider
 	if errMsg := r.FormValue("error"); errMsg != "" {
-		log.Printf("OAuth error: %s", errMsg)
-		http.Error(w, "OAuth error: "+errMsg+". Make sure your redirect URI is authorized in Google Cloud Console.", http.StatusBadRequest)
+		log.Printf("OAuth error from %s: %s", name, errMsg)
+		http.Error(w, "OAuth error: "+errMsg+". Make sure your redirect URI is authorized with the provider.", http.StatusBadRequest)
 		return
 	}
 
-	if r.FormValue("state") != oauthState {
+	flow, err := popOAuthFlowCookie(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if flow.Provider != name || subtle.ConstantTimeCompare([]byte(r.FormValue("state")), []byte(flow.State)) != 1 {
 		http.Error(w, "invalid oauth state", http.StatusBadRequest)
 		return
 	}
+	provider, ok := oauthProviders[name]
+	if !ok {
+		http.Error(w, "unknown or unconfigured login provider "+strconv.Quote(name), http.StatusNotFound)
+		return
+	}
 
 	code := r.FormValue("code")
 	if code == "" {
@@ -90,52 +433,63 @@ func handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := googleOAuthConfig.Exchange(context.Background(), code)
+	identity, err := exchangeIdentity(r.Context(), provider, code, flow.Verifier)
 	if err != nil {
-		http.Error(w, "failed to exchange token: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Use  token to get user info
-	client := googleOAuthConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
-	if err != nil {
-		http.Error(w, "failed to get user info: "+err.Error(), http.StatusInternalServerError)
+	// Linking: attach the provider account to the user who started the flow,
+	// provided they are still the one logged in.
+	if flow.LinkUserID != 0 {
+		if userID, ok := requestUserID(r); !ok || userID != flow.LinkUserID {
+			http.Error(w, "log in before linking another account", http.StatusUnauthorized)
+			return
+		}
+		if err := linkIdentity(flow.LinkUserID, identity); err != nil {
+			writeIdentityPageError(w, err)
+			return
+		}
+		http.Redirect(w, r, flow.ReturnTo, http.StatusSeeOther)
 		return
 	}
-	defer resp.Body.Close()
-
-	var userInfo struct {
-		ID            string `json:"id"`
-		Email         string `json:"email"`
-		VerifiedEmail bool   `json:"verified_email"`
-		Name          string `json:"name"`
-		GivenName     string `json:"given_name"`
-		FamilyName    string `json:"family_name"`
-		Picture       string `json:"picture"`
-	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		http.Error(w, "failed to parse user info: "+err.Error(), http.StatusInternalServerError)
+	appUser, err := loginWithIdentity(identity)
+	if err != nil {
+		writeIdentityPageError(w, err)
 		return
 	}
 
-	// Map Google user to our DB user
-	// If user exists, return it; if not, create it
-	appUser, err := getOrCreateOAuthUser(userInfo.GivenName, userInfo.FamilyName, userInfo.Email, userInfo.Picture)
+	// Provider logins do not skip two-factor authentication: the login page
+	// asks for the code and finishes through /api/auth/login/2fa.
+	enabled, err := twoFactorEnabled(appUser.ID)
 	if err != nil {
-		http.Error(w, "failed to save user: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "failed to check two-factor authentication: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		challenge, err := issueTwoFactorChallenge(appUser)
+		if err != nil {
+			http.Error(w, "failed to start two-factor login", http.StatusInternalServerError)
+			return
+		}
+		q := url.Values{"challenge": {challenge}, "return_to": {flow.ReturnTo}}
+		http.Redirect(w, r, "/login?"+q.Encode(), http.StatusSeeOther)
 		return
 	}
 
-	
+	if err := startSession(w, r, appUser.ID); err != nil {
+		http.Error(w, "failed to start session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	type tmplData struct {
 		UserJSON template.JS
+		ReturnTo string
 	}
 
 	userJSONBytes, _ := json.Marshal(appUser)
-	data := tmplData{UserJSON: template.JS(userJSONBytes)}
+	data := tmplData{UserJSON: template.JS(userJSONBytes), ReturnTo: flow.ReturnTo}
 
 	const page = `
 <!doctype html>
@@ -146,8 +500,8 @@ func handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
       // Set the "user" in localStorage like the normal login flow does
       const user = {{ .UserJSON }};
       localStorage.setItem('user', JSON.stringify(user));
-      // Redirect to dashboard
-      window.location.href = '/dashboard';
+      // Redirect to the page that started the login (the dashboard by default)
+      window.location.href = {{ .ReturnTo }};
     </script>
   </body>
 </html>`
@@ -158,3 +512,16 @@ func handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// writeIdentityPageError reports a login or linking failure to the browser.
+func writeIdentityPageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errIdentityTaken), errors.Is(err, errIdentityEmailInUse),
+		errors.Is(err, errIdentityUnverified), errors.Is(err, errIdentityProviderLinked):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errIdentityNoEmail):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "failed to save user: "+err.Error(), http.StatusInternalServerError)
+	}
+}
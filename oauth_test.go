@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// TestSanitizeReturnTo verifies that only local paths survive as redirect targets.
+func TestSanitizeReturnTo(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"":                     "/dashboard",
+		"/resources?tags=1":    "/resources?tags=1",
+		"https://evil.example": "/dashboard",
+		"//evil.example/path":  "/dashboard",
+		"/\\evil.example":      "/dashboard",
+		"/ok\r\nSet-Cookie: x": "/dashboard",
+		"/\t/evil.example":     "/dashboard",
+		"/\x00/evil.example":   "/dashboard",
+		"/ok\x7f":              "/dashboard",
+		"/%09/ok":              "/%09/ok",
+		"dashboard":            "/dashboard",
+		"javascript:alert(1)":  "/dashboard",
+		"/journal#entry-3":     "/journal#entry-3",
+	}
+	for in, expected := range tests {
+		if got := sanitizeReturnTo(in); got != expected {
+			t.Errorf("sanitizeReturnTo(%q) observed = %q, expected: %q", in, got, expected)
+		}
+	}
+}
+
+// TestOAuthCallbackValidatesState verifies that the callback only accepts the
+// state issued to the same browser for the same provider.
+func TestOAuthCallbackValidatesState(t *testing.T) {
+	t.Parallel()
+	cookie, err := signPayload(oauthFlowPurpose, oauthFlow{Provider: "google", State: "mine", Verifier: "v", ReturnTo: "/dashboard"}, oauthFlowTTL)
+	if err != nil {
+		t.Fatalf("signPayload() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		state    string
+		cookie   string
+	}{
+		{"No flow cookie", "google", "mine", ""},
+		{"State issued to another browser", "google", "theirs", cookie},
+		{"Forged flow cookie", "google", "mine", "e30.forged"},
+		{"Flow started for another provider", "github", "mine", cookie},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/auth/"+tt.provider+"/callback?code=abc&state="+tt.state, nil)
+			req.SetPathValue("provider", tt.provider)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oauthFlowCookieName, Value: tt.cookie})
+			}
+			rr := httptest.NewRecorder()
+			handleOAuthCallback(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, observed: %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+// newMockOIDCServer serves discovery, token and userinfo endpoints. The token
+// endpoint only accepts code "good-code" with the verifier matching the PKCE
+// challenge sent to the authorization endpoint.
+func newMockOIDCServer(t *testing.T, challenge *string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                srv.URL,
+			AuthorizationEndpoint: srv.URL + "/authorize",
+			TokenEndpoint:         srv.URL + "/token",
+			UserinfoEndpoint:      srv.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != *challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"mock-access","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer mock-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"sub":"user-42","email":"ada@example.com","email_verified":"true","name":"Ada King Lovelace"}`))
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestOIDCLoginFlow runs the login flow against a mock OIDC issuer up to the
+// identity that would be logged in.
+func TestOIDCLoginFlow(t *testing.T) {
+	var challenge string
+	srv := newMockOIDCServer(t, &challenge)
+
+	provider, err := discoverOIDCProvider(context.Background(), "mock", srv.URL+"/.well-known/openid-configuration", &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/auth/mock/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	})
+	if err != nil {
+		t.Fatalf("discoverOIDCProvider() error = %v", err)
+	}
+	oauthProviders["mock"] = provider
+	defer delete(oauthProviders, "mock")
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/mock/login?return_to=/resources", nil)
+	req.SetPathValue("provider", "mock")
+	rr := httptest.NewRecorder()
+	handleOAuthLogin(rr, req)
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("Expected status %d, observed: %d", http.StatusTemporaryRedirect, rr.Code)
+	}
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil || location.Path != "/authorize" {
+		t.Fatalf("Expected redirect to the mock authorize endpoint, observed: %q", rr.Header().Get("Location"))
+	}
+	challenge = location.Query().Get("code_challenge")
+
+	flowReq := httptest.NewRequest(http.MethodGet, "/auth/mock/callback", nil)
+	for _, c := range rr.Result().Cookies() {
+		flowReq.AddCookie(c)
+	}
+	flow, err := popOAuthFlowCookie(httptest.NewRecorder(), flowReq)
+	if err != nil {
+		t.Fatalf("popOAuthFlowCookie() error = %v", err)
+	}
+	if flow.Provider != "mock" || flow.State != location.Query().Get("state") || flow.ReturnTo != "/resources" {
+		t.Errorf("Unexpected flow %+v for state %q", flow, location.Query().Get("state"))
+	}
+
+	if _, err := exchangeIdentity(context.Background(), provider, "good-code", oauth2.GenerateVerifier()); err == nil {
+		t.Errorf("Expected an error for a verifier that does not match the challenge")
+	}
+	id, err := exchangeIdentity(context.Background(), provider, "good-code", flow.Verifier)
+	if err != nil {
+		t.Fatalf("exchangeIdentity() error = %v", err)
+	}
+	expected := ExternalIdentity{Provider: "mock", Subject: "user-42", Email: "ada@example.com", EmailVerified: true, FName: "Ada", LName: "King Lovelace"}
+	if *id != expected {
+		t.Errorf("exchangeIdentity() observed = %+v, expected: %+v", *id, expected)
+	}
+}
+
+// TestGitHubIdentity verifies that the GitHub account ID and primary email are used.
+func TestGitHubIdentity(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":1234,"login":"octocat","name":""}`))
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"email":"old@example.com","primary":false,"verified":true},{"email":"cat@example.com","primary":true,"verified":false}]`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := &githubProvider{config: &oauth2.Config{}, apiBase: srv.URL}
+	id, err := p.Identity(context.Background(), &oauth2.Token{AccessToken: "x"})
+	if err != nil {
+		t.Fatalf("Identity() error = %v", err)
+	}
+	expected := ExternalIdentity{Provider: "github", Subject: "1234", Email: "cat@example.com", FName: "octocat"}
+	if *id != expected {
+		t.Errorf("Identity() observed = %+v, expected: %+v", *id, expected)
+	}
+}
+
+// TestLoginWithIdentityUnverifiedAccount verifies a provider login does not
+// link into an account someone signed up for without verifying its email,
+// which would hand them the verified account, while a verified account with
+// the same email is linked.
+func TestLoginWithIdentityUnverifiedAccount(t *testing.T) {
+	useTestDB(t)
+	squatted := createTestUser(t, "Mallory", "Squatter")
+	if _, err := db.Exec(
+		"UPDATE users SET email_verified_at = NULL, password_hash = 'attacker-hash' WHERE id = ?", squatted,
+	); err != nil {
+		t.Fatalf("unverifying test user: %v", err)
+	}
+	verified := createTestUser(t, "Ada", "Lovelace")
+	identity := func(userID int) *ExternalIdentity {
+		t.Helper()
+		id := &ExternalIdentity{Provider: "google", Subject: "subject-" + strconv.Itoa(userID), EmailVerified: true}
+		if err := db.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&id.Email); err != nil {
+			t.Fatalf("reading test user email: %v", err)
+		}
+		return id
+	}
+
+	if _, err := loginWithIdentity(identity(squatted)); err != errIdentityUnverified {
+		t.Errorf("loginWithIdentity(unverified account) observed error = %v, expected: %v", err, errIdentityUnverified)
+	}
+	var linked, emailVerified bool
+	var hash string
+	if err := db.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_id = u.id), u.email_verified_at IS NOT NULL, u.password_hash
+        FROM users u WHERE u.id = ?`, squatted,
+	).Scan(&linked, &emailVerified, &hash); err != nil {
+		t.Fatalf("reading unverified account: %v", err)
+	}
+	if linked || emailVerified || hash != "attacker-hash" {
+		t.Errorf("unverified account observed linked = %v, verified = %v, expected it untouched", linked, emailVerified)
+	}
+
+	user, err := loginWithIdentity(identity(verified))
+	if err != nil {
+		t.Fatalf("loginWithIdentity(verified account) observed error = %v", err)
+	}
+	if user.ID != verified {
+		t.Errorf("loginWithIdentity(verified account) observed user %d, expected: %d", user.ID, verified)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ======== Password Policy ========
+
+// bcryptMaxPasswordLen is the longest password bcrypt can hash.
+const bcryptMaxPasswordLen = 72
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var (
+	commonPasswordsOnce sync.Once
+	commonPasswords     map[string]bool
+)
+
+// isCommonPassword reports whether password is on the bundled list of
+// frequently used passwords, ignoring case.
+func isCommonPassword(password string) bool {
+	commonPasswordsOnce.Do(func() {
+		commonPasswords = map[string]bool{}
+		for _, line := range strings.Split(commonPasswordsFile, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				commonPasswords[strings.ToLower(line)] = true
+			}
+		}
+	})
+	return commonPasswords[strings.ToLower(password)]
+}
+
+// PasswordPolicy describes which new passwords are accepted.
+type PasswordPolicy struct {
+	MinLength    int
+	RejectCommon bool
+}
+
+// passwordPolicy reads PASSWORD_MIN_LENGTH (default 8) and
+// PASSWORD_REJECT_COMMON (default true).
+func passwordPolicy() PasswordPolicy {
+	p := PasswordPolicy{MinLength: 8, RejectCommon: envOr("PASSWORD_REJECT_COMMON", "true") != "false"}
+	if n, err := strconv.Atoi(envOr("PASSWORD_MIN_LENGTH", "")); err == nil && n > 0 {
+		p.MinLength = min(n, bcryptMaxPasswordLen)
+	}
+	return p
+}
+
+// Validate returns a user-facing error if password does not satisfy p.
+func (p PasswordPolicy) Validate(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if len(password) > bcryptMaxPasswordLen {
+		return fmt.Errorf("password must be at most %d bytes long", bcryptMaxPasswordLen)
+	}
+	if p.RejectCommon && isCommonPassword(password) {
+		return errors.New("this password is too common; please choose another")
+	}
+	return nil
+}
+
+// validateNewPassword checks password against the configured policy.
+func validateNewPassword(password string) error {
+	return passwordPolicy().Validate(password)
+}
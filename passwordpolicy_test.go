@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPasswordPolicyValidate verifies length limits and the common-password list.
+func TestPasswordPolicyValidate(t *testing.T) {
+	t.Parallel()
+	policy := PasswordPolicy{MinLength: 8, RejectCommon: true}
+	tests := []struct {
+		password string
+		valid    bool
+	}{
+		{"a", false},
+		{"Tr0ub4d", false},
+		{"Password123", false}, // common, regardless of case
+		{"QWERTYUIOP", false},
+		{strings.Repeat("x", 73), false},
+		{"Tr0ub4dor&3", true},
+		{"correct horse battery staple", true},
+	}
+	for _, tt := range tests {
+		if err := policy.Validate(tt.password); (err == nil) != tt.valid {
+			t.Errorf("Validate(%q) observed error = %v, expected valid: %v", tt.password, err, tt.valid)
+		}
+	}
+
+	if err := (PasswordPolicy{MinLength: 8}).Validate("password"); err != nil {
+		t.Errorf("Validate() with RejectCommon off observed error = %v, expected: nil", err)
+	}
+}
+
+// TestHandleSignupRejectsWeakPassword verifies the policy runs before any account is created.
+func TestHandleSignupRejectsWeakPassword(t *testing.T) {
+	t.Parallel()
+	body := `{"fName":"Ada","lName":"Lovelace","email":"ada@example.com","password":"x"}`
+	rr := httptest.NewRecorder()
+	handleSignup(rr, httptest.NewRequest(http.MethodPost, "/api/auth/signup", strings.NewReader(body)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, observed: %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ======== Password Reset ========
+
+const (
+	passwordResetTTL = time.Hour
+	// passwordResetCooldown limits how often reset mail goes to one account.
+	passwordResetCooldown = time.Minute
+)
+
+// ForgotPasswordRequest is the JSON payload for POST /api/auth/forgot.
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest is the JSON payload for POST /api/auth/reset.
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+var errResetTokenInvalid = errors.New("invalid or expired reset link")
+
+// ======== DB Functions ========
+
+// createPasswordReset issues a reset token for userID and returns it. Earlier
+// unused tokens of the user stop working. It returns "" without error when a
+// token was issued within passwordResetCooldown.
+func createPasswordReset(userID int) (string, error) {
+	var recent int
+	if err := db.QueryRow(
+		"SELECT COUNT(*) FROM password_resets WHERE user_id = ? AND created_at > ?",
+		userID, time.Now().UTC().Add(-passwordResetCooldown),
+	).Scan(&recent); err != nil {
+		return "", err
+	}
+	if recent > 0 {
+		return "", nil
+	}
+
+	token, err := newSessionToken()
+	if err != nil {
+		return "", err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(
+		"UPDATE password_resets SET used_at = UTC_TIMESTAMP() WHERE user_id = ? AND used_at IS NULL",
+		userID,
+	); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO password_resets (user_id, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		userID, hashSessionToken(token), time.Now().UTC(), time.Now().UTC().Add(passwordResetTTL),
+	); err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// resetPassword consumes a reset token, sets the new password, ends every
+// session of the user and revokes their API tokens, so neither a stolen
+// session nor a stolen token survives the reset.
+func resetPassword(token, password string) error {
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var resetID, userID int
+	err = tx.QueryRow(`
+        SELECT id, user_id FROM password_resets
+        WHERE token_hash = ? AND used_at IS NULL AND expires_at > UTC_TIMESTAMP()
+        FOR UPDATE
+    `, hashSessionToken(token)).Scan(&resetID, &userID)
+	if err == sql.ErrNoRows {
+		return errResetTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE password_resets SET used_at = UTC_TIMESTAMP() WHERE id = ?", resetID); err != nil {
+		return err
+	}
+	// Following the emailed link also proves ownership of the address.
+	if _, err := tx.Exec(
+		"UPDATE users SET password_hash = ?, email_verified_at = COALESCE(email_verified_at, UTC_TIMESTAMP()) WHERE id = ?",
+		hashed, userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	// Whoever made the reset necessary may also hold a bearer token.
+	if _, err := tx.Exec(
+		"UPDATE api_tokens SET revoked_at = UTC_TIMESTAMP() WHERE user_id = ? AND revoked_at IS NULL", userID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// passwordResetMail builds the reset email for token.
+func passwordResetMail(to, fName, token string) Mail {
+	link := appBaseURL() + "/reset-password?token=" + url.QueryEscape(token)
+	return Mail{
+		To:      to,
+		Subject: "Reset your G6Labs password",
+		Body: "Hi " + fName + ",\n\n" +
+			"Someone asked to reset the password of your G6Labs account. Open this link within an hour to choose a new one:\n\n" +
+			link + "\n\n" +
+			"If you did not ask for this, ignore this email; your password stays the same.\n",
+	}
+}
+
+// ======== HTTP Handlers ========
+
+// handleForgotPassword serves POST /api/auth/forgot and mails a reset link.
+//
+// The response is the same whether or not the email belongs to an account,
+// so the endpoint cannot be used to find registered addresses.
+func handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, AuthResponse{Success: false, Message: "use POST"})
+		return
+	}
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: "invalid JSON"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: "email is required"})
+		return
+	}
+
+	user, err := getUserByEmail(req.Email)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to start password reset"})
+		return
+	default:
+		token, err := createPasswordReset(user.ID)
+		if err != nil {
+			log.Printf("failed to create password reset for user %d: %v", user.ID, err)
+			writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to start password reset"})
+			return
+		}
+		if token != "" {
+			sendMailAsync(passwordResetMail(user.Email, user.FName, token))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "if an account exists for this email, a reset link is on its way",
+	})
+}
+
+// handleResetPassword serves POST /api/auth/reset and sets a new password
+// from a reset link token. All of the user's sessions are logged out and
+// API tokens revoked.
+func handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, AuthResponse{Success: false, Message: "use POST"})
+		return
+	}
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: "invalid JSON"})
+		return
+	}
+	if strings.TrimSpace(req.Token) == "" {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: errResetTokenInvalid.Error()})
+		return
+	}
+	if err := validateNewPassword(req.Password); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	if err := resetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, errResetTokenInvalid) {
+			writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to reset password"})
+		return
+	}
+	clearSessionCookie(w)
+	writeJSON(w, http.StatusOK, AuthResponse{Success: true, Message: "password updated; please log in"})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestPasswordResetMail verifies that the reset link carries the token.
+func TestPasswordResetMail(t *testing.T) {
+	t.Parallel()
+	msg := passwordResetMail("ada@example.com", "Ada", "abc-_123")
+	if msg.To != "ada@example.com" {
+		t.Errorf("To observed = %q, expected: %q", msg.To, "ada@example.com")
+	}
+	if !strings.Contains(msg.Body, appBaseURL()+"/reset-password?token=abc-_123") {
+		t.Errorf("Expected the reset link in the body, observed: %q", msg.Body)
+	}
+}
+
+// TestHandleResetPasswordValidation verifies that malformed resets are
+// rejected before any token lookup.
+func TestHandleResetPasswordValidation(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"Invalid JSON", `{"token":`},
+		{"Missing token", `{"password":"Secret123"}`},
+		{"Missing password", `{"token":"abc"}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			handleResetPassword(rr, httptest.NewRequest(http.MethodPost, "/api/auth/reset", strings.NewReader(tt.body)))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, observed: %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+// TestResetPasswordRevokesAPITokens verifies a reset leaves no bearer token
+// usable, as it leaves no session.
+func TestResetPasswordRevokesAPITokens(t *testing.T) {
+	useTestDB(t)
+	userID := createTestUser(t, "Ada", "Lovelace")
+	token, err := createAPIToken(userID, CreateAPITokenRequest{Name: "script", Scopes: []string{ScopeMatrixRead}})
+	if err != nil {
+		t.Fatalf("createAPIToken observed error = %v", err)
+	}
+	reset, err := createPasswordReset(userID)
+	if err != nil {
+		t.Fatalf("createPasswordReset observed error = %v", err)
+	}
+	if err := resetPassword(reset, "correct horse battery staple"); err != nil {
+		t.Fatalf("resetPassword observed error = %v", err)
+	}
+	if _, err := getAPITokenAuth(token.Token); err == nil {
+		t.Errorf("getAPITokenAuth after a reset observed no error, expected the token to be revoked")
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ======== User Preferences ========
+
+// UserPreferences are the dashboard settings of a user. Users without a
+// user_preferences row get defaultPreferences.
+type UserPreferences struct {
+	EmailNotifications bool `json:"email_notifications"` // mail about activity such as friend requests
+	Updates            bool `json:"updates"`             // product update mail
+	Newsletter         bool `json:"newsletter"`
+	StreakReminders    bool `json:"streak_reminders"` // mail when a streak is about to end
+	Mute               bool `json:"mute"`
+	StaySignedIn       bool `json:"stay_signed_in"` // long-lived sessions that survive closing the browser
+	SmoothAnimations   bool `json:"smooth_animations"`
+	FocusMode          bool `json:"focus_mode"`
+}
+
+// defaultPreferences match the column defaults of user_preferences.
+var defaultPreferences = UserPreferences{
+	EmailNotifications: true,
+	Updates:            true,
+	Newsletter:         false,
+	StreakReminders:    true,
+	Mute:               false,
+	StaySignedIn:       true,
+	SmoothAnimations:   true,
+	FocusMode:          false,
+}
+
+// shortSessionTTL is the lifetime of sessions of users who turned off
+// "Stay Signed In". Their cookie also ends with the browser session.
+const shortSessionTTL = 12 * time.Hour
+
+// Mail topics users can opt out of. Account mail such as verification links,
+// password resets and security notices is always sent.
+const (
+	MailTopicNotifications = "notifications"
+	MailTopicUpdates       = "updates"
+	MailTopicNewsletter    = "newsletter"
+	MailTopicStreak        = "streak"
+)
+
+// allowsMail reports whether p opts in to mail about topic.
+func (p UserPreferences) allowsMail(topic string) bool {
+	switch topic {
+	case MailTopicNotifications:
+		return p.EmailNotifications
+	case MailTopicUpdates:
+		return p.Updates
+	case MailTopicNewsletter:
+		return p.Newsletter
+	case MailTopicStreak:
+		return p.StreakReminders
+	default:
+		return false
+	}
+}
+
+// preferenceFields lists the JSON names of every preference, in order.
+var preferenceFields = func() []string {
+	t := reflect.TypeOf(UserPreferences{})
+	fields := make([]string, t.NumField())
+	for i := range fields {
+		fields[i] = t.Field(i).Tag.Get("json")
+	}
+	return fields
+}()
+
+// parsePreferences decodes a complete set of preferences. Every field must be
+// present and boolean, and unknown fields are rejected, so a typo cannot
+// silently reset a setting.
+func parsePreferences(body []byte) (UserPreferences, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return UserPreferences{}, errors.New("invalid JSON")
+	}
+	for _, name := range preferenceFields {
+		value, ok := raw[name]
+		if !ok {
+			return UserPreferences{}, fmt.Errorf("missing preference %q", name)
+		}
+		if string(value) == "null" {
+			return UserPreferences{}, fmt.Errorf("preference %q must be true or false", name)
+		}
+	}
+
+	var prefs UserPreferences
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&prefs); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return UserPreferences{}, fmt.Errorf("preference %q must be true or false", typeErr.Field)
+		}
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return UserPreferences{}, fmt.Errorf("unknown preference %s", name)
+		}
+		return UserPreferences{}, errors.New("invalid JSON")
+	}
+	return prefs, nil
+}
+
+// ======== DB Functions ========
+
+// getPreferences returns the preferences of userID.
+func getPreferences(userID int) (UserPreferences, error) {
+	p := defaultPreferences
+	err := db.QueryRow(`
+        SELECT email_notifications, updates, newsletter, streak_reminders,
+               mute, stay_signed_in, smooth_animations, focus_mode
+        FROM user_preferences WHERE user_id = ?
+    `, userID).Scan(&p.EmailNotifications, &p.Updates, &p.Newsletter, &p.StreakReminders,
+		&p.Mute, &p.StaySignedIn, &p.SmoothAnimations, &p.FocusMode)
+	if err == sql.ErrNoRows {
+		return defaultPreferences, nil
+	}
+	return p, err
+}
+
+// savePreferences stores p for userID.
+func savePreferences(userID int, p UserPreferences) error {
+	_, err := db.Exec(`
+        INSERT INTO user_preferences (user_id, email_notifications, updates, newsletter, streak_reminders,
+                                      mute, stay_signed_in, smooth_animations, focus_mode)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            email_notifications = VALUES(email_notifications), updates = VALUES(updates),
+            newsletter = VALUES(newsletter), streak_reminders = VALUES(streak_reminders),
+            mute = VALUES(mute), stay_signed_in = VALUES(stay_signed_in),
+            smooth_animations = VALUES(smooth_animations), focus_mode = VALUES(focus_mode)
+    `, userID, p.EmailNotifications, p.Updates, p.Newsletter, p.StreakReminders,
+		p.Mute, p.StaySignedIn, p.SmoothAnimations, p.FocusMode)
+	return err
+}
+
+// sessionLifetime returns how long a new session of userID lasts and whether
+// its cookie persists after the browser closes, following "Stay Signed In".
+// If the preference cannot be read the default long session is used.
+func sessionLifetime(userID int) (time.Duration, bool) {
+	p, err := getPreferences(userID)
+	if err != nil {
+		log.Printf("failed to load preferences of user %d: %v", userID, err)
+		return sessionTTL, true
+	}
+	if !p.StaySignedIn {
+		return shortSessionTTL, false
+	}
+	return sessionTTL, true
+}
+
+// sendUserMail mails userID the message built by build, if they verified
+// their email and their preferences allow topic.
+func sendUserMail(userID int, topic string, build func(recipient *User) Mail) {
+	if db == nil {
+		return
+	}
+	recipient := &User{ID: userID}
+	if err := db.QueryRow(
+		"SELECT first_name, last_name, email, email_verified_at IS NOT NULL FROM users WHERE id = ?", userID,
+	).Scan(&recipient.FName, &recipient.LName, &recipient.Email, &recipient.EmailVerified); err != nil {
+		log.Printf("failed to load mail recipient %d: %v", userID, err)
+		return
+	}
+	if !recipient.EmailVerified {
+		return
+	}
+	prefs, err := getPreferences(userID)
+	if err != nil {
+		log.Printf("failed to load preferences of user %d: %v", userID, err)
+		return
+	}
+	if !prefs.allowsMail(topic) {
+		return
+	}
+	sendMailAsync(build(recipient))
+}
+
+// ======== Streak Reminders ========
+
+// streakReminderMail reminds user that their streak ends tonight.
+func streakReminderMail(user *User, streak int) Mail {
+	return Mail{
+		To:      user.Email,
+		Subject: fmt.Sprintf("Keep your %d-day G6Labs streak going", streak),
+		Body: "Hi " + user.FName + ",\n\n" +
+			fmt.Sprintf("You have practiced %d days in a row. Solve a problem or take a quiz today to keep your streak:\n\n", streak) +
+			appBaseURL() + "/dashboard\n\n" +
+			"You can turn off streak reminders in the dashboard settings.\n",
+	}
+}
+
+// streakReminderHour is the UTC hour from which streak reminders go out,
+// leaving most of the day to keep the streak without a nudge.
+const streakReminderHour = 18
+
+// sendStreakReminders mails every user whose streak ends today unless they
+// are active, at most once per day. Users who opted out are skipped through
+// sendUserMail. A failure for one user is logged and does not hold up the
+// others.
+func sendStreakReminders(now time.Time) error {
+	if now.Hour() < streakReminderHour {
+		return nil
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	userIDs, err := queryIDs(`
+        SELECT a.user_id FROM activity_events a
+        LEFT JOIN user_preferences p ON p.user_id = a.user_id
+        WHERE a.created_at >= ?
+        AND COALESCE(p.streak_reminders, TRUE)
+        AND (p.streak_reminded_on IS NULL OR p.streak_reminded_on < ?)
+        GROUP BY a.user_id
+        HAVING MAX(a.created_at) < ?
+    `, today.AddDate(0, 0, -1), today, today)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		// Claim the reminder first so a crash never sends it twice.
+		if _, err := db.Exec(`
+            INSERT INTO user_preferences (user_id, streak_reminded_on) VALUES (?, ?)
+            ON DUPLICATE KEY UPDATE streak_reminded_on = VALUES(streak_reminded_on)
+        `, userID, today); err != nil {
+			log.Printf("failed to claim streak reminder for user %d: %v", userID, err)
+			continue
+		}
+		stats, err := getActivityStats(userID)
+		if err != nil {
+			log.Printf("failed to load streak of user %d: %v", userID, err)
+			continue
+		}
+		if stats.Streak < 2 {
+			continue
+		}
+		sendUserMail(userID, MailTopicStreak, func(recipient *User) Mail {
+			return streakReminderMail(recipient, stats.Streak)
+		})
+	}
+	return nil
+}
+
+// startStreakReminders checks for streaks about to end every interval until
+// the process exits.
+func startStreakReminders(interval time.Duration) {
+	go func() {
+		for {
+			if err := sendStreakReminders(time.Now().UTC()); err != nil {
+				log.Printf("failed to send streak reminders: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// ======== HTTP Handlers ========
+
+// handlePreferences serves GET and PUT /api/me/preferences. PUT replaces the
+// whole set; new "Stay Signed In" values apply from the next login.
+func handlePreferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or PUT"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		prefs, err := getPreferences(userID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, prefs)
+		return
+	}
+
+	defer r.Body.Close()
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(http.MaxBytesReader(w, r.Body, 4096)); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	prefs, err := parsePreferences(body.Bytes())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := savePreferences(userID, prefs); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParsePreferences verifies that only complete, boolean preference sets
+// are accepted.
+func TestParsePreferences(t *testing.T) {
+	t.Parallel()
+	complete, _ := json.Marshal(defaultPreferences)
+	with := func(field, value string) string {
+		var m map[string]json.RawMessage
+		json.Unmarshal(complete, &m)
+		m[field] = json.RawMessage(value)
+		b, _ := json.Marshal(m)
+		return string(b)
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"Complete", string(complete), ""},
+		{"Changed value", with("stay_signed_in", "false"), ""},
+		{"Not JSON", "nope", "invalid JSON"},
+		{"Missing field", `{"email_notifications":true}`, `missing preference "updates"`},
+		{"String value", with("mute", `"yes"`), `preference "mute" must be true or false`},
+		{"Null value", with("updates", "null"), `preference "updates" must be true or false`},
+		{"Unknown field", strings.TrimSuffix(string(complete), "}") + `,"dark_mode":true}`, `unknown preference "dark_mode"`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := parsePreferences([]byte(tt.body))
+			observed := ""
+			if err != nil {
+				observed = err.Error()
+			}
+			if observed != tt.wantErr {
+				t.Errorf("parsePreferences() observed error = %q, expected: %q", observed, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestPreferenceFieldsCoverStruct verifies every preference is required by PUT.
+func TestPreferenceFieldsCoverStruct(t *testing.T) {
+	t.Parallel()
+	var m map[string]bool
+	b, _ := json.Marshal(defaultPreferences)
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(preferenceFields) != len(m) {
+		t.Fatalf("preferenceFields observed = %v, expected %d fields", preferenceFields, len(m))
+	}
+	for _, name := range preferenceFields {
+		if _, ok := m[name]; !ok {
+			t.Errorf("preferenceFields has %q, which is not a JSON field", name)
+		}
+	}
+}
+
+// TestAllowsMail verifies each mail topic follows its own flag.
+func TestAllowsMail(t *testing.T) {
+	t.Parallel()
+	p := UserPreferences{EmailNotifications: true, StreakReminders: false, Newsletter: true}
+	tests := map[string]bool{
+		MailTopicNotifications: true,
+		MailTopicUpdates:       false,
+		MailTopicNewsletter:    true,
+		MailTopicStreak:        false,
+		"unknown":              false,
+	}
+	for topic, expected := range tests {
+		if observed := p.allowsMail(topic); observed != expected {
+			t.Errorf("allowsMail(%q) observed = %v, expected: %v", topic, observed, expected)
+		}
+	}
+}
+
+// TestHandlePreferencesRequiresLogin verifies anonymous requests get 401.
+func TestHandlePreferencesRequiresLogin(t *testing.T) {
+	t.Parallel()
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		rr := httptest.NewRecorder()
+		handlePreferences(rr, httptest.NewRequest(method, "/api/me/preferences", strings.NewReader("{}")))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status %d, observed: %d", method, http.StatusUnauthorized, rr.Code)
+		}
+	}
+}
+
+// TestSendStreakRemindersWaitsForEvening verifies no reminders go out before
+// streakReminderHour, when the streak can still easily be kept.
+func TestSendStreakRemindersWaitsForEvening(t *testing.T) {
+	t.Parallel()
+	morning := time.Date(2025, 3, 10, streakReminderHour-1, 59, 0, 0, time.UTC)
+	// With no database, anything past the hour check would panic.
+	if err := sendStreakReminders(morning); err != nil {
+		t.Errorf("sendStreakReminders() observed error = %v, expected: nil", err)
+	}
+}
+
+// TestStreakReminderMail verifies the reminder names the streak length.
+func TestStreakReminderMail(t *testing.T) {
+	t.Parallel()
+	msg := streakReminderMail(&User{FName: "Ada", Email: "ada@example.com"}, 12)
+	if msg.To != "ada@example.com" || !strings.Contains(msg.Subject, "12-day") {
+		t.Errorf("streakReminderMail() observed = %+v, expected a 12-day reminder to ada@example.com", msg)
+	}
+}
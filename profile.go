@@ -0,0 +1,492 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== Profile Management ========
+
+const (
+	emailChangePurpose = "email-change"
+	emailChangeTTL     = 24 * time.Hour
+	maxNameLength      = 100 // users.first_name and last_name
+)
+
+// profileAvatars are the avatars offered by the dashboard.
+var profileAvatars = map[string]bool{"avatar1": true, "avatar2": true, "avatar3": true}
+
+// ProfileUpdateRequest is the JSON payload for PATCH /api/me. Omitted fields
+// keep their current value.
+type ProfileUpdateRequest struct {
+	FName  *string `json:"fName"`
+	LName  *string `json:"lName"`
+	Avatar *string `json:"avatar"`
+}
+
+// EmailChangeRequest is the JSON payload for POST /api/me/email.
+type EmailChangeRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// PasswordChangeRequest is the JSON payload for POST /api/me/password.
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// DeleteAccountRequest is the JSON payload for DELETE /api/me. Accounts with a
+// password confirm with it; accounts without one type their email instead.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Confirm  string `json:"confirm"`
+}
+
+// emailChangeClaim is the signed payload of an email change link. The old
+// address is bound so the link dies if the email changes in the meantime.
+type emailChangeClaim struct {
+	UserID   int    `json:"uid"`
+	OldEmail string `json:"old"`
+	NewEmail string `json:"new"`
+}
+
+var (
+	errWrongPassword  = errors.New("current password is incorrect")
+	errNoPassword     = errors.New("this account has no password; set one with POST /api/me/identities/password")
+	errEmailInUse     = errors.New("an account with this email already exists")
+	errEmailUnchanged = errors.New("this is already your email address")
+	errConfirmEmail   = errors.New("type your email address to confirm")
+)
+
+// throttledError is returned by checkCurrentPassword while the account or
+// address is throttled after failed password attempts.
+type throttledError struct {
+	retryAfter time.Duration
+}
+
+// seconds returns the wait in whole seconds, rounded up.
+func (e throttledError) seconds() int {
+	return int(math.Ceil(e.retryAfter.Seconds()))
+}
+
+func (e throttledError) Error() string {
+	return fmt.Sprintf("too many failed password attempts; try again in %d seconds", e.seconds())
+}
+
+// validateProfileUpdate trims the names of req and checks every field it sets.
+func validateProfileUpdate(req *ProfileUpdateRequest) error {
+	if req.FName == nil && req.LName == nil && req.Avatar == nil {
+		return errors.New("nothing to update")
+	}
+	for _, name := range []*string{req.FName, req.LName} {
+		if name == nil {
+			continue
+		}
+		*name = strings.TrimSpace(*name)
+		if *name == "" {
+			return errors.New("names cannot be empty")
+		}
+		if len([]rune(*name)) > maxNameLength {
+			return errors.New("names must be at most 100 characters")
+		}
+	}
+	if req.Avatar != nil && !profileAvatars[*req.Avatar] {
+		return errors.New("avatar must be one of avatar1, avatar2 or avatar3")
+	}
+	return nil
+}
+
+// normalizeNewEmail returns the bare address of email, or an error if it is
+// not a single valid address.
+func normalizeNewEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > 255 {
+		return "", errors.New("invalid email address")
+	}
+	return email, nil
+}
+
+// emailChangeMail builds the confirmation email sent to the new address.
+func emailChangeMail(claim emailChangeClaim, fName string) (Mail, error) {
+	token, err := signPayload(emailChangePurpose, claim, emailChangeTTL)
+	if err != nil {
+		return Mail{}, err
+	}
+	link := appBaseURL() + "/api/auth/verify/email-change?token=" + url.QueryEscape(token)
+	return Mail{
+		To:      claim.NewEmail,
+		Subject: "Confirm your new G6Labs email",
+		Body: "Hi " + fName + ",\n\n" +
+			"Open this link within 24 hours to use this address for your G6Labs account:\n\n" +
+			link + "\n\n" +
+			"If you did not ask for this, ignore this email; the account keeps its current address.\n",
+	}, nil
+}
+
+// emailChangedMail tells the old address that the account moved away from it.
+func emailChangedMail(claim emailChangeClaim, fName string) Mail {
+	return Mail{
+		To:      claim.OldEmail,
+		Subject: "Your G6Labs email was changed",
+		Body: "Hi " + fName + ",\n\n" +
+			"The email of your G6Labs account was changed to " + claim.NewEmail + ".\n\n" +
+			"If this was not you, reset your password right away and contact support.\n",
+	}
+}
+
+// ======== DB Functions ========
+
+// getPasswordHash returns the stored password hash of userID, or "" for
+// accounts created through a login provider.
+func getPasswordHash(userID int) (string, error) {
+	var hash sql.NullString
+	if err := db.QueryRow("SELECT password_hash FROM users WHERE id = ?", userID).Scan(&hash); err != nil {
+		return "", err
+	}
+	return hash.String, nil
+}
+
+// checkCurrentPassword verifies password against user's stored hash before
+// action (such as "change password") is carried out from ip. It shares the
+// login throttle and audit log, so a stolen session cannot be used to guess
+// the password faster than the login form allows.
+func checkCurrentPassword(user *User, password, ip, action string) error {
+	email := normalizeLoginEmail(user.Email)
+	// Throttle before checking the password, so guesses cost no bcrypt work
+	wait, err := loginRetryAfter(email, ip)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		throttled := throttledError{retryAfter: wait}
+		recordAuthEvent(AuthEventLoginBlocked, user.ID, email, ip, fmt.Sprintf("%s, retry_after=%ds", action, throttled.seconds()))
+		return throttled
+	}
+
+	hash, err := getPasswordHash(user.ID)
+	if err != nil {
+		return err
+	}
+	if hash == "" {
+		return errNoPassword
+	}
+	if !checkPasswordHash(password, hash) {
+		recordAuthEvent(AuthEventLoginFailed, user.ID, email, ip, "wrong current password, "+action)
+		return errWrongPassword
+	}
+	return nil
+}
+
+// updateProfile applies the fields set in req to userID.
+func updateProfile(userID int, req ProfileUpdateRequest) error {
+	_, err := db.Exec(`
+        UPDATE users SET
+            first_name = COALESCE(?, first_name),
+            last_name = COALESCE(?, last_name),
+            avatar = COALESCE(?, avatar)
+        WHERE id = ?
+    `, req.FName, req.LName, req.Avatar, userID)
+	return err
+}
+
+// emailTaken reports whether any account uses email.
+func emailTaken(email string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&n)
+	return n > 0, err
+}
+
+// applyEmailChange moves the account of claim to its new address and marks
+// it verified, since the link was opened from that mailbox.
+func applyEmailChange(claim emailChangeClaim) error {
+	taken, err := emailTaken(claim.NewEmail)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errEmailInUse
+	}
+	result, err := db.Exec(`
+        UPDATE users SET email = ?, email_verified_at = UTC_TIMESTAMP(), verification_sent_at = NULL
+        WHERE id = ? AND email = ?
+    `, claim.NewEmail, claim.UserID, claim.OldEmail)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return errEmailInUse
+		}
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errSignatureInvalid
+	}
+	return nil
+}
+
+// changePassword sets a new password for userID and ends every other session,
+// keeping the one identified by keepToken.
+func changePassword(userID int, password, keepToken string) error {
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", hashed, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"DELETE FROM sessions WHERE user_id = ? AND id <> ?",
+		userID, hashSessionToken(keepToken),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryIDs runs a query selecting one integer column.
+func queryIDs(query string, args ...any) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ======== HTTP Handlers ========
+
+// handleUpdateProfile serves PATCH /api/me, which edits names and avatar.
+func handleUpdateProfile(w http.ResponseWriter, r *http.Request, user *User) {
+	defer r.Body.Close()
+	var req ProfileUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: "invalid JSON"})
+		return
+	}
+	if err := validateProfileUpdate(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: err.Error()})
+		return
+	}
+	if err := updateProfile(user.ID, req); err != nil {
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to update profile"})
+		return
+	}
+
+	updated := *user
+	if req.FName != nil {
+		updated.FName = *req.FName
+	}
+	if req.LName != nil {
+		updated.LName = *req.LName
+	}
+	if req.Avatar != nil {
+		updated.Avatar = *req.Avatar
+	}
+	writeJSON(w, http.StatusOK, AuthResponse{Success: true, Message: "profile updated", User: &updated})
+}
+
+// handleDeleteAccount serves DELETE /api/me, which erases the account and all
+// of its data (see eraseUser) and logs out.
+func handleDeleteAccount(w http.ResponseWriter, r *http.Request, user *User) {
+	defer r.Body.Close()
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: "invalid JSON"})
+		return
+	}
+
+	err := checkCurrentPassword(user, req.Password, clientIP(r), "delete account")
+	if errors.Is(err, errNoPassword) {
+		err = nil
+		if !strings.EqualFold(strings.TrimSpace(req.Confirm), user.Email) {
+			err = errConfirmEmail
+		}
+	}
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	requestID, err := requestErasure(user.ID)
+	if err != nil {
+		log.Printf("failed to request erasure of user %d: %v", user.ID, err)
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to delete account"})
+		return
+	}
+	clearSessionCookie(w)
+	if err := processErasure(requestID, user.ID); err != nil {
+		// The erasure job retries; the user is already logged out everywhere.
+		log.Printf("failed to erase user %d, will retry: %v", user.ID, err)
+		writeJSON(w, http.StatusAccepted, AuthResponse{Success: true, Message: "your account will be deleted shortly"})
+		return
+	}
+	writeJSON(w, http.StatusOK, AuthResponse{Success: true, Message: "account deleted"})
+}
+
+// handleChangeEmail serves POST /api/me/email. The current address stays in
+// use until the link mailed to the new one is opened.
+func handleChangeEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, AuthResponse{Success: false, Message: "use POST"})
+		return
+	}
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, AuthResponse{Success: false, Message: "login required"})
+		return
+	}
+	defer r.Body.Close()
+	var req EmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: "invalid JSON"})
+		return
+	}
+	email, err := normalizeNewEmail(req.Email)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: err.Error()})
+		return
+	}
+	if strings.EqualFold(email, user.Email) {
+		writeProfileError(w, errEmailUnchanged)
+		return
+	}
+	// Provider-only accounts have no password to confirm with.
+	if err := checkCurrentPassword(user, req.Password, clientIP(r), "change email"); err != nil && !errors.Is(err, errNoPassword) {
+		writeProfileError(w, err)
+		return
+	}
+	taken, err := emailTaken(email)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to change email"})
+		return
+	}
+	if taken {
+		writeProfileError(w, errEmailInUse)
+		return
+	}
+
+	msg, err := emailChangeMail(emailChangeClaim{UserID: user.ID, OldEmail: user.Email, NewEmail: email}, user.FName)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to change email"})
+		return
+	}
+	sendMailAsync(msg)
+	writeJSON(w, http.StatusAccepted, AuthResponse{
+		Success: true,
+		Message: "check " + email + " for a link to confirm the change",
+	})
+}
+
+// handleConfirmEmailChange serves GET /api/auth/verify/email-change?token=...,
+// the link mailed by handleChangeEmail. On success the browser is sent to the
+// dashboard.
+func handleConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	var claim emailChangeClaim
+	if err := verifyPayload(emailChangePurpose, r.URL.Query().Get("token"), &claim); err != nil {
+		http.Error(w, "This link is invalid or has expired. Log in and change your email again.", http.StatusBadRequest)
+		return
+	}
+	if err := applyEmailChange(claim); err != nil {
+		switch {
+		case errors.Is(err, errEmailInUse):
+			http.Error(w, "Another account already uses this email address.", http.StatusConflict)
+		case errors.Is(err, errSignatureInvalid):
+			http.Error(w, "This link is no longer valid for your account.", http.StatusBadRequest)
+		default:
+			log.Printf("failed to change email of user %d: %v", claim.UserID, err)
+			http.Error(w, "failed to change email", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recordAuthEvent(AuthEventEmailChanged, claim.UserID, normalizeLoginEmail(claim.NewEmail), clientIP(r), "from "+claim.OldEmail)
+	var fName string
+	if err := db.QueryRow("SELECT first_name FROM users WHERE id = ?", claim.UserID).Scan(&fName); err == nil {
+		sendMailAsync(emailChangedMail(claim, fName))
+	}
+	http.Redirect(w, r, "/dashboard?email_changed=1", http.StatusSeeOther)
+}
+
+// handleChangePassword serves POST /api/me/password. Other sessions of the
+// user are logged out; the current one stays.
+func handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, AuthResponse{Success: false, Message: "use POST"})
+		return
+	}
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, AuthResponse{Success: false, Message: "login required"})
+		return
+	}
+	defer r.Body.Close()
+	var req PasswordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: "invalid JSON"})
+		return
+	}
+	if err := validateNewPassword(req.NewPassword); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: err.Error()})
+		return
+	}
+	if err := checkCurrentPassword(user, req.CurrentPassword, clientIP(r), "change password"); err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	var keep string
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		keep = cookie.Value
+	}
+	if err := changePassword(user.ID, req.NewPassword, keep); err != nil {
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to change password"})
+		return
+	}
+	recordAuthEvent(AuthEventPasswordChanged, user.ID, normalizeLoginEmail(user.Email), clientIP(r), "")
+	writeJSON(w, http.StatusOK, AuthResponse{Success: true, Message: "password changed"})
+}
+
+// writeProfileError maps profile errors to HTTP statuses.
+func writeProfileError(w http.ResponseWriter, err error) {
+	var throttled throttledError
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(throttled.seconds()))
+		writeJSON(w, http.StatusTooManyRequests, AuthResponse{Success: false, Message: err.Error()})
+	case errors.Is(err, errEmailInUse), errors.Is(err, errNoPassword):
+		writeJSON(w, http.StatusConflict, AuthResponse{Success: false, Message: err.Error()})
+	case errors.Is(err, errEmailUnchanged):
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: err.Error()})
+	case errors.Is(err, errWrongPassword), errors.Is(err, errConfirmEmail):
+		writeJSON(w, http.StatusForbidden, AuthResponse{Success: false, Message: err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to update account"})
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidateProfileUpdate verifies name and avatar checks of PATCH /api/me.
+func TestValidateProfileUpdate(t *testing.T) {
+	t.Parallel()
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name    string
+		req     ProfileUpdateRequest
+		wantErr bool
+	}{
+		{"Empty update", ProfileUpdateRequest{}, true},
+		{"First name", ProfileUpdateRequest{FName: str("Ada")}, false},
+		{"Blank last name", ProfileUpdateRequest{LName: str("   ")}, true},
+		{"Long name", ProfileUpdateRequest{FName: str(strings.Repeat("a", 101))}, true},
+		{"Long multibyte name within limit", ProfileUpdateRequest{FName: str(strings.Repeat("é", 100))}, false},
+		{"Offered avatar", ProfileUpdateRequest{Avatar: str("avatar2")}, false},
+		{"Unknown avatar", ProfileUpdateRequest{Avatar: str("https://example.com/a.png")}, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateProfileUpdate(&tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateProfileUpdate() observed error = %v, expected error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateProfileUpdateTrimsNames verifies stored names carry no padding.
+func TestValidateProfileUpdateTrimsNames(t *testing.T) {
+	t.Parallel()
+	name := "  Ada "
+	req := ProfileUpdateRequest{FName: &name}
+	if err := validateProfileUpdate(&req); err != nil {
+		t.Fatalf("validateProfileUpdate() observed error = %v, expected: nil", err)
+	}
+	if *req.FName != "Ada" {
+		t.Errorf("FName observed = %q, expected: %q", *req.FName, "Ada")
+	}
+}
+
+// TestNormalizeNewEmail verifies only bare, single addresses are accepted.
+func TestNormalizeNewEmail(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{" ada@example.com ", "ada@example.com", false},
+		{"not-an-email", "", true},
+		{"Ada <ada@example.com>", "", true},
+		{"ada@example.com, bob@example.com", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		observed, err := normalizeNewEmail(tt.input)
+		if (err != nil) != tt.wantErr || observed != tt.expected {
+			t.Errorf("normalizeNewEmail(%q) observed = (%q, %v), expected: (%q, error %v)",
+				tt.input, observed, err, tt.expected, tt.wantErr)
+		}
+	}
+}
+
+// TestAccountEndpointsRequireLogin verifies that anonymous requests cannot
+// edit, re-address or delete an account.
+func TestAccountEndpointsRequireLogin(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		handler http.HandlerFunc
+	}{
+		{"Update profile", http.MethodPatch, "/api/me", handleMe},
+		{"Delete account", http.MethodDelete, "/api/me", handleMe},
+		{"Change email", http.MethodPost, "/api/me/email", handleChangeEmail},
+		{"Change password", http.MethodPost, "/api/me/password", handleChangePassword},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			tt.handler(rr, httptest.NewRequest(tt.method, tt.target, strings.NewReader("{}")))
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d, observed: %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+	}
+}
+
+// TestAccountEndpointsRejectAPITokens verifies that personal API tokens,
+// which are never scoped for account management, cannot change the account.
+func TestAccountEndpointsRejectAPITokens(t *testing.T) {
+	t.Parallel()
+	auth := &requestAuth{user: &User{ID: 1, Email: "ada@example.com"}, tokenID: 7}
+	req := httptest.NewRequest(http.MethodDelete, "/api/me", strings.NewReader(`{"confirm":"ada@example.com"}`))
+	req = req.WithContext(context.WithValue(req.Context(), authKey, auth))
+	rr := httptest.NewRecorder()
+	handleMe(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, observed: %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+// TestHandleUpdateProfileValidates verifies invalid updates are refused
+// before reaching the database.
+func TestHandleUpdateProfileValidates(t *testing.T) {
+	t.Parallel()
+	auth := &requestAuth{user: &User{ID: 1, FName: "Ada"}}
+	for _, body := range []string{`not json`, `{}`, `{"fName":""}`, `{"avatar":"avatar9"}`} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/me", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), authKey, auth))
+		rr := httptest.NewRecorder()
+		handleMe(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("PATCH %s: expected status %d, observed: %d", body, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+// TestWriteProfileErrorThrottled verifies throttled password checks answer
+// 429 with a Retry-After header in whole seconds.
+func TestWriteProfileErrorThrottled(t *testing.T) {
+	t.Parallel()
+	rr := httptest.NewRecorder()
+	writeProfileError(rr, throttledError{retryAfter: 7500 * time.Millisecond})
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("writeProfileError() expected status %d, observed: %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "8" {
+		t.Errorf("writeProfileError() observed Retry-After = %q, expected: %q", got, "8")
+	}
+	if !strings.Contains(rr.Body.String(), "try again in 8 seconds") {
+		t.Errorf("writeProfileError() observed body = %s, expected the wait in seconds", rr.Body.String())
+	}
+}
+
+// TestHandleConfirmEmailChangeRejectsBadTokens verifies that forged, expired
+// and verification tokens cannot change an email.
+func TestHandleConfirmEmailChangeRejectsBadTokens(t *testing.T) {
+	t.Parallel()
+	claim := emailChangeClaim{UserID: 1, OldEmail: "ada@example.com", NewEmail: "ada@example.org"}
+	expired, _ := signPayload(emailChangePurpose, claim, -time.Minute)
+	verifyToken, _ := signPayload(emailVerifyPurpose, emailVerifyClaim{UserID: 1, Email: "ada@example.org"}, time.Hour)
+
+	tests := map[string]string{
+		"Missing token":      "",
+		"Forged token":       "e30.forged",
+		"Expired token":      expired,
+		"Verification token": verifyToken,
+	}
+	for name, token := range tests {
+		token := token
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			rr := httptest.NewRecorder()
+			handleConfirmEmailChange(rr, httptest.NewRequest(http.MethodGet, "/api/auth/verify/email-change?token="+url.QueryEscape(token), nil))
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, observed: %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+// TestEmailChangeMail verifies the link goes to the new address and carries
+// the claim.
+func TestEmailChangeMail(t *testing.T) {
+	t.Parallel()
+	claim := emailChangeClaim{UserID: 3, OldEmail: "ada@example.com", NewEmail: "ada@example.org"}
+	msg, err := emailChangeMail(claim, "Ada")
+	if err != nil {
+		t.Fatalf("emailChangeMail() observed error = %v, expected: nil", err)
+	}
+	if msg.To != claim.NewEmail {
+		t.Errorf("To observed = %q, expected: %q", msg.To, claim.NewEmail)
+	}
+	_, raw, ok := strings.Cut(msg.Body, "token=")
+	if !ok {
+		t.Fatalf("Body observed = %q, expected a token link", msg.Body)
+	}
+	token, _ := url.QueryUnescape(strings.Fields(raw)[0])
+	var got emailChangeClaim
+	if err := verifyPayload(emailChangePurpose, token, &got); err != nil || got != claim {
+		t.Errorf("verifyPayload() observed = (%+v, %v), expected: (%+v, nil)", got, err, claim)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== XP Rules ========
+
+// activityXP is the XP granted for each recorded activity kind. Kinds not
+// listed here (solved problems and completed quizzes, which are rewarded once
+// per ref by recordRefActivity) earn nothing through recordActivity.
+var activityXP = map[string]int{
+	ActivityMatrixAdd:      2,
+	ActivityMatrixSubtract: 2,
+	ActivityMatrixMultiply: 3,
+	ActivityMatrixRREF:     5,
+}
+
+// problemXP is the XP granted for solving one practice problem.
+const problemXP = 20
+
+// streakMilestones maps a streak length in days to its one-time XP bonus.
+var streakMilestones = map[int]int{
+	3:   25,
+	7:   75,
+	14:  150,
+	30:  400,
+	100: 1500,
+}
+
+// Ledger reasons stored in xp_ledger.reason.
+const (
+	XPReasonStreak  = "streak.milestone"
+	XPReasonQuiz    = ActivityQuizCompleted
+	XPReasonProblem = ActivityProblemSolved
+)
+
+// maxActivityRefLen is the longest quiz or problem ref, matching xp_ledger.ref.
+const maxActivityRefLen = 100
+
+var (
+	errQuizNotFound    = errors.New("quiz not found")
+	errProblemNotFound = errors.New("problem not found")
+)
+
+// quizXP converts a quiz score into XP: up to 50 XP scaled by the fraction of
+// correct answers, plus a 25 XP bonus for a perfect score.
+func quizXP(correct, total int) int {
+	if total <= 0 || correct <= 0 {
+		return 0
+	}
+	if correct > total {
+		correct = total
+	}
+	xp := 50 * correct / total
+	if correct == total {
+		xp += 25
+	}
+	return xp
+}
+
+// ======== Level Curve ========
+
+// LevelCurve defines how much cumulative XP each level requires. Reaching
+// level L takes Base * (L-1)^Exponent XP, so level 1 starts at zero.
+type LevelCurve struct {
+	Base     float64
+	Exponent float64
+}
+
+// levelCurve returns the curve configured by XP_CURVE_BASE and
+// XP_CURVE_EXPONENT, falling back to defaults for missing or invalid values.
+func levelCurve() LevelCurve {
+	c := LevelCurve{Base: 100, Exponent: 1.5}
+	if v, err := strconv.ParseFloat(envOr("XP_CURVE_BASE", ""), 64); err == nil && v > 0 {
+		c.Base = v
+	}
+	if v, err := strconv.ParseFloat(envOr("XP_CURVE_EXPONENT", ""), 64); err == nil && v >= 1 {
+		c.Exponent = v
+	}
+	return c
+}
+
+// Threshold returns the cumulative XP required to reach level.
+func (c LevelCurve) Threshold(level int) int {
+	if level <= 1 {
+		return 0
+	}
+	return int(math.Round(c.Base * math.Pow(float64(level-1), c.Exponent)))
+}
+
+// Level returns the highest level whose threshold xp has reached.
+func (c LevelCurve) Level(xp int) int {
+	level := 1
+	for c.Threshold(level+1) <= xp {
+		level++
+	}
+	return level
+}
+
+// ======== Validation ========
+
+// QuizResultRequest is the JSON body of POST /api/me/quizzes.
+type QuizResultRequest struct {
+	Quiz    string `json:"quiz"` // ref of a quiz in the quizzes table
+	Correct int    `json:"correct"`
+}
+
+// ProblemSolvedRequest is the JSON body of POST /api/me/problems.
+type ProblemSolvedRequest struct {
+	Problem string `json:"problem"` // ref of a problem in the practice_problems table
+}
+
+// normalizeActivityRef trims a quiz or problem ref and checks its length.
+func normalizeActivityRef(field, ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", fmt.Errorf("%s is required", field)
+	}
+	if len(ref) > maxActivityRefLen {
+		return "", fmt.Errorf("%s is longer than %d characters", field, maxActivityRefLen)
+	}
+	return ref, nil
+}
+
+// validateQuizResult checks a reported quiz score and normalizes its ref. The
+// upper bound of the score depends on the quiz and is checked against the
+// catalog by the handler.
+func validateQuizResult(req *QuizResultRequest) error {
+	ref, err := normalizeActivityRef("quiz", req.Quiz)
+	if err != nil {
+		return err
+	}
+	req.Quiz = ref
+	if req.Correct < 0 {
+		return errors.New("correct must not be negative")
+	}
+	return nil
+}
+
+// ======== DB Functions ========
+
+// getQuizQuestionCount returns the number of questions of the active quiz ref.
+func getQuizQuestionCount(ref string) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT question_count FROM quizzes WHERE ref = ? AND is_active = TRUE", ref).Scan(&n)
+	if err == sql.ErrNoRows {
+		return 0, errQuizNotFound
+	}
+	return n, err
+}
+
+// checkPracticeProblem returns errProblemNotFound unless ref is an active
+// practice problem.
+func checkPracticeProblem(ref string) error {
+	var found string
+	err := db.QueryRow("SELECT ref FROM practice_problems WHERE ref = ? AND is_active = TRUE", ref).Scan(&found)
+	if err == sql.ErrNoRows {
+		return errProblemNotFound
+	}
+	return err
+}
+
+// awardXP appends one entry to the XP ledger and reports whether it was
+// written. Entries with a non-empty ref are unique per (user, reason, ref), so
+// repeating an award is a no-op; they are written even for zero XP so the ref
+// still counts as recorded.
+func awardXP(userID, amount int, reason, ref string) (bool, error) {
+	if amount <= 0 && ref == "" {
+		return false, nil
+	}
+	var refArg interface{}
+	if ref != "" {
+		refArg = ref
+	}
+	result, err := db.Exec(
+		"INSERT IGNORE INTO xp_ledger (user_id, amount, reason, ref) VALUES (?, ?, ?, ?)",
+		userID, max(amount, 0), reason, refArg,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// awardActivityXP grants the XP for one activity of kind and, when the user's
+// current streak has just reached a milestone, the milestone bonus.
+func awardActivityXP(userID int, kind string, streak int) error {
+	if _, err := awardXP(userID, activityXP[kind], kind, ""); err != nil {
+		return err
+	}
+	if bonus, ok := streakMilestones[streak]; ok {
+		// Key the bonus on the day the streak started so each streak pays once.
+		start := time.Now().UTC().AddDate(0, 0, -(streak - 1)).Format("2006-01-02")
+		_, err := awardXP(userID, bonus, XPReasonStreak, fmt.Sprintf("%d:%s", streak, start))
+		return err
+	}
+	return nil
+}
+
+// recordRefActivity records one activity of kind identified by ref and grants
+// xp for it. The ledger row is written first and the activity event only when
+// that row is new, so replaying a ref repeats neither the XP nor the event
+// that trophies and streaks count. It reports whether the ref was new.
+func recordRefActivity(userID int, kind, ref string, xp int) (bool, error) {
+	recorded, err := awardXP(userID, xp, kind, ref)
+	if err != nil || !recorded {
+		return false, err
+	}
+	return true, recordActivity(userID, kind)
+}
+
+// recordQuizResult records a completed quiz identified by quizRef and grants
+// XP for its score. Only the first result a user reports for a quiz is
+// rewarded.
+func recordQuizResult(userID int, quizRef string, correct, total int) (bool, error) {
+	return recordRefActivity(userID, ActivityQuizCompleted, quizRef, quizXP(correct, total))
+}
+
+// recordProblemSolved records the practice problem identified by problemRef as
+// solved. Each problem is only rewarded once.
+func recordProblemSolved(userID int, problemRef string) (bool, error) {
+	return recordRefActivity(userID, ActivityProblemSolved, problemRef, problemXP)
+}
+
+// getUserXP returns the total XP in userID's ledger.
+func getUserXP(userID int) (int, error) {
+	var xp int
+	err := db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM xp_ledger WHERE user_id = ?", userID).Scan(&xp)
+	return xp, err
+}
+
+// ======== HTTP Handlers ========
+
+// ProgressResponse is the JSON payload returned by GET /api/me/progress.
+type ProgressResponse struct {
+	Level       int `json:"level"`
+	XP          int `json:"xp"`
+	LevelXP     int `json:"level_xp"`      // cumulative XP at which the current level started
+	NextLevelXP int `json:"next_level_xp"` // cumulative XP needed for the next level
+	Streak      int `json:"streak"`
+}
+
+// ActivityResult is the JSON payload returned when a quiz or solved problem is
+// reported.
+type ActivityResult struct {
+	Recorded  bool `json:"recorded"` // false when the ref had already been recorded
+	XPAwarded int  `json:"xp_awarded"`
+}
+
+// buildProgress computes level information for a total XP amount.
+func buildProgress(c LevelCurve, xp int) ProgressResponse {
+	level := c.Level(xp)
+	return ProgressResponse{
+		Level:       level,
+		XP:          xp,
+		LevelXP:     c.Threshold(level),
+		NextLevelXP: c.Threshold(level + 1),
+	}
+}
+
+// handleGetMyProgress serves GET /api/me/progress.
+func handleGetMyProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	xp, err := getUserXP(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	stats, err := getActivityStats(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	resp := buildProgress(levelCurve(), xp)
+	resp.Streak = stats.Streak
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRecordQuiz serves POST /api/me/quizzes.
+func handleRecordQuiz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	defer r.Body.Close()
+	var req QuizResultRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	if err := validateQuizResult(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	total, err := getQuizQuestionCount(req.Quiz)
+	if err != nil {
+		writeActivityError(w, err)
+		return
+	}
+	if req.Correct > total {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("correct must be between 0 and %d", total)})
+		return
+	}
+
+	recorded, err := recordQuizResult(userID, req.Quiz, req.Correct, total)
+	if err != nil {
+		writeActivityError(w, err)
+		return
+	}
+	writeActivityResult(w, recorded, quizXP(req.Correct, total))
+}
+
+// handleRecordProblem serves POST /api/me/problems.
+func handleRecordProblem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	defer r.Body.Close()
+	var req ProblemSolvedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	ref, err := normalizeActivityRef("problem", req.Problem)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := checkPracticeProblem(ref); err != nil {
+		writeActivityError(w, err)
+		return
+	}
+
+	recorded, err := recordProblemSolved(userID, ref)
+	if err != nil {
+		writeActivityError(w, err)
+		return
+	}
+	writeActivityResult(w, recorded, problemXP)
+}
+
+// writeActivityResult answers 201 for a newly recorded ref and 200 with no XP
+// for a replay.
+func writeActivityResult(w http.ResponseWriter, recorded bool, xp int) {
+	if !recorded {
+		writeJSON(w, http.StatusOK, ActivityResult{})
+		return
+	}
+	writeJSON(w, http.StatusCreated, ActivityResult{Recorded: true, XPAwarded: xp})
+}
+
+// writeActivityError maps quiz and problem report errors to HTTP responses.
+func writeActivityError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, errQuizNotFound) || errors.Is(err, errProblemNotFound) {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
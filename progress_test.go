@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLevelCurve verifies thresholds and level lookup on the default curve.
+func TestLevelCurve(t *testing.T) {
+	t.Parallel()
+	c := LevelCurve{Base: 100, Exponent: 1.5}
+	tests := []struct {
+		name        string
+		xp          int
+		level       int
+		levelXP     int
+		nextLevelXP int
+	}{
+		{"No XP", 0, 1, 0, 100},
+		{"Just below level 2", 99, 1, 0, 100},
+		{"Exactly level 2", 100, 2, 100, 283},
+		{"Middle of level 4", 700, 4, 520, 800},
+		{"Exactly level 5", 800, 5, 800, 1118},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p := buildProgress(c, tt.xp)
+			if p.Level != tt.level || p.LevelXP != tt.levelXP || p.NextLevelXP != tt.nextLevelXP {
+				t.Errorf("buildProgress(%d) observed = level %d [%d, %d), expected: level %d [%d, %d)",
+					tt.xp, p.Level, p.LevelXP, p.NextLevelXP, tt.level, tt.levelXP, tt.nextLevelXP)
+			}
+		})
+	}
+}
+
+// TestQuizXP verifies score-based XP including clamping and the perfect-score bonus.
+func TestQuizXP(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		correct  int
+		total    int
+		expected int
+	}{
+		{"Perfect score", 10, 10, 75},
+		{"Half correct", 5, 10, 25},
+		{"Nothing correct", 0, 10, 0},
+		{"Empty quiz", 0, 0, 0},
+		{"More correct than questions is clamped", 12, 10, 75},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := quizXP(tt.correct, tt.total); got != tt.expected {
+				t.Errorf("quizXP(%d, %d) observed = %d, expected: %d", tt.correct, tt.total, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestValidateQuizResult verifies quiz refs are required and scores are not
+// negative.
+func TestValidateQuizResult(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		req     QuizResultRequest
+		wantErr bool
+	}{
+		{"Valid", QuizResultRequest{Quiz: "eigenvalues", Correct: 8}, false},
+		{"Nothing correct", QuizResultRequest{Quiz: "eigenvalues", Correct: 0}, false},
+		{"Blank quiz", QuizResultRequest{Quiz: "  ", Correct: 1}, true},
+		{"Long quiz", QuizResultRequest{Quiz: strings.Repeat("q", maxActivityRefLen+1), Correct: 1}, true},
+		{"Negative correct", QuizResultRequest{Quiz: "eigenvalues", Correct: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := validateQuizResult(&tt.req); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateQuizResult() observed err = %v, expected error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	req := QuizResultRequest{Quiz: " eigenvalues\n", Correct: 1}
+	if err := validateQuizResult(&req); err != nil || req.Quiz != "eigenvalues" {
+		t.Errorf("validateQuizResult() observed quiz = %q, err = %v, expected a trimmed ref", req.Quiz, err)
+	}
+}
+
+// TestActivityReportHandlersValidate verifies bad quiz and problem reports are
+// refused before reaching the database.
+func TestActivityReportHandlersValidate(t *testing.T) {
+	t.Parallel()
+	ada := &User{ID: 7}
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		method   string
+		body     string
+		user     *User
+		expected int
+	}{
+		{"quiz logged out", handleRecordQuiz, http.MethodPost, `{"quiz":"a","correct":1}`, nil, http.StatusUnauthorized},
+		{"quiz get", handleRecordQuiz, http.MethodGet, "", ada, http.StatusMethodNotAllowed},
+		{"quiz bad json", handleRecordQuiz, http.MethodPost, `{`, ada, http.StatusBadRequest},
+		{"quiz bad score", handleRecordQuiz, http.MethodPost, `{"quiz":"a","correct":-1}`, ada, http.StatusBadRequest},
+		{"problem logged out", handleRecordProblem, http.MethodPost, `{"problem":"a"}`, nil, http.StatusUnauthorized},
+		{"problem get", handleRecordProblem, http.MethodGet, "", ada, http.StatusMethodNotAllowed},
+		{"problem blank", handleRecordProblem, http.MethodPost, `{"problem":" "}`, ada, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/me/quizzes", strings.NewReader(tt.body))
+		if tt.user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), authKey, &requestAuth{user: tt.user}))
+		}
+		rr := httptest.NewRecorder()
+		tt.handler(rr, req)
+		if rr.Code != tt.expected {
+			t.Errorf("%s: expected status %d, observed: %d (%s)", tt.name, tt.expected, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// TestActivityReportsNeedCatalogRefs verifies quizzes and problems missing
+// from the catalog, or scores above a quiz's question count, earn nothing.
+func TestActivityReportsNeedCatalogRefs(t *testing.T) {
+	useTestDB(t)
+	user := &User{ID: createTestUser(t, "Ada", "Lovelace")}
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		body     string
+		expected int
+	}{
+		{"invented quiz", handleRecordQuiz, `{"quiz":"invented-quiz","correct":1}`, http.StatusNotFound},
+		{"score above question count", handleRecordQuiz, `{"quiz":"determinants","correct":9}`, http.StatusBadRequest},
+		{"invented problem", handleRecordProblem, `{"problem":"invented/problem-1"}`, http.StatusNotFound},
+		{"catalog quiz", handleRecordQuiz, `{"quiz":"determinants","correct":8}`, http.StatusCreated},
+		{"catalog quiz again", handleRecordQuiz, `{"quiz":"determinants","correct":8}`, http.StatusOK},
+		{"catalog problem", handleRecordProblem, `{"problem":"matrices/add-1"}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/me/quizzes", strings.NewReader(tt.body))
+		req = req.WithContext(context.WithValue(req.Context(), authKey, &requestAuth{user: user}))
+		rr := httptest.NewRecorder()
+		tt.handler(rr, req)
+		if rr.Code != tt.expected {
+			t.Errorf("%s: expected status %d, observed: %d (%s)", tt.name, tt.expected, rr.Code, rr.Body.String())
+		}
+	}
+
+	xp, err := getUserXP(user.ID)
+	if err != nil {
+		t.Fatalf("getUserXP observed error = %v", err)
+	}
+	if expected := quizXP(8, 8) + problemXP; xp != expected {
+		t.Errorf("getUserXP observed = %d, expected: %d from the catalog refs only", xp, expected)
+	}
+}
@@ -0,0 +1,787 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ======== Types ========
+
+// ResourceRequest is the JSON payload for creating or replacing a resource.
+// IsFree and IsActive default to true when omitted. On PUT, omitting TagIDs
+// keeps the current tags while an empty list removes them all.
+type ResourceRequest struct {
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Url          string `json:"url"`
+	TypeID       int    `json:"type_id"`
+	SkillLevel   string `json:"skill_level"`
+	Author       string `json:"author"`
+	SourceName   string `json:"source_name"`
+	ThumbnailUrl string `json:"thumbnail_url"`
+	IsFree       *bool  `json:"is_free"`
+	IsFeatured   bool   `json:"is_featured"`
+	IsActive     *bool  `json:"is_active"`
+	TagIDs       []int  `json:"tag_ids"`
+}
+
+// ResourceTagRequest is the JSON payload for creating or replacing a tag. An
+// empty slug is derived from the name, and an empty color uses the default.
+type ResourceTagRequest struct {
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Color string `json:"color"`
+}
+
+// AdminResource is a resource as shown to staff: inactive ones included,
+// with the IDs of its tags.
+type AdminResource struct {
+	Resource
+	TagIDs []int `json:"tag_ids"`
+}
+
+// skillLevels are the values of resources.skill_level, easiest first.
+var skillLevels = []string{"beginner", "intermediate", "advanced"}
+
+const (
+	maxResourceTitleLen = 255
+	maxResourceTextLen  = 255 // author and source_name
+	maxResourceURLLen   = 500
+	maxResourceTags     = 20
+	maxTagNameLen       = 100
+	defaultTagColor     = "#6366f1"
+)
+
+var (
+	tagColorPattern = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+	tagSlugPattern  = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+var (
+	errResourceNotFound     = errors.New("resource not found")
+	errResourceTagNotFound  = errors.New("tag not found")
+	errUnknownResourceType  = errors.New("unknown resource type")
+	errUnknownResourceTag   = errors.New("unknown tag")
+	errResourceTagNameInUse = errors.New("a tag with this name or slug already exists")
+)
+
+// ======== Validation ========
+
+// validateResourceURL checks that raw is an absolute http or https URL that
+// fits the url columns, and returns it trimmed.
+func validateResourceURL(field, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) > maxResourceURLLen {
+		return "", fmt.Errorf("%s is longer than %d characters", field, maxResourceURLLen)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%s must be an http or https URL", field)
+	}
+	return raw, nil
+}
+
+// validSkillLevel reports whether level is one of skillLevels.
+func validSkillLevel(level string) bool {
+	for _, l := range skillLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTagIDs removes duplicates from ids, keeping nil as nil so callers
+// can tell "no tags" from "tags not given".
+func normalizeTagIDs(ids []int) ([]int, error) {
+	if ids == nil {
+		return nil, nil
+	}
+	out := []int{}
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if id <= 0 {
+			return nil, fmt.Errorf("invalid tag id %d", id)
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	if len(out) > maxResourceTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxResourceTags)
+	}
+	return out, nil
+}
+
+// validateResourceRequest checks a resource payload and normalizes its
+// fields. Whether type_id and tag_ids exist is checked when saving.
+func validateResourceRequest(req *ResourceRequest) error {
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		return errors.New("title is required")
+	}
+	if len(req.Title) > maxResourceTitleLen {
+		return fmt.Errorf("title is longer than %d characters", maxResourceTitleLen)
+	}
+	u, err := validateResourceURL("url", req.Url)
+	if err != nil {
+		return err
+	}
+	req.Url = u
+	if req.ThumbnailUrl = strings.TrimSpace(req.ThumbnailUrl); req.ThumbnailUrl != "" {
+		if req.ThumbnailUrl, err = validateResourceURL("thumbnail_url", req.ThumbnailUrl); err != nil {
+			return err
+		}
+	}
+	if req.TypeID <= 0 {
+		return errors.New("type_id is required")
+	}
+	req.SkillLevel = strings.ToLower(strings.TrimSpace(req.SkillLevel))
+	if req.SkillLevel == "" {
+		req.SkillLevel = skillLevels[0]
+	}
+	if !validSkillLevel(req.SkillLevel) {
+		return fmt.Errorf("skill_level must be one of %s", strings.Join(skillLevels, ", "))
+	}
+	req.Author = strings.TrimSpace(req.Author)
+	req.SourceName = strings.TrimSpace(req.SourceName)
+	if len(req.Author) > maxResourceTextLen || len(req.SourceName) > maxResourceTextLen {
+		return fmt.Errorf("author and source_name must be at most %d characters", maxResourceTextLen)
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if req.IsFree == nil {
+		t := true
+		req.IsFree = &t
+	}
+	if req.IsActive == nil {
+		t := true
+		req.IsActive = &t
+	}
+	req.TagIDs, err = normalizeTagIDs(req.TagIDs)
+	return err
+}
+
+// slugify turns a tag name into a slug such as "quick-reference".
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(c)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// validateTagRequest checks a tag payload and normalizes its fields. Colors
+// are "#rrggbb" hex and stored in lowercase.
+func validateTagRequest(req *ResourceTagRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(req.Name) > maxTagNameLen {
+		return fmt.Errorf("name is longer than %d characters", maxTagNameLen)
+	}
+	req.Slug = strings.TrimSpace(req.Slug)
+	if req.Slug == "" {
+		req.Slug = slugify(req.Name)
+	}
+	if len(req.Slug) > maxTagNameLen || !tagSlugPattern.MatchString(req.Slug) {
+		return errors.New("slug must be lowercase letters and digits separated by single dashes")
+	}
+	req.Color = strings.ToLower(strings.TrimSpace(req.Color))
+	if req.Color == "" {
+		req.Color = defaultTagColor
+	}
+	if !tagColorPattern.MatchString(req.Color) {
+		return errors.New("color must be a hex color such as #6366f1")
+	}
+	return nil
+}
+
+// ======== DB Functions ========
+
+// checkResourceRefs verifies inside tx that typeID and every tag exist.
+func checkResourceRefs(tx *sql.Tx, typeID int, tagIDs []int) error {
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM resource_types WHERE id = ?", typeID).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w %d", errUnknownResourceType, typeID)
+	}
+	for _, id := range tagIDs {
+		if err := tx.QueryRow("SELECT COUNT(*) FROM resource_tags WHERE id = ?", id).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%w %d", errUnknownResourceTag, id)
+		}
+	}
+	return nil
+}
+
+// setResourceTags replaces the tags of resourceID inside tx.
+func setResourceTags(tx *sql.Tx, resourceID int, tagIDs []int) error {
+	if _, err := tx.Exec("DELETE FROM resource_tag_map WHERE resource_id = ?", resourceID); err != nil {
+		return err
+	}
+	for _, id := range tagIDs {
+		if _, err := tx.Exec("INSERT INTO resource_tag_map (resource_id, tag_id) VALUES (?, ?)", resourceID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nullIfEmpty stores empty optional text columns as NULL, as the seed data does.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// insertResource inserts a resource with its tags inside tx and returns its ID.
+func insertResource(tx *sql.Tx, req ResourceRequest) (int, error) {
+	if err := checkResourceRefs(tx, req.TypeID, req.TagIDs); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`
+        INSERT INTO resources (title, description, url, type_id, skill_level, author,
+            source_name, thumbnail_url, is_free, is_featured, is_active)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		req.Title, nullIfEmpty(req.Description), req.Url, req.TypeID, req.SkillLevel, nullIfEmpty(req.Author),
+		nullIfEmpty(req.SourceName), nullIfEmpty(req.ThumbnailUrl), *req.IsFree, req.IsFeatured, *req.IsActive,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), setResourceTags(tx, int(id), req.TagIDs)
+}
+
+// rewriteResource replaces every field of resourceID inside tx, and its tags
+// when req.TagIDs is not nil. The view count is kept. Changing the URL or
+// is_active overrides the link checker like setResourceActive does.
+func rewriteResource(tx *sql.Tx, resourceID int, req ResourceRequest) error {
+	var oldURL string
+	var active bool
+	if err := tx.QueryRow("SELECT url, is_active FROM resources WHERE id = ? FOR UPDATE", resourceID).Scan(&oldURL, &active); err != nil {
+		if err == sql.ErrNoRows {
+			return errResourceNotFound
+		}
+		return err
+	}
+	if err := checkResourceRefs(tx, req.TypeID, req.TagIDs); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+        UPDATE resources SET title = ?, description = ?, url = ?, type_id = ?, skill_level = ?,
+            author = ?, source_name = ?, thumbnail_url = ?, is_free = ?, is_featured = ?, is_active = ?
+        WHERE id = ?`,
+		req.Title, nullIfEmpty(req.Description), req.Url, req.TypeID, req.SkillLevel, nullIfEmpty(req.Author),
+		nullIfEmpty(req.SourceName), nullIfEmpty(req.ThumbnailUrl), *req.IsFree, req.IsFeatured, *req.IsActive,
+		resourceID,
+	); err != nil {
+		return err
+	}
+	if req.Url != oldURL || *req.IsActive != active {
+		if err := resetLinkCheck(tx, resourceID, *req.IsActive || req.Url != oldURL); err != nil {
+			return err
+		}
+	}
+	if req.TagIDs == nil {
+		return nil
+	}
+	return setResourceTags(tx, resourceID, req.TagIDs)
+}
+
+// resetLinkCheck makes the link checker forget that it hid resourceID, so it
+// no longer restores a resource an admin changed. With clearFailures the
+// failure count starts afresh too, for a reactivated resource or a new URL.
+func resetLinkCheck(tx *sql.Tx, resourceID int, clearFailures bool) error {
+	reset := "UPDATE resource_link_checks SET deactivated_at = NULL WHERE resource_id = ?"
+	if clearFailures {
+		reset = "UPDATE resource_link_checks SET deactivated_at = NULL, consecutive_failures = 0 WHERE resource_id = ?"
+	}
+	_, err := tx.Exec(reset, resourceID)
+	return err
+}
+
+// createResource inserts a resource with its tags and returns its ID.
+func createResource(req ResourceRequest) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertResource(tx, req)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// updateResource replaces resourceID; see rewriteResource.
+func updateResource(resourceID int, req ResourceRequest) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := rewriteResource(tx, resourceID, req); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceResourceTags sets the tags of resourceID to tagIDs.
+func replaceResourceTags(resourceID int, tagIDs []int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var typeID int
+	if err := tx.QueryRow("SELECT type_id FROM resources WHERE id = ? FOR UPDATE", resourceID).Scan(&typeID); err != nil {
+		if err == sql.ErrNoRows {
+			return errResourceNotFound
+		}
+		return err
+	}
+	if err := checkResourceRefs(tx, typeID, tagIDs); err != nil {
+		return err
+	}
+	if err := setResourceTags(tx, resourceID, tagIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setResourceActive shows or hides resourceID in the public listing without
+// deleting it. A manual change overrides the link checker: it no longer
+// restores the resource, and reactivating starts its failure count afresh.
+func setResourceActive(resourceID int, active bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE resources SET is_active = ? WHERE id = ?", active, resourceID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var id int
+		if err := tx.QueryRow("SELECT id FROM resources WHERE id = ?", resourceID).Scan(&id); err != nil {
+			if err == sql.ErrNoRows {
+				return errResourceNotFound
+			}
+			return err
+		}
+	}
+	if err := resetLinkCheck(tx, resourceID, active); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteResource removes resourceID; its tag assignments cascade.
+func deleteResource(resourceID int) error {
+	result, err := db.Exec("DELETE FROM resources WHERE id = ?", resourceID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errResourceNotFound
+	}
+	return nil
+}
+
+// getAdminResources returns every resource, active or not, newest first, or
+// only resourceID when it is positive.
+func getAdminResources(resourceID int) ([]AdminResource, error) {
+	query := `
+        SELECT r.id, r.title, COALESCE(r.description,''), r.url,
+        r.type_id, r.skill_level, COALESCE(r.author,''),
+        COALESCE(r.source_name,''), COALESCE(r.thumbnail_url,''),
+        r.is_free, r.is_featured, r.is_active, r.view_count,
+        r.rating_avg, r.rating_count, r.created_at, r.updated_at,
+        COALESCE(GROUP_CONCAT(rtm.tag_id ORDER BY rtm.tag_id SEPARATOR ','), '')
+        FROM resources r
+        LEFT JOIN resource_tag_map rtm ON r.id = rtm.resource_id
+    `
+	var args []interface{}
+	if resourceID > 0 {
+		query += " WHERE r.id = ?"
+		args = append(args, resourceID)
+	}
+	query += " GROUP BY r.id ORDER BY r.id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resources := []AdminResource{}
+	for rows.Next() {
+		var r AdminResource
+		var tags string
+		if err := rows.Scan(&r.ID, &r.Title, &r.Description, &r.Url,
+			&r.Type_id, &r.Skill_level, &r.Author, &r.Source_name,
+			&r.Thumbnail_url, &r.Is_free, &r.Is_featured, &r.Is_active,
+			&r.View_count, &r.Rating_avg, &r.Rating_count, &r.Created_at, &r.Updated_at, &tags); err != nil {
+			return nil, err
+		}
+		r.TagIDs = []int{}
+		for _, s := range strings.Split(tags, ",") {
+			if id, err := strconv.Atoi(s); err == nil {
+				r.TagIDs = append(r.TagIDs, id)
+			}
+		}
+		resources = append(resources, r)
+	}
+	return resources, rows.Err()
+}
+
+// getAdminResource returns one resource by ID.
+func getAdminResource(resourceID int) (*AdminResource, error) {
+	resources, err := getAdminResources(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(resources) == 0 {
+		return nil, errResourceNotFound
+	}
+	return &resources[0], nil
+}
+
+// resourceTagTaken reports whether another tag than exceptID already uses
+// name or slug.
+func resourceTagTaken(name, slug string, exceptID int) (bool, error) {
+	var n int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM resource_tags WHERE (name = ? OR slug = ?) AND id <> ?",
+		name, slug, exceptID,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// saveResourceTag inserts a tag when tagID is 0 and replaces tagID otherwise,
+// returning the tag as stored.
+func saveResourceTag(tagID int, req ResourceTagRequest) (*ResourceTag, error) {
+	taken, err := resourceTagTaken(req.Name, req.Slug, tagID)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, errResourceTagNameInUse
+	}
+	if tagID == 0 {
+		result, err := db.Exec("INSERT INTO resource_tags (name, slug, color) VALUES (?, ?, ?)", req.Name, req.Slug, req.Color)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		tagID = int(id)
+	} else {
+		var id int
+		if err := db.QueryRow("SELECT id FROM resource_tags WHERE id = ?", tagID).Scan(&id); err != nil {
+			if err == sql.ErrNoRows {
+				return nil, errResourceTagNotFound
+			}
+			return nil, err
+		}
+		if _, err := db.Exec("UPDATE resource_tags SET name = ?, slug = ?, color = ? WHERE id = ?", req.Name, req.Slug, req.Color, tagID); err != nil {
+			return nil, err
+		}
+	}
+	return &ResourceTag{ID: tagID, Name: req.Name, Slug: req.Slug, Color: req.Color}, nil
+}
+
+// deleteResourceTag removes tagID; it is unassigned from every resource.
+func deleteResourceTag(tagID int) error {
+	result, err := db.Exec("DELETE FROM resource_tags WHERE id = ?", tagID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errResourceTagNotFound
+	}
+	return nil
+}
+
+// ======== HTTP Handlers ========
+
+// handleAdminResources serves /api/admin/resources.
+//
+// GET lists every resource including inactive ones, and POST creates one.
+func handleAdminResources(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		resources, err := getAdminResources(0)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, resources)
+
+	case http.MethodPost:
+		req, ok := parseResourceRequest(w, r)
+		if !ok {
+			return
+		}
+		id, err := createResource(*req)
+		if err != nil {
+			writeResourceError(w, err)
+			return
+		}
+		resource, err := getAdminResource(id)
+		if err != nil {
+			writeResourceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, resource)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or POST"})
+	}
+}
+
+// handleAdminResource serves /api/admin/resources/{id}.
+//
+// GET returns the resource, PUT replaces it and DELETE removes it for good.
+// To hide a resource but keep it, use the deactivate route instead.
+func handleAdminResource(w http.ResponseWriter, r *http.Request) {
+	resourceID, ok := parseResourceID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// handled after the switch
+
+	case http.MethodPut:
+		req, ok := parseResourceRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := updateResource(resourceID, *req); err != nil {
+			writeResourceError(w, err)
+			return
+		}
+
+	case http.MethodDelete:
+		if err := deleteResource(resourceID); err != nil {
+			writeResourceError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET, PUT or DELETE"})
+		return
+	}
+
+	resource, err := getAdminResource(resourceID)
+	if err != nil {
+		writeResourceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resource)
+}
+
+// handleAdminResourceActive returns the handler of POST
+// /api/admin/resources/{id}/activate or /deactivate.
+func handleAdminResourceActive(active bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+			return
+		}
+		resourceID, ok := parseResourceID(w, r)
+		if !ok {
+			return
+		}
+		if err := setResourceActive(resourceID, active); err != nil {
+			writeResourceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"is_active": active})
+	}
+}
+
+// handleAdminResourceTags serves PUT /api/admin/resources/{id}/tags with a
+// body of {"tag_ids": [1, 2]}, replacing the resource's tags.
+func handleAdminResourceTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use PUT"})
+		return
+	}
+	resourceID, ok := parseResourceID(w, r)
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	var req struct {
+		TagIDs []int `json:"tag_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	if req.TagIDs == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "tag_ids is required"})
+		return
+	}
+	tagIDs, err := normalizeTagIDs(req.TagIDs)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := replaceResourceTags(resourceID, tagIDs); err != nil {
+		writeResourceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]int{"tag_ids": tagIDs})
+}
+
+// handleAdminResourceTagList serves POST /api/admin/resource-tags, which
+// creates a tag. Tags are listed by GET /api/resources/tags.
+func handleAdminResourceTagList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	req, ok := parseTagRequest(w, r)
+	if !ok {
+		return
+	}
+	tag, err := saveResourceTag(0, *req)
+	if err != nil {
+		writeResourceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, tag)
+}
+
+// handleAdminResourceTag serves /api/admin/resource-tags/{id}: PUT replaces
+// the tag and DELETE removes it from every resource.
+func handleAdminResourceTag(w http.ResponseWriter, r *http.Request) {
+	tagID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || tagID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid tag id"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		req, ok := parseTagRequest(w, r)
+		if !ok {
+			return
+		}
+		tag, err := saveResourceTag(tagID, *req)
+		if err != nil {
+			writeResourceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tag)
+
+	case http.MethodDelete:
+		if err := deleteResourceTag(tagID); err != nil {
+			writeResourceError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use PUT or DELETE"})
+	}
+}
+
+// parseResourceID reads the {id} path value, writing a 400 response when it
+// is not a positive integer.
+func parseResourceID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid resource id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// parseResourceRequest decodes and validates a resource payload, writing a
+// 400 response on failure.
+func parseResourceRequest(w http.ResponseWriter, r *http.Request) (*ResourceRequest, bool) {
+	defer r.Body.Close()
+	var req ResourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return nil, false
+	}
+	if err := validateResourceRequest(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	return &req, true
+}
+
+// parseTagRequest decodes and validates a tag payload, writing a 400
+// response on failure.
+func parseTagRequest(w http.ResponseWriter, r *http.Request) (*ResourceTagRequest, bool) {
+	defer r.Body.Close()
+	var req ResourceTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return nil, false
+	}
+	if err := validateTagRequest(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	return &req, true
+}
+
+// writeResourceError maps resource admin errors to HTTP responses.
+func writeResourceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errResourceNotFound), errors.Is(err, errResourceTagNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, errUnknownResourceType), errors.Is(err, errUnknownResourceTag):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, errResourceTagNameInUse):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
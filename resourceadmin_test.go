@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestValidateResourceRequest verifies URL, skill level, type and tag checks
+// and the defaults applied to optional fields.
+func TestValidateResourceRequest(t *testing.T) {
+	t.Parallel()
+	valid := func() ResourceRequest {
+		return ResourceRequest{Title: " Essence of Linear Algebra ", Url: "https://www.3blue1brown.com/", TypeID: 5, TagIDs: []int{1, 3, 1}}
+	}
+	tests := []struct {
+		name    string
+		mutate  func(*ResourceRequest)
+		wantErr string
+	}{
+		{"Valid", func(*ResourceRequest) {}, ""},
+		{"Missing title", func(r *ResourceRequest) { r.Title = "  " }, "title is required"},
+		{"Relative URL", func(r *ResourceRequest) { r.Url = "/videos/1" }, "url must be an http or https URL"},
+		{"Script URL", func(r *ResourceRequest) { r.Url = "javascript:alert(1)" }, "url must be an http or https URL"},
+		{"Long URL", func(r *ResourceRequest) { r.Url = "https://example.com/" + strings.Repeat("a", 500) }, "url is longer than 500 characters"},
+		{"Bad thumbnail", func(r *ResourceRequest) { r.ThumbnailUrl = "ftp://example.com/a.png" }, "thumbnail_url must be an http or https URL"},
+		{"Missing type", func(r *ResourceRequest) { r.TypeID = 0 }, "type_id is required"},
+		{"Unknown skill level", func(r *ResourceRequest) { r.SkillLevel = "expert" }, "skill_level must be one of beginner, intermediate, advanced"},
+		{"Upper-case skill level", func(r *ResourceRequest) { r.SkillLevel = "Advanced" }, ""},
+		{"Negative tag", func(r *ResourceRequest) { r.TagIDs = []int{-1} }, "invalid tag id -1"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := valid()
+			tt.mutate(&req)
+			err := validateResourceRequest(&req)
+			observed := ""
+			if err != nil {
+				observed = err.Error()
+			}
+			if observed != tt.wantErr {
+				t.Errorf("validateResourceRequest() observed error = %q, expected: %q", observed, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateResourceRequestDefaults verifies omitted fields get the same
+// defaults as the resources table.
+func TestValidateResourceRequestDefaults(t *testing.T) {
+	t.Parallel()
+	req := ResourceRequest{Title: " Notes ", Url: " https://example.com/notes ", TypeID: 2, TagIDs: []int{4, 4, 2}}
+	if err := validateResourceRequest(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Title != "Notes" || req.Url != "https://example.com/notes" {
+		t.Errorf("observed title = %q, url = %q, expected trimmed values", req.Title, req.Url)
+	}
+	if req.SkillLevel != "beginner" || !*req.IsFree || !*req.IsActive || req.IsFeatured {
+		t.Errorf("observed defaults = %q free=%v active=%v featured=%v, expected: beginner, free, active, not featured",
+			req.SkillLevel, *req.IsFree, *req.IsActive, req.IsFeatured)
+	}
+	if len(req.TagIDs) != 2 || req.TagIDs[0] != 4 || req.TagIDs[1] != 2 {
+		t.Errorf("TagIDs observed = %v, expected: [4 2]", req.TagIDs)
+	}
+}
+
+// TestNormalizeTagIDsKeepsNil verifies an omitted tag list stays nil so PUT
+// leaves the tags alone, while an empty list clears them.
+func TestNormalizeTagIDsKeepsNil(t *testing.T) {
+	t.Parallel()
+	if ids, err := normalizeTagIDs(nil); ids != nil || err != nil {
+		t.Errorf("normalizeTagIDs(nil) observed = %v, %v, expected: nil, nil", ids, err)
+	}
+	if ids, err := normalizeTagIDs([]int{}); ids == nil || len(ids) != 0 || err != nil {
+		t.Errorf("normalizeTagIDs([]) observed = %v, %v, expected: [], nil", ids, err)
+	}
+}
+
+// TestValidateTagRequest verifies tag names, slugs and hex colors.
+func TestValidateTagRequest(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		req       ResourceTagRequest
+		wantErr   string
+		wantSlug  string
+		wantColor string
+	}{
+		{"Derived slug and default color", ResourceTagRequest{Name: "Quick Reference!"}, "", "quick-reference", "#6366f1"},
+		{"Upper-case color", ResourceTagRequest{Name: "Proofs", Color: "#A1B2C3"}, "", "proofs", "#a1b2c3"},
+		{"Missing name", ResourceTagRequest{Color: "#ffffff"}, "name is required", "", ""},
+		{"Short color", ResourceTagRequest{Name: "Proofs", Color: "#fff"}, "color must be a hex color such as #6366f1", "", ""},
+		{"Named color", ResourceTagRequest{Name: "Proofs", Color: "red"}, "color must be a hex color such as #6366f1", "", ""},
+		{"Bad slug", ResourceTagRequest{Name: "Proofs", Slug: "Proofs_2"}, "slug must be lowercase letters and digits separated by single dashes", "", ""},
+		{"Name without letters", ResourceTagRequest{Name: "!!!"}, "slug must be lowercase letters and digits separated by single dashes", "", ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := tt.req
+			err := validateTagRequest(&req)
+			observed := ""
+			if err != nil {
+				observed = err.Error()
+			}
+			if observed != tt.wantErr {
+				t.Fatalf("validateTagRequest() observed error = %q, expected: %q", observed, tt.wantErr)
+			}
+			if err == nil && (req.Slug != tt.wantSlug || req.Color != tt.wantColor) {
+				t.Errorf("observed slug = %q, color = %q, expected: %q, %q", req.Slug, req.Color, tt.wantSlug, tt.wantColor)
+			}
+		})
+	}
+}
+
+// TestAdminResourceHandlersValidate verifies bad IDs and payloads are refused
+// before reaching the database.
+func TestAdminResourceHandlersValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		id      string
+		body    string
+	}{
+		{"Create with bad URL", handleAdminResources, http.MethodPost, "", `{"title":"A","url":"nope","type_id":1}`},
+		{"Update with bad id", handleAdminResource, http.MethodPut, "x", `{}`},
+		{"Update with bad skill level", handleAdminResource, http.MethodPut, "1", `{"title":"A","url":"https://a.io","type_id":1,"skill_level":"guru"}`},
+		{"Deactivate bad id", handleAdminResourceActive(false), http.MethodPost, "0", ``},
+		{"Tags missing", handleAdminResourceTags, http.MethodPut, "1", `{}`},
+		{"Tags invalid", handleAdminResourceTags, http.MethodPut, "1", `{"tag_ids":[0]}`},
+		{"Tag with bad color", handleAdminResourceTagList, http.MethodPost, "", `{"name":"Proofs","color":"#12345g"}`},
+		{"Tag with bad id", handleAdminResourceTag, http.MethodDelete, "-3", ``},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(tt.method, "/api/admin/resources", strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
+			rr := httptest.NewRecorder()
+			tt.handler(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, observed: %d (%s)", http.StatusBadRequest, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
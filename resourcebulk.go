@@ -0,0 +1,615 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ======== Bulk Import and Export ========
+
+// ResourceRecord is one resource in an import or export file. Types and tags
+// are named by resource_types.name and resource_tags.slug so files stay
+// readable and portable between databases.
+type ResourceRecord struct {
+	Title        string   `json:"title" yaml:"title"`
+	Description  string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Url          string   `json:"url" yaml:"url"`
+	Type         string   `json:"type" yaml:"type"`
+	SkillLevel   string   `json:"skill_level,omitempty" yaml:"skill_level,omitempty"`
+	Author       string   `json:"author,omitempty" yaml:"author,omitempty"`
+	SourceName   string   `json:"source_name,omitempty" yaml:"source_name,omitempty"`
+	ThumbnailUrl string   `json:"thumbnail_url,omitempty" yaml:"thumbnail_url,omitempty"`
+	IsFree       *bool    `json:"is_free,omitempty" yaml:"is_free,omitempty"`
+	IsFeatured   *bool    `json:"is_featured,omitempty" yaml:"is_featured,omitempty"`
+	IsActive     *bool    `json:"is_active,omitempty" yaml:"is_active,omitempty"`
+	Tags         []string `json:"tags" yaml:"tags"`
+}
+
+// Resource file formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// resourceCSVColumns is the CSV header, in export order. Imports need title,
+// url and type; the other columns may be left out. Tags are separated by ";".
+var resourceCSVColumns = []string{
+	"title", "description", "url", "type", "skill_level", "author", "source_name",
+	"thumbnail_url", "is_free", "is_featured", "is_active", "tags",
+}
+
+// resourceImportChange is one resource an import creates or updates.
+type resourceImportChange struct {
+	id      int // 0 for new resources
+	req     ResourceRequest
+	changed []string // fields that differ, for updates
+	kept    []string // omitted flags kept at a non-default value, for updates
+}
+
+// resourceImportPlan is what an import would do, computed before anything is
+// written so it can be shown as a dry run.
+type resourceImportPlan struct {
+	creates   []resourceImportChange
+	updates   []resourceImportChange
+	unchanged int
+}
+
+// ======== Formats ========
+
+// resourceFormat picks the format from an explicit flag or, failing that,
+// from the file extension.
+func resourceFormat(format, path string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = FormatCSV
+		case ".json":
+			format = FormatJSON
+		case ".yaml", ".yml":
+			format = FormatYAML
+		default:
+			return "", errors.New("cannot tell the format from the file name; pass -format csv, json or yaml")
+		}
+	}
+	switch format {
+	case FormatCSV, FormatJSON, FormatYAML:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format %q; use csv, json or yaml", format)
+}
+
+// readResourceRecords decodes every record of r in format. Unknown fields
+// and columns are rejected so typos in a spreadsheet header do not silently
+// drop data.
+func readResourceRecords(r io.Reader, format string) ([]ResourceRecord, error) {
+	var records []ResourceRecord
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&records); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	case FormatYAML:
+		dec := yaml.NewDecoder(r)
+		dec.KnownFields(true)
+		if err := dec.Decode(&records); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+	case FormatCSV:
+		return readResourceCSV(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return records, nil
+}
+
+// readResourceCSV decodes a CSV file with a header row. Empty boolean cells
+// are left unset, like omitted fields in JSON and YAML.
+func readResourceCSV(r io.Reader) ([]ResourceRecord, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	known := map[string]bool{}
+	for _, c := range resourceCSVColumns {
+		known[c] = true
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		col[name] = i
+	}
+	for _, required := range []string{"title", "url", "type"} {
+		if _, ok := col[required]; !ok {
+			return nil, fmt.Errorf("CSV is missing the %q column", required)
+		}
+	}
+
+	var records []ResourceRecord
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		cell := func(name string) string {
+			if i, ok := col[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		rec := ResourceRecord{
+			Title:        cell("title"),
+			Description:  cell("description"),
+			Url:          cell("url"),
+			Type:         cell("type"),
+			SkillLevel:   cell("skill_level"),
+			Author:       cell("author"),
+			SourceName:   cell("source_name"),
+			ThumbnailUrl: cell("thumbnail_url"),
+		}
+		for name, dst := range map[string]**bool{"is_free": &rec.IsFree, "is_featured": &rec.IsFeatured, "is_active": &rec.IsActive} {
+			if s := cell(name); s != "" {
+				b, err := strconv.ParseBool(s)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s must be true or false", line, name)
+				}
+				*dst = &b
+			}
+		}
+		if _, ok := col["tags"]; ok {
+			rec.Tags = []string{}
+			for _, t := range strings.Split(cell("tags"), ";") {
+				if t = strings.TrimSpace(t); t != "" {
+					rec.Tags = append(rec.Tags, t)
+				}
+			}
+		}
+		records = append(records, rec)
+	}
+}
+
+// writeResourceRecords encodes records to w in format.
+func writeResourceRecords(w io.Writer, format string, records []ResourceRecord) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case FormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(records); err != nil {
+			return err
+		}
+		return enc.Close()
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(resourceCSVColumns); err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if err := cw.Write([]string{
+				rec.Title, rec.Description, rec.Url, rec.Type, rec.SkillLevel, rec.Author, rec.SourceName,
+				rec.ThumbnailUrl, formatBoolPtr(rec.IsFree), formatBoolPtr(rec.IsFeatured), formatBoolPtr(rec.IsActive),
+				strings.Join(rec.Tags, ";"),
+			}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// formatBoolPtr writes an optional boolean as a CSV cell.
+func formatBoolPtr(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+// ======== Planning ========
+
+// normalizeResourceURL returns the key that identifies a resource across
+// imports: scheme and host lowercased, default ports, fragments and trailing
+// slashes dropped, and query parameters sorted. Two spellings of the same
+// link map to the same resource.
+func normalizeResourceURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q", raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	u.Host = host
+	u.User = nil
+	u.Fragment, u.RawFragment = "", ""
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	u.RawQuery = u.Query().Encode()
+	return u.String(), nil
+}
+
+// resourceRequestFromRecord resolves the type and tag names of rec and
+// validates the result like the admin API does.
+func resourceRequestFromRecord(rec ResourceRecord, types, tags map[string]int) (ResourceRequest, error) {
+	req := ResourceRequest{
+		Title:        rec.Title,
+		Description:  rec.Description,
+		Url:          rec.Url,
+		SkillLevel:   rec.SkillLevel,
+		Author:       rec.Author,
+		SourceName:   rec.SourceName,
+		ThumbnailUrl: rec.ThumbnailUrl,
+		IsFree:       rec.IsFree,
+		IsActive:     rec.IsActive,
+		IsFeatured:   rec.IsFeatured != nil && *rec.IsFeatured,
+	}
+	typeName := strings.ToLower(strings.TrimSpace(rec.Type))
+	if typeName == "" {
+		return req, errors.New("type is required")
+	}
+	id, ok := types[typeName]
+	if !ok {
+		return req, fmt.Errorf("%w %q", errUnknownResourceType, rec.Type)
+	}
+	req.TypeID = id
+	if rec.Tags != nil {
+		req.TagIDs = []int{}
+		for _, slug := range rec.Tags {
+			id, ok := tags[strings.ToLower(strings.TrimSpace(slug))]
+			if !ok {
+				return req, fmt.Errorf("%w %q", errUnknownResourceTag, slug)
+			}
+			req.TagIDs = append(req.TagIDs, id)
+		}
+	}
+	return req, validateResourceRequest(&req)
+}
+
+// keepResourceFlags fills the flags rec leaves out from current, so an update
+// does not reset them to the defaults of new resources. It returns the filled
+// flags whose value differs from that default, as "name=value".
+func keepResourceFlags(rec *ResourceRecord, current AdminResource) []string {
+	var kept []string
+	for _, f := range []struct {
+		name     string
+		dst      **bool
+		value    bool
+		fallback bool
+	}{
+		{"is_free", &rec.IsFree, current.Is_free, true},
+		{"is_featured", &rec.IsFeatured, current.Is_featured, false},
+		{"is_active", &rec.IsActive, current.Is_active, true},
+	} {
+		if *f.dst != nil {
+			continue
+		}
+		v := f.value
+		*f.dst = &v
+		if v != f.fallback {
+			kept = append(kept, fmt.Sprintf("%s=%t", f.name, v))
+		}
+	}
+	return kept
+}
+
+// diffResource lists the fields of existing that req would change. Tags are
+// compared as sets and only when req sets them.
+func diffResource(existing AdminResource, req ResourceRequest) []string {
+	var changed []string
+	add := func(field string, differs bool) {
+		if differs {
+			changed = append(changed, field)
+		}
+	}
+	add("title", existing.Title != req.Title)
+	add("description", existing.Description != req.Description)
+	add("type", existing.Type_id != req.TypeID)
+	add("skill_level", existing.Skill_level != req.SkillLevel)
+	add("author", existing.Author != req.Author)
+	add("source_name", existing.Source_name != req.SourceName)
+	add("thumbnail_url", existing.Thumbnail_url != req.ThumbnailUrl)
+	add("is_free", existing.Is_free != *req.IsFree)
+	add("is_featured", existing.Is_featured != req.IsFeatured)
+	add("is_active", existing.Is_active != *req.IsActive)
+	if req.TagIDs != nil {
+		a := append([]int(nil), existing.TagIDs...)
+		b := append([]int(nil), req.TagIDs...)
+		sort.Ints(a)
+		sort.Ints(b)
+		add("tags", fmt.Sprint(a) != fmt.Sprint(b))
+	}
+	return changed
+}
+
+// planResourceImport matches records to existing resources by normalized URL
+// and works out what to create and update. It fails on the first invalid
+// record, or when a file lists the same URL twice, so nothing is written
+// from a file with mistakes.
+func planResourceImport(records []ResourceRecord, existing []AdminResource, types, tags map[string]int) (*resourceImportPlan, error) {
+	byURL := map[string]AdminResource{}
+	for _, r := range existing {
+		if key, err := normalizeResourceURL(r.Url); err == nil {
+			byURL[key] = r
+		}
+	}
+
+	plan := &resourceImportPlan{}
+	seen := map[string]int{}
+	for i, rec := range records {
+		n := i + 1
+		var kept []string
+		if key, err := normalizeResourceURL(rec.Url); err == nil {
+			if current, ok := byURL[key]; ok {
+				kept = keepResourceFlags(&rec, current)
+			}
+		}
+		req, err := resourceRequestFromRecord(rec, types, tags)
+		if err != nil {
+			return nil, fmt.Errorf("record %d (%s): %w", n, rec.Url, err)
+		}
+		key, err := normalizeResourceURL(req.Url)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", n, err)
+		}
+		if first, dup := seen[key]; dup {
+			return nil, fmt.Errorf("record %d (%s): same URL as record %d", n, rec.Url, first)
+		}
+		seen[key] = n
+
+		current, ok := byURL[key]
+		if !ok {
+			plan.creates = append(plan.creates, resourceImportChange{req: req})
+			continue
+		}
+		// Spellings that normalize alike are the same link; keep the stored one.
+		req.Url = current.Url
+		if changed := diffResource(current, req); len(changed) > 0 {
+			plan.updates = append(plan.updates, resourceImportChange{id: current.ID, req: req, changed: changed, kept: kept})
+		} else {
+			plan.unchanged++
+		}
+	}
+	return plan, nil
+}
+
+// print writes the plan as a diff: "+" for new resources and "~" for updated
+// ones with the fields that change and the omitted flags they keep.
+func (p *resourceImportPlan) print(w io.Writer) {
+	for _, c := range p.creates {
+		fmt.Fprintf(w, "+ %s  %s\n", c.req.Url, c.req.Title)
+	}
+	for _, c := range p.updates {
+		kept := ""
+		if len(c.kept) > 0 {
+			kept = "; keeps " + strings.Join(c.kept, ", ")
+		}
+		fmt.Fprintf(w, "~ %s  #%d (%s%s)\n", c.req.Url, c.id, strings.Join(c.changed, ", "), kept)
+	}
+	fmt.Fprintf(w, "%d to create, %d to update, %d unchanged\n", len(p.creates), len(p.updates), p.unchanged)
+}
+
+// ======== DB Functions ========
+
+// resourceNameMaps returns resource type names and tag slugs mapped to IDs,
+// and the reverse maps for exports.
+func resourceNameMaps() (types, tags map[string]int, typeNames, tagSlugs map[int]string, err error) {
+	allTypes, err := GetResourceTypes()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	allTags, err := GetResourceTags()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	types, tags = map[string]int{}, map[string]int{}
+	typeNames, tagSlugs = map[int]string{}, map[int]string{}
+	for _, t := range allTypes {
+		types[strings.ToLower(t.Name)] = t.ID
+		typeNames[t.ID] = t.Name
+	}
+	for _, t := range allTags {
+		tags[t.Slug] = t.ID
+		tagSlugs[t.ID] = t.Slug
+	}
+	return types, tags, typeNames, tagSlugs, nil
+}
+
+// applyResourceImport writes plan in one transaction.
+func applyResourceImport(plan *resourceImportPlan) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, c := range plan.creates {
+		if _, err := insertResource(tx, c.req); err != nil {
+			return fmt.Errorf("%s: %w", c.req.Url, err)
+		}
+	}
+	for _, c := range plan.updates {
+		if err := rewriteResource(tx, c.id, c.req); err != nil {
+			return fmt.Errorf("%s: %w", c.req.Url, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// exportResourceRecords returns every resource, oldest first, as records.
+func exportResourceRecords() ([]ResourceRecord, error) {
+	resources, err := getAdminResources(0)
+	if err != nil {
+		return nil, err
+	}
+	_, _, typeNames, tagSlugs, err := resourceNameMaps()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]ResourceRecord, 0, len(resources))
+	for i := len(resources) - 1; i >= 0; i-- {
+		r := resources[i]
+		rec := ResourceRecord{
+			Title:        r.Title,
+			Description:  r.Description,
+			Url:          r.Url,
+			Type:         typeNames[r.Type_id],
+			SkillLevel:   r.Skill_level,
+			Author:       r.Author,
+			SourceName:   r.Source_name,
+			ThumbnailUrl: r.Thumbnail_url,
+			IsFree:       &r.Is_free,
+			IsFeatured:   &r.Is_featured,
+			IsActive:     &r.Is_active,
+			Tags:         []string{},
+		}
+		for _, id := range r.TagIDs {
+			rec.Tags = append(rec.Tags, tagSlugs[id])
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// ======== Commands ========
+
+// parseResourceFlags parses the flags shared by the resources commands and
+// returns the format and the file argument ("-" for standard input/output).
+func parseResourceFlags(name string, args []string, withDryRun bool) (format, path string, dryRun bool, err error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&format, "format", "", "csv, json or yaml")
+	if withDryRun {
+		fs.BoolVar(&dryRun, "dry-run", false, "print the changes without writing them")
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", "", false, err
+	}
+	switch fs.NArg() {
+	case 0:
+		if withDryRun {
+			return "", "", false, errors.New("missing file")
+		}
+		path = "-"
+	case 1:
+		path = fs.Arg(0)
+	default:
+		return "", "", false, errors.New("too many arguments")
+	}
+	if path == "-" && format == "" {
+		format = FormatJSON
+	}
+	format, err = resourceFormat(format, path)
+	return format, path, dryRun, err
+}
+
+// checkResourcesImportArgs validates "resources import" arguments.
+func checkResourcesImportArgs(args []string) error {
+	_, _, _, err := parseResourceFlags("resources import", args, true)
+	return err
+}
+
+// checkResourcesExportArgs validates "resources export" arguments.
+func checkResourcesExportArgs(args []string) error {
+	_, _, _, err := parseResourceFlags("resources export", args, false)
+	return err
+}
+
+// cliImportResources implements "g6labs resources import". It always prints
+// the diff; with -dry-run it stops there.
+func cliImportResources(args []string, stdout io.Writer) error {
+	format, path, dryRun, err := parseResourceFlags("resources import", args, true)
+	if err != nil {
+		return err
+	}
+	in := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	records, err := readResourceRecords(in, format)
+	if err != nil {
+		return err
+	}
+
+	existing, err := getAdminResources(0)
+	if err != nil {
+		return err
+	}
+	types, tags, _, _, err := resourceNameMaps()
+	if err != nil {
+		return err
+	}
+	plan, err := planResourceImport(records, existing, types, tags)
+	if err != nil {
+		return err
+	}
+	plan.print(stdout)
+	if dryRun {
+		fmt.Fprintln(stdout, "dry run: nothing written")
+		return nil
+	}
+	return applyResourceImport(plan)
+}
+
+// cliExportResources implements "g6labs resources export".
+func cliExportResources(args []string, stdout io.Writer) error {
+	format, path, _, err := parseResourceFlags("resources export", args, false)
+	if err != nil {
+		return err
+	}
+	records, err := exportResourceRecords()
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		return writeResourceRecords(stdout, format, records)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeResourceRecords(f, format, records); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "exported %d resources to %s\n", len(records), path)
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestNormalizeResourceURL verifies spellings of the same link share a key.
+func TestNormalizeResourceURL(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in, expected string
+	}{
+		{"https://Example.COM/Path/", "https://example.com/Path"},
+		{"https://example.com:443/a#section", "https://example.com/a"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https://example.com", "https://example.com"},
+		{"https://example.com/", "https://example.com"},
+		{"https://example.com/watch?v=1&list=2", "https://example.com/watch?list=2&v=1"},
+		{" https://user:pw@example.com/a ", "https://example.com/a"},
+	}
+	for _, tt := range tests {
+		observed, err := normalizeResourceURL(tt.in)
+		if err != nil || observed != tt.expected {
+			t.Errorf("normalizeResourceURL(%q) observed = %q, %v, expected: %q", tt.in, observed, err, tt.expected)
+		}
+	}
+	if _, err := normalizeResourceURL("not a url"); err == nil {
+		t.Error("normalizeResourceURL() observed no error for a URL without host")
+	}
+}
+
+// TestResourceRecordsRoundTrip verifies every format reads back what it wrote.
+func TestResourceRecordsRoundTrip(t *testing.T) {
+	t.Parallel()
+	yes, no := true, false
+	records := []ResourceRecord{
+		{Title: "Essence, part 1", Description: "Vectors; \"what are they?\"", Url: "https://a.io/1", Type: "video",
+			SkillLevel: "beginner", Author: "Grant", IsFree: &yes, IsFeatured: &no, IsActive: &yes, Tags: []string{"visual-learning", "intuition"}},
+		{Title: "Notes", Url: "https://b.io", Type: "article", IsFree: &no, IsFeatured: &yes, IsActive: &no, Tags: []string{}},
+	}
+	for _, format := range []string{FormatCSV, FormatJSON, FormatYAML} {
+		var buf bytes.Buffer
+		if err := writeResourceRecords(&buf, format, records); err != nil {
+			t.Fatalf("%s: writeResourceRecords() observed error = %v", format, err)
+		}
+		observed, err := readResourceRecords(&buf, format)
+		if err != nil {
+			t.Fatalf("%s: readResourceRecords() observed error = %v", format, err)
+		}
+		if !reflect.DeepEqual(observed, records) {
+			t.Errorf("%s: observed = %+v, expected: %+v", format, observed, records)
+		}
+	}
+}
+
+// TestReadResourceRecordsRejectsUnknownFields verifies typos are reported
+// instead of silently dropping data.
+func TestReadResourceRecordsRejectsUnknownFields(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		format, body, wantErr string
+	}{
+		{FormatCSV, "title,url,typ\nA,https://a.io,video\n", `unknown CSV column "typ"`},
+		{FormatCSV, "title,url\nA,https://a.io\n", `CSV is missing the "type" column`},
+		{FormatCSV, "title,url,type,is_free\nA,https://a.io,video,maybe\n", "line 2: is_free must be true or false"},
+		{FormatJSON, `[{"title":"A","url":"https://a.io","type":"video","tag":["x"]}]`, `unknown field "tag"`},
+		{FormatYAML, "- title: A\n  url: https://a.io\n  kind: video\n", "field kind not found"},
+	}
+	for _, tt := range tests {
+		_, err := readResourceRecords(strings.NewReader(tt.body), tt.format)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: readResourceRecords() observed error = %v, expected to contain: %q", tt.format, err, tt.wantErr)
+		}
+	}
+}
+
+// TestPlanResourceImport verifies records are matched by normalized URL and
+// split into creates, updates and unchanged rows.
+func TestPlanResourceImport(t *testing.T) {
+	t.Parallel()
+	types := map[string]int{"video": 5, "article": 2}
+	tags := map[string]int{"practice": 2, "theory": 3}
+	existing := []AdminResource{
+		{Resource: Resource{ID: 10, Title: "Same", Url: "https://same.io/a", Type_id: 5, Skill_level: "beginner", Is_free: true, Is_active: true}, TagIDs: []int{3, 2}},
+		{Resource: Resource{ID: 11, Title: "Old title", Url: "https://changed.io/b", Type_id: 2, Skill_level: "beginner", Is_free: true, Is_active: true}, TagIDs: []int{}},
+		{Resource: Resource{ID: 12, Title: "Hidden", Url: "https://hidden.io", Type_id: 2, Skill_level: "beginner", Is_featured: true}, TagIDs: []int{}},
+	}
+	records := []ResourceRecord{
+		{Title: "Same", Url: "HTTPS://same.io/a/", Type: "Video", Tags: []string{"practice", "theory"}},
+		{Title: "New title", Url: "https://changed.io/b", Type: "article", SkillLevel: "advanced"},
+		{Title: "Brand new", Url: "https://new.io", Type: "video"},
+		{Title: "Still hidden", Url: "https://hidden.io", Type: "article"},
+	}
+
+	plan, err := planResourceImport(records, existing, types, tags)
+	if err != nil {
+		t.Fatalf("planResourceImport() observed error = %v", err)
+	}
+	if len(plan.creates) != 1 || plan.creates[0].req.Url != "https://new.io" {
+		t.Errorf("creates observed = %+v, expected: https://new.io", plan.creates)
+	}
+	if len(plan.updates) != 2 || plan.updates[0].id != 11 ||
+		!reflect.DeepEqual(plan.updates[0].changed, []string{"title", "skill_level"}) {
+		t.Errorf("updates observed = %+v, expected #11 changing title and skill_level", plan.updates)
+	}
+	if plan.unchanged != 1 {
+		t.Errorf("unchanged observed = %d, expected: 1", plan.unchanged)
+	}
+
+	// Flags a record leaves out keep their current values on update.
+	if len(plan.updates) == 2 {
+		hidden := plan.updates[1]
+		if !reflect.DeepEqual(hidden.changed, []string{"title"}) ||
+			*hidden.req.IsFree || !hidden.req.IsFeatured || *hidden.req.IsActive {
+			t.Errorf("update of #12 observed = %+v, expected only the title to change", hidden)
+		}
+	}
+	if req := plan.creates[0].req; !*req.IsFree || req.IsFeatured || !*req.IsActive {
+		t.Errorf("create observed = %+v, expected the defaults for new resources", req)
+	}
+
+	var buf bytes.Buffer
+	plan.print(&buf)
+	if !strings.Contains(buf.String(), "#12 (title; keeps is_free=false, is_featured=true, is_active=false)") {
+		t.Errorf("print() observed = %q, expected the kept flags of #12", buf.String())
+	}
+	if !strings.Contains(buf.String(), "1 to create, 2 to update, 1 unchanged") {
+		t.Errorf("print() observed = %q, expected a summary line", buf.String())
+	}
+}
+
+// TestPlanResourceImportErrors verifies a bad record stops the whole import.
+func TestPlanResourceImportErrors(t *testing.T) {
+	t.Parallel()
+	types := map[string]int{"video": 5}
+	tags := map[string]int{"practice": 2}
+	tests := []struct {
+		name    string
+		records []ResourceRecord
+		wantErr string
+	}{
+		{"Unknown type", []ResourceRecord{{Title: "A", Url: "https://a.io", Type: "movie"}}, `record 1 (https://a.io): unknown resource type "movie"`},
+		{"Unknown tag", []ResourceRecord{{Title: "A", Url: "https://a.io", Type: "video", Tags: []string{"nope"}}}, `unknown tag "nope"`},
+		{"Invalid URL", []ResourceRecord{{Title: "A", Url: "a.io", Type: "video"}}, "url must be an http or https URL"},
+		{"Duplicate URL", []ResourceRecord{
+			{Title: "A", Url: "https://a.io/x", Type: "video"},
+			{Title: "B", Url: "https://A.io/x/", Type: "video"},
+		}, "record 2 (https://A.io/x/): same URL as record 1"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := planResourceImport(tt.records, nil, types, tags)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("planResourceImport() observed error = %v, expected to contain: %q", err, tt.wantErr)
+			}
+		})
+	}
+}
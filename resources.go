@@ -1,7 +1,11 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -40,10 +44,81 @@ type Resource struct {
 	Is_featured   bool      `json:"is_featured"`
 	Is_active     bool      `json:"is_active"`
 	View_count    int       `json:"view_count"`
+	Rating_avg    float64   `json:"rating_avg"`
+	Rating_count  int       `json:"rating_count"`
+	Is_bookmarked bool      `json:"is_bookmarked"` // by the current user
 	Created_at    time.Time `json:"created_at"`
 	Updated_at    time.Time `json:"updated_at"`
 }
 
+// ResourceQuery holds the filters, order and page of a resource listing.
+type ResourceQuery struct {
+	Skill string
+	Types []int
+	Tags  []int
+	// TagMode is TagModeAny to match resources with any of Tags, or
+	// TagModeAll to require all of them.
+	TagMode     string
+	ExcludeTags []int // resources with any of these tags are left out
+	Search      string
+	Sort        string // "relevance" or a key of resourceSorts; "" picks the default
+	Limit       int
+	Offset      int
+	Facets      bool // whether to count matches per filter value
+}
+
+// Tag filter modes of ResourceQuery.
+const (
+	TagModeAny = "any"
+	TagModeAll = "all"
+)
+
+// ResourcePage is one page of a resource listing. Total counts every match,
+// not just this page.
+type ResourcePage struct {
+	Items   []Resource      `json:"items"`
+	Total   int             `json:"total"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+	Sort    string          `json:"sort"` // the order applied
+	HasMore bool            `json:"has_more"`
+	Facets  *ResourceFacets `json:"facets,omitempty"`
+}
+
+// ResourceFacets counts the matches of a listing per skill level, type ID
+// and tag ID. Each facet ignores its own filter (except tags in "all"
+// mode), so the counts show what choosing another value of it would return.
+// Values without matches are left out.
+type ResourceFacets struct {
+	SkillLevels map[string]int `json:"skill_levels"`
+	Types       map[int]int    `json:"types"`
+	Tags        map[int]int    `json:"tags"`
+}
+
+// resourceColumns selects a Resource from resources r for scanResource. Its
+// one placeholder takes the viewer's user ID (0 when logged out) for
+// is_bookmarked.
+const resourceColumns = `r.id, r.title, COALESCE(r.description,''), r.url,
+        r.type_id, r.skill_level, COALESCE(r.author,''),
+        COALESCE(r.source_name,''), COALESCE(r.thumbnail_url,''),
+        r.is_free, r.is_featured, r.is_active, r.view_count,
+        r.rating_avg, r.rating_count,
+        EXISTS (SELECT 1 FROM resource_bookmarks b WHERE b.resource_id = r.id AND b.user_id = ?),
+        r.created_at, r.updated_at`
+
+// scanResource scans a row selected with resourceColumns, followed by any
+// extra destinations.
+func scanResource(rows *sql.Rows, extra ...any) (Resource, error) {
+	var r Resource
+	dest := []any{&r.ID, &r.Title, &r.Description, &r.Url,
+		&r.Type_id, &r.Skill_level, &r.Author, &r.Source_name,
+		&r.Thumbnail_url, &r.Is_free, &r.Is_featured, &r.Is_active,
+		&r.View_count, &r.Rating_avg, &r.Rating_count, &r.Is_bookmarked,
+		&r.Created_at, &r.Updated_at}
+	err := rows.Scan(append(dest, extra...)...)
+	return r, err
+}
+
 // ======== DB Functions ========
 
 // GetResourceTypes returns all resource categories available for filtering.
@@ -84,69 +159,141 @@ func GetResourceTags() ([]ResourceTag, error) {
 	return tags, rows.Err()
 }
 
-// GetResources returns active resources filtered by optional skill level, type IDs,
-// tag IDs, and search text.
+const (
+	defaultResourceLimit = 50
+	maxResourceLimit     = 100
+)
+
+// resourceSorts maps sort names to ORDER BY clauses. Each ends with r.id so
+// pages never overlap or skip rows. "relevance" is added separately because
+// its score needs the search text.
+var resourceSorts = map[string]string{
+	"newest": "r.created_at DESC, r.id DESC",
+	"views":  "r.view_count DESC, r.id",
+	"title":  "r.title, r.id",
+	"rating": "r.rating_avg DESC, r.rating_count DESC, r.id",
+}
+
+// fullTextSearch reports whether search uses FULLTEXT matching; shorter
+// queries fall back to LIKE because FULLTEXT ignores very short words.
+func fullTextSearch(search string) bool {
+	return len(search) >= 3
+}
+
+// resourceSort returns the order applied for a requested sort: "relevance"
+// when searching with FULLTEXT and no sort was asked for, "newest" when
+// relevance is asked for without a FULLTEXT search.
+func resourceSort(sort, search string) string {
+	if sort == "" {
+		sort = "relevance"
+	}
+	if sort == "relevance" && !fullTextSearch(search) {
+		sort = "newest"
+	}
+	return sort
+}
+
+// resourceWhere builds the WHERE clause shared by resource listings and
+// counts. It selects active resources matching every filter of q.
 //
 // Search behavior:
 // - queries shorter than 3 characters use LIKE matching
 // - longer queries use FULLTEXT MATCH ... AGAINST
-func GetResources(skill string, types []int, tags []int, search string) ([]Resource, error) {
-	query := `
-        SELECT DISTINCT r.id, r.title, COALESCE(r.description,''), r.url,
-        r.type_id, r.skill_level, COALESCE(r.author,''),
-        COALESCE(r.source_name,''), COALESCE(r.thumbnail_url,''),
-        r.is_free, r.is_featured, r.is_active, r.view_count,
-        r.created_at, r.updated_at
-        FROM resources r
-        LEFT JOIN resource_tag_map rtm ON r.id = rtm.resource_id
-        WHERE r.is_active = TRUE
-    `
-
+func resourceWhere(q ResourceQuery) (string, []interface{}) {
+	where := " WHERE r.is_active = TRUE"
 	var args []interface{}
 
 	// search filter - try FULLTEXT first, fallback to LIKE if needed
 	// columns must exactly match the FULLTEXT INDEX idx_search (title, description, author, source_name)
-	if search != "" {
-		// Use LIKE for short queries (FULLTEXT has minimum word length) or as fallback
-		if len(search) < 3 {
+	if q.Search != "" {
+		if !fullTextSearch(q.Search) {
 			// LIKE search for short terms
-			query += " AND (r.title LIKE ? OR r.description LIKE ? OR r.author LIKE ? OR r.source_name LIKE ?)"
-			pattern := "%" + search + "%"
+			where += " AND (r.title LIKE ? OR r.description LIKE ? OR r.author LIKE ? OR r.source_name LIKE ?)"
+			pattern := "%" + q.Search + "%"
 			args = append(args, pattern, pattern, pattern, pattern)
 		} else {
 			// FULLTEXT search for longer terms
-			query += " AND MATCH(r.title, r.description, r.author, r.source_name) AGAINST(? IN NATURAL LANGUAGE MODE)"
-			args = append(args, search)
+			where += " AND MATCH(r.title, r.description, r.author, r.source_name) AGAINST(? IN NATURAL LANGUAGE MODE)"
+			args = append(args, q.Search)
 		}
 	}
 
 	// add skill level to query when selected
-	if skill != "" {
-		query += " AND r.skill_level = ?"
-		args = append(args, skill)
+	if q.Skill != "" {
+		where += " AND r.skill_level = ?"
+		args = append(args, q.Skill)
 	}
 
 	// add types to query when selected
-	if len(types) > 0 {
-		placeholders := strings.Repeat("?,", len(types))
+	if len(q.Types) > 0 {
+		placeholders := strings.Repeat("?,", len(q.Types))
+		placeholders = placeholders[:len(placeholders)-1] // remove trailing comma
+		where += " AND r.type_id IN (" + placeholders + ")"
+
+		for _, t := range q.Types {
+			args = append(args, t)
+		}
+	}
+
+	// add tags to query when selected; subqueries rather than a join keep one
+	// row per resource, so counts and ordering need no DISTINCT. Tags must
+	// be free of duplicates for the "all" count to work.
+	if len(q.Tags) > 0 {
+		placeholders := strings.Repeat("?,", len(q.Tags))
 		placeholders = placeholders[:len(placeholders)-1] // remove trailing comma
-		query += " AND r.type_id IN (" + placeholders + ")"
+		if q.TagMode == TagModeAll {
+			where += " AND (SELECT COUNT(*) FROM resource_tag_map rtm WHERE rtm.resource_id = r.id AND rtm.tag_id IN (" + placeholders + ")) = ?"
+		} else {
+			where += " AND EXISTS (SELECT 1 FROM resource_tag_map rtm WHERE rtm.resource_id = r.id AND rtm.tag_id IN (" + placeholders + "))"
+		}
 
-		for _, t := range types {
+		for _, t := range q.Tags {
 			args = append(args, t)
 		}
+		if q.TagMode == TagModeAll {
+			args = append(args, len(q.Tags))
+		}
 	}
 
-	// add tags to query when selected
-	if len(tags) > 0 {
-		placeholders := strings.Repeat("?,", len(tags))
+	// leave out resources with any excluded tag
+	if len(q.ExcludeTags) > 0 {
+		placeholders := strings.Repeat("?,", len(q.ExcludeTags))
 		placeholders = placeholders[:len(placeholders)-1] // remove trailing comma
-		query += " AND rtm.tag_id IN (" + placeholders + ")"
+		where += " AND NOT EXISTS (SELECT 1 FROM resource_tag_map xtm WHERE xtm.resource_id = r.id AND xtm.tag_id IN (" + placeholders + "))"
 
-		for _, t := range tags {
+		for _, t := range q.ExcludeTags {
 			args = append(args, t)
 		}
 	}
+	return where, args
+}
+
+// GetResources returns one page of active resources matching q, with the
+// total number of matches. is_bookmarked is set for viewerID.
+func GetResources(q ResourceQuery, viewerID int) (*ResourcePage, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultResourceLimit
+	}
+	page := &ResourcePage{Items: []Resource{}, Limit: q.Limit, Offset: q.Offset, Sort: resourceSort(q.Sort, q.Search)}
+
+	where, whereArgs := resourceWhere(q)
+	if err := db.QueryRow("SELECT COUNT(*) FROM resources r"+where, whereArgs...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+	if q.Offset >= page.Total {
+		return page, nil
+	}
+
+	query := "SELECT " + resourceColumns + " FROM resources r" + where
+	args := append([]interface{}{viewerID}, whereArgs...)
+	if page.Sort == "relevance" {
+		query += " ORDER BY MATCH(r.title, r.description, r.author, r.source_name) AGAINST(? IN NATURAL LANGUAGE MODE) DESC, r.id"
+		args = append(args, q.Search)
+	} else {
+		query += " ORDER BY " + resourceSorts[page.Sort]
+	}
+	query += " LIMIT ? OFFSET ?"
+	args = append(args, q.Limit, q.Offset)
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
@@ -154,18 +301,87 @@ func GetResources(skill string, types []int, tags []int, search string) ([]Resou
 	}
 	defer rows.Close()
 
-	var resources []Resource
 	for rows.Next() {
-		var r Resource
-		if err := rows.Scan(&r.ID, &r.Title, &r.Description, &r.Url,
-			&r.Type_id, &r.Skill_level, &r.Author, &r.Source_name,
-			&r.Thumbnail_url, &r.Is_free, &r.Is_featured, &r.Is_active,
-			&r.View_count, &r.Created_at, &r.Updated_at); err != nil {
+		r, err := scanResource(rows)
+		if err != nil {
 			return nil, err
 		}
-		resources = append(resources, r)
+		page.Items = append(page.Items, r)
+	}
+	page.HasMore = q.Offset+len(page.Items) < page.Total
+	return page, rows.Err()
+}
+
+// GetResourceFacets counts the active resources matching q per skill level,
+// type and tag. Like the filters themselves, each facet is counted with the
+// other filters applied but not its own, so selecting one type does not hide
+// the counts of the others. Tags in "all" mode are the exception: their
+// counts show what adding each tag would leave.
+func GetResourceFacets(q ResourceQuery) (*ResourceFacets, error) {
+	facets := &ResourceFacets{SkillLevels: map[string]int{}, Types: map[int]int{}, Tags: map[int]int{}}
+
+	noSkill := q
+	noSkill.Skill = ""
+	where, args := resourceWhere(noSkill)
+	err := countFacet("SELECT r.skill_level, COUNT(*) FROM resources r"+where+" GROUP BY r.skill_level", args,
+		func(rows *sql.Rows) error {
+			var level string
+			var n int
+			err := rows.Scan(&level, &n)
+			facets.SkillLevels[level] = n
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	noTypes := q
+	noTypes.Types = nil
+	where, args = resourceWhere(noTypes)
+	err = countFacet("SELECT r.type_id, COUNT(*) FROM resources r"+where+" GROUP BY r.type_id", args,
+		func(rows *sql.Rows) error {
+			var id, n int
+			err := rows.Scan(&id, &n)
+			facets.Types[id] = n
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// In "all" mode choosing another tag narrows the results, so the tag
+	// counts keep the tag filter; exclusions always apply.
+	noTags := q
+	if q.TagMode != TagModeAll {
+		noTags.Tags = nil
+	}
+	where, args = resourceWhere(noTags)
+	err = countFacet("SELECT tm.tag_id, COUNT(*) FROM resources r JOIN resource_tag_map tm ON tm.resource_id = r.id"+where+" GROUP BY tm.tag_id", args,
+		func(rows *sql.Rows) error {
+			var id, n int
+			err := rows.Scan(&id, &n)
+			facets.Tags[id] = n
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
+
+// countFacet runs a grouped count query and passes each row to scan.
+func countFacet(query string, args []interface{}, scan func(*sql.Rows) error) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
 	}
-	return resources, rows.Err()
+	return rows.Err()
 }
 
 // ======== HTTP Handlers ========
@@ -201,40 +417,107 @@ func handleGetResourceTags(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleGetResources serves GET /api/resources and applies query-string filters
-// for skill level, type IDs, tag IDs, and text search.
+// for skill level, type IDs, tag IDs, and text search, then returns one page
+// in the order given by sort, with limit and offset, and the facet counts
+// unless facets=false.
+// Logged-in callers see which results they bookmarked.
 func handleGetResources(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
 		return
 	}
 
-	skill := r.URL.Query().Get("skill_level")
-	search := r.URL.Query().Get("q")
+	q, err := parseResourceQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	viewerID, _ := requestUserID(r)
+	page, err := GetResources(q, viewerID)
 
-	var types []int
-	if typesStr := r.URL.Query().Get("types"); typesStr != "" {
-		for _, s := range strings.Split(typesStr, ",") {
-			if id, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
-				types = append(types, id)
-			}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if q.Facets {
+		if page.Facets, err = GetResourceFacets(q); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
 		}
 	}
 
-	var tags []int
-	if tagsStr := r.URL.Query().Get("tags"); tagsStr != "" {
-		for _, s := range strings.Split(tagsStr, ",") {
-			if id, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
-				tags = append(tags, id)
-			}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseIDList parses a comma-separated list of IDs, skipping duplicates and
+// entries that are not numbers.
+func parseIDList(s string) []int {
+	var ids []int
+	if s == "" {
+		return ids
+	}
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && !slices.Contains(ids, id) {
+			ids = append(ids, id)
 		}
 	}
+	return ids
+}
 
-	resources, err := GetResources(skill, types, tags, search)
+// parseResourceQuery reads the filters, sort and page of a resource listing
+// from the query string. Unparsable type and tag IDs are ignored.
+func parseResourceQuery(r *http.Request) (ResourceQuery, error) {
+	values := r.URL.Query()
+	q := ResourceQuery{
+		Skill:  values.Get("skill_level"),
+		Search: values.Get("q"),
+		Sort:   values.Get("sort"),
+		Limit:  defaultResourceLimit,
+		Facets: true,
+	}
 
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
-		return
+	q.Types = parseIDList(values.Get("types"))
+	q.Tags = parseIDList(values.Get("tags"))
+	q.ExcludeTags = parseIDList(values.Get("exclude_tags"))
+
+	q.TagMode = values.Get("tag_mode")
+	if q.TagMode == "" {
+		q.TagMode = TagModeAny
+	}
+	if q.TagMode != TagModeAny && q.TagMode != TagModeAll {
+		return q, errors.New("tag_mode must be all or any")
+	}
+	for _, id := range q.ExcludeTags {
+		if slices.Contains(q.Tags, id) {
+			return q, fmt.Errorf("tag %d cannot be both in tags and exclude_tags", id)
+		}
 	}
 
-	writeJSON(w, http.StatusOK, resources)
+	if _, ok := resourceSorts[q.Sort]; !ok && q.Sort != "" && q.Sort != "relevance" {
+		return q, errors.New("sort must be relevance, newest, views, title or rating")
+	}
+	if s := values.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxResourceLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxResourceLimit)
+		}
+		q.Limit = n
+	}
+	if s := values.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, errors.New("offset must be a non-negative integer")
+		}
+		q.Offset = n
+	}
+	if s := values.Get("facets"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, errors.New("facets must be true or false")
+		}
+		q.Facets = b
+	}
+	return q, nil
 }
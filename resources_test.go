@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseResourceQuery verifies listing parameters are parsed, defaulted
+// and bounded.
+func TestParseResourceQuery(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		query    string
+		expected ResourceQuery
+		wantErr  bool
+	}{
+		{"", ResourceQuery{TagMode: TagModeAny, Limit: defaultResourceLimit, Facets: true}, false},
+		{"skill_level=beginner&types=1,%202,x&tags=3&q=eigen&sort=views&limit=10&offset=20",
+			ResourceQuery{Skill: "beginner", Types: []int{1, 2}, Tags: []int{3}, TagMode: TagModeAny, Search: "eigen", Sort: "views", Limit: 10, Offset: 20, Facets: true}, false},
+		{"sort=relevance", ResourceQuery{TagMode: TagModeAny, Sort: "relevance", Limit: defaultResourceLimit, Facets: true}, false},
+		{"facets=false", ResourceQuery{TagMode: TagModeAny, Limit: defaultResourceLimit}, false},
+		{"tags=1,2,1&tag_mode=all&exclude_tags=7",
+			ResourceQuery{Tags: []int{1, 2}, TagMode: TagModeAll, ExcludeTags: []int{7}, Limit: defaultResourceLimit, Facets: true}, false},
+		{"tag_mode=every", ResourceQuery{}, true},
+		{"tags=1,2&exclude_tags=2", ResourceQuery{}, true},
+		{"facets=maybe", ResourceQuery{}, true},
+		{"sort=popular", ResourceQuery{}, true},
+		{"limit=0", ResourceQuery{}, true},
+		{"limit=101", ResourceQuery{}, true},
+		{"offset=-1", ResourceQuery{}, true},
+		{"offset=x", ResourceQuery{}, true},
+	}
+	for _, tt := range tests {
+		q, err := parseResourceQuery(httptest.NewRequest(http.MethodGet, "/api/resources?"+tt.query, nil))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseResourceQuery(%q) observed err = %v, expected error: %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(q, tt.expected) {
+			t.Errorf("parseResourceQuery(%q) observed = %+v, expected: %+v", tt.query, q, tt.expected)
+		}
+	}
+}
+
+// TestResourceSort verifies the default order and the relevance fallback.
+func TestResourceSort(t *testing.T) {
+	t.Parallel()
+	tests := []struct{ sort, search, expected string }{
+		{"", "", "newest"},
+		{"", "eigenvalues", "relevance"},
+		{"", "qr", "newest"},
+		{"relevance", "", "newest"},
+		{"relevance", "eigenvalues", "relevance"},
+		{"title", "eigenvalues", "title"},
+	}
+	for _, tt := range tests {
+		if observed := resourceSort(tt.sort, tt.search); observed != tt.expected {
+			t.Errorf("resourceSort(%q, %q) observed = %q, expected: %q", tt.sort, tt.search, observed, tt.expected)
+		}
+	}
+}
+
+// TestResourceWhere verifies each filter adds its condition with one
+// argument per placeholder.
+func TestResourceWhere(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		q        ResourceQuery
+		contains []string
+	}{
+		{ResourceQuery{}, []string{"r.is_active = TRUE"}},
+		{ResourceQuery{Search: "qr"}, []string{"r.title LIKE ?"}},
+		{ResourceQuery{Search: "eigen"}, []string{"MATCH(r.title, r.description, r.author, r.source_name) AGAINST(?"}},
+		{ResourceQuery{Skill: "advanced", Types: []int{1, 2}}, []string{"r.skill_level = ?", "r.type_id IN (?,?)"}},
+		{ResourceQuery{Tags: []int{4, 5, 6}}, []string{"EXISTS (SELECT 1 FROM resource_tag_map rtm", "rtm.tag_id IN (?,?,?)"}},
+		{ResourceQuery{Tags: []int{4, 5}, TagMode: TagModeAll}, []string{"rtm.tag_id IN (?,?)) = ?"}},
+		{ResourceQuery{ExcludeTags: []int{7}}, []string{"NOT EXISTS (SELECT 1 FROM resource_tag_map xtm", "xtm.tag_id IN (?)"}},
+	}
+	for _, tt := range tests {
+		where, args := resourceWhere(tt.q)
+		for _, s := range tt.contains {
+			if !strings.Contains(where, s) {
+				t.Errorf("resourceWhere(%+v) observed = %q, expected to contain: %q", tt.q, where, s)
+			}
+		}
+		if n := strings.Count(where, "?"); n != len(args) {
+			t.Errorf("resourceWhere(%+v) observed %d placeholders and %d args", tt.q, n, len(args))
+		}
+	}
+
+	// In "all" mode the last argument is how many tags must match.
+	_, args := resourceWhere(ResourceQuery{Tags: []int{4, 5}, TagMode: TagModeAll})
+	if !reflect.DeepEqual(args, []interface{}{4, 5, 2}) {
+		t.Errorf("resourceWhere(all of 4, 5) observed args = %v, expected: [4 5 2]", args)
+	}
+}
+
+// TestParseIDList verifies ID lists skip duplicates and non-numbers.
+func TestParseIDList(t *testing.T) {
+	t.Parallel()
+	tests := map[string][]int{
+		"":          nil,
+		"3":         {3},
+		"1, 2,x,,1": {1, 2},
+		"x,y":       nil,
+	}
+	for s, expected := range tests {
+		if observed := parseIDList(s); !reflect.DeepEqual(observed, expected) {
+			t.Errorf("parseIDList(%q) observed = %v, expected: %v", s, observed, expected)
+		}
+	}
+}
+
+// TestResourceSortsAreStable verifies every order ends with the resource ID,
+// so pages never overlap.
+func TestResourceSortsAreStable(t *testing.T) {
+	t.Parallel()
+	for name, order := range resourceSorts {
+		if !strings.HasSuffix(order, "r.id") && !strings.HasSuffix(order, "r.id DESC") {
+			t.Errorf("resourceSorts[%q] observed = %q, expected to end with r.id", name, order)
+		}
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ======== Types ========
+
+// Review is one user's rating of a resource, with an optional short text.
+type Review struct {
+	ID         int       `json:"id"`
+	ResourceID int       `json:"resource_id"`
+	AuthorName string    `json:"author_name"` // first name and last initial
+	Rating     int       `json:"rating"`
+	Body       string    `json:"body"`
+	Mine       bool      `json:"mine"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ReviewRequest is the JSON payload for creating or replacing the caller's
+// review of a resource.
+type ReviewRequest struct {
+	Rating int    `json:"rating"`
+	Body   string `json:"body"`
+}
+
+// ModerationReview is a review as shown in the moderation queue.
+type ModerationReview struct {
+	Review
+	ResourceTitle string   `json:"resource_title"`
+	UserID        int      `json:"user_id"`
+	Status        string   `json:"status"`
+	FlagCount     int      `json:"flag_count"`
+	FlagReasons   []string `json:"flag_reasons"`
+}
+
+// Review statuses. Hidden reviews are left out of listings and averages.
+const (
+	ReviewVisible = "visible"
+	ReviewHidden  = "hidden"
+)
+
+const (
+	minReviewRating    = 1
+	maxReviewRating    = 5
+	maxReviewBodyLen   = 1000 // characters
+	maxFlagReasonLen   = 255
+	maxReviewsListed   = 100
+	reviewQueueDefault = 50
+)
+
+var (
+	errReviewNotFound = errors.New("review not found")
+	errFlagOwnReview  = errors.New("you cannot flag your own review")
+	errAlreadyFlagged = errors.New("you have already flagged this review")
+	errReviewStatus   = errors.New("status must be visible or hidden")
+)
+
+// ======== Validation ========
+
+// validateReviewRequest checks a review payload and trims its text.
+func validateReviewRequest(req *ReviewRequest) error {
+	if req.Rating < minReviewRating || req.Rating > maxReviewRating {
+		return fmt.Errorf("rating must be between %d and %d", minReviewRating, maxReviewRating)
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if utf8.RuneCountInString(req.Body) > maxReviewBodyLen {
+		return fmt.Errorf("review is longer than %d characters", maxReviewBodyLen)
+	}
+	return nil
+}
+
+// normalizeFlagReason trims a flag reason and checks its length in
+// characters, as stored in review_flags.reason.
+func normalizeFlagReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > maxFlagReasonLen {
+		return "", fmt.Errorf("reason is longer than %d characters", maxFlagReasonLen)
+	}
+	return reason, nil
+}
+
+// reviewAuthorName shortens a name to "Ada L." so reviews do not publish
+// full names.
+func reviewAuthorName(first, last string) string {
+	first = strings.TrimSpace(first)
+	if r, _ := utf8.DecodeRuneInString(strings.TrimSpace(last)); r != utf8.RuneError {
+		return first + " " + string(r) + "."
+	}
+	return first
+}
+
+// ======== DB Functions ========
+
+// refreshResourceRating recomputes the rating aggregates of resourceID from
+// its visible reviews inside tx. They are stored on resources so listings
+// can sort by rating without joining reviews.
+func refreshResourceRating(tx *sql.Tx, resourceID int) error {
+	_, err := tx.Exec(`
+        UPDATE resources r SET
+            rating_avg = (SELECT COALESCE(AVG(rating), 0) FROM resource_reviews WHERE resource_id = r.id AND status = ?),
+            rating_count = (SELECT COUNT(*) FROM resource_reviews WHERE resource_id = r.id AND status = ?),
+            updated_at = updated_at
+        WHERE r.id = ?`,
+		ReviewVisible, ReviewVisible, resourceID,
+	)
+	return err
+}
+
+// saveReview creates or replaces userID's review of an active resource.
+// Editing a review keeps its moderation status, so a hidden review stays
+// hidden.
+func saveReview(userID, resourceID int, req ReviewRequest) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRow("SELECT id FROM resources WHERE id = ? AND is_active = TRUE FOR UPDATE", resourceID).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return errResourceNotFound
+		}
+		return err
+	}
+	if _, err := tx.Exec(`
+        INSERT INTO resource_reviews (resource_id, user_id, rating, body, created_at, updated_at)
+        VALUES (?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP())
+        ON DUPLICATE KEY UPDATE rating = VALUES(rating), body = VALUES(body), updated_at = VALUES(updated_at)`,
+		resourceID, userID, req.Rating, req.Body,
+	); err != nil {
+		return err
+	}
+	if err := refreshResourceRating(tx, resourceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteReview removes userID's review of resourceID.
+func deleteReview(userID, resourceID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM resource_reviews WHERE resource_id = ? AND user_id = ?", resourceID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errReviewNotFound
+	}
+	if err := refreshResourceRating(tx, resourceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getReviews returns the visible reviews of resourceID, newest first. The
+// review of viewerID, if any, is marked and listed even while hidden.
+func getReviews(resourceID, viewerID int) ([]Review, error) {
+	rows, err := db.Query(`
+        SELECT rv.id, rv.resource_id, u.first_name, u.last_name, rv.rating, rv.body,
+        rv.user_id = ?, rv.created_at, rv.updated_at
+        FROM resource_reviews rv JOIN users u ON u.id = rv.user_id
+        WHERE rv.resource_id = ? AND (rv.status = ? OR rv.user_id = ?)
+        ORDER BY rv.user_id = ? DESC, rv.updated_at DESC, rv.id DESC
+        LIMIT ?
+    `, viewerID, resourceID, ReviewVisible, viewerID, viewerID, maxReviewsListed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reviews := []Review{}
+	for rows.Next() {
+		var rv Review
+		var first, last string
+		if err := rows.Scan(&rv.ID, &rv.ResourceID, &first, &last, &rv.Rating, &rv.Body,
+			&rv.Mine, &rv.CreatedAt, &rv.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rv.AuthorName = reviewAuthorName(first, last)
+		reviews = append(reviews, rv)
+	}
+	return reviews, rows.Err()
+}
+
+// flagReview records userID's report of a visible review for moderators.
+func flagReview(userID, reviewID int, reason string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var author int
+	err = tx.QueryRow("SELECT user_id FROM resource_reviews WHERE id = ? AND status = ? FOR UPDATE", reviewID, ReviewVisible).Scan(&author)
+	if err == sql.ErrNoRows {
+		return errReviewNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if author == userID {
+		return errFlagOwnReview
+	}
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM review_flags WHERE review_id = ? AND user_id = ?", reviewID, userID).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return errAlreadyFlagged
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO review_flags (review_id, user_id, reason, created_at) VALUES (?, ?, ?, UTC_TIMESTAMP())",
+		reviewID, userID, reason,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getModerationQueue lists reviews for moderators. status "flagged" returns
+// visible reviews with open flags, most flagged first; "visible" and
+// "hidden" return reviews with that status, newest first.
+func getModerationQueue(status string, limit int) ([]ModerationReview, error) {
+	query := `
+        SELECT rv.id, rv.resource_id, r.title, rv.user_id, u.first_name, u.last_name,
+        rv.rating, rv.body, rv.status, COALESCE(f.n, 0), rv.created_at, rv.updated_at
+        FROM resource_reviews rv
+        JOIN resources r ON r.id = rv.resource_id
+        JOIN users u ON u.id = rv.user_id
+        LEFT JOIN (
+            SELECT review_id, COUNT(*) AS n FROM review_flags GROUP BY review_id
+        ) f ON f.review_id = rv.id
+    `
+	var args []interface{}
+	switch status {
+	case "flagged":
+		query += " WHERE rv.status = ? AND f.n > 0 ORDER BY f.n DESC, rv.id"
+		args = append(args, ReviewVisible)
+	case ReviewVisible, ReviewHidden:
+		query += " WHERE rv.status = ? ORDER BY rv.updated_at DESC, rv.id DESC"
+		args = append(args, status)
+	default:
+		return nil, errors.New("status must be flagged, visible or hidden")
+	}
+	query += " LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reviews := []ModerationReview{}
+	for rows.Next() {
+		var rv ModerationReview
+		var first, last string
+		if err := rows.Scan(&rv.ID, &rv.ResourceID, &rv.ResourceTitle, &rv.UserID, &first, &last,
+			&rv.Rating, &rv.Body, &rv.Status, &rv.FlagCount, &rv.CreatedAt, &rv.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rv.AuthorName = reviewAuthorName(first, last)
+		rv.FlagReasons = []string{}
+		reviews = append(reviews, rv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return reviews, loadFlagReasons(reviews)
+}
+
+// loadFlagReasons fills in the non-empty flag reasons of reviews, oldest
+// first. Reasons are free text, so they are read as rows rather than joined
+// into one string.
+func loadFlagReasons(reviews []ModerationReview) error {
+	byID := map[int]*ModerationReview{}
+	var args []interface{}
+	for i := range reviews {
+		if reviews[i].FlagCount > 0 {
+			byID[reviews[i].ID] = &reviews[i]
+			args = append(args, reviews[i].ID)
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	placeholders := strings.Repeat("?,", len(args))
+	placeholders = placeholders[:len(placeholders)-1] // remove trailing comma
+	rows, err := db.Query(`
+        SELECT review_id, reason FROM review_flags
+        WHERE review_id IN (`+placeholders+`) AND reason <> ''
+        ORDER BY created_at, user_id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var reason string
+		if err := rows.Scan(&id, &reason); err != nil {
+			return err
+		}
+		if rv := byID[id]; rv != nil {
+			rv.FlagReasons = append(rv.FlagReasons, reason)
+		}
+	}
+	return rows.Err()
+}
+
+// moderateReview shows or hides reviewID and resolves its open flags.
+func moderateReview(reviewID int, status string) error {
+	if status != ReviewVisible && status != ReviewHidden {
+		return errReviewStatus
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var resourceID int
+	err = tx.QueryRow("SELECT resource_id FROM resource_reviews WHERE id = ? FOR UPDATE", reviewID).Scan(&resourceID)
+	if err == sql.ErrNoRows {
+		return errReviewNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE resource_reviews SET status = ? WHERE id = ?", status, reviewID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM review_flags WHERE review_id = ?", reviewID); err != nil {
+		return err
+	}
+	if err := refreshResourceRating(tx, resourceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ======== HTTP Handlers ========
+
+// handleResourceReviews serves GET /api/resources/{id}/reviews.
+func handleResourceReviews(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	resourceID, ok := parseResourceID(w, r)
+	if !ok {
+		return
+	}
+	viewerID, _ := requestUserID(r)
+	reviews, err := getReviews(resourceID, viewerID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, reviews)
+}
+
+// handleMyReview serves /api/resources/{id}/reviews/me: PUT creates or
+// replaces the caller's review and DELETE removes it.
+func handleMyReview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	resourceID, ok := parseResourceID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		defer r.Body.Close()
+		var req ReviewRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+			return
+		}
+		if err := validateReviewRequest(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := saveReview(userID, resourceID, req); err != nil {
+			writeReviewError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"rating": req.Rating, "body": req.Body})
+
+	case http.MethodDelete:
+		if err := deleteReview(userID, resourceID); err != nil {
+			writeReviewError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use PUT or DELETE"})
+	}
+}
+
+// handleFlagReview serves POST /api/reviews/{id}/flag with an optional body
+// of {"reason": "..."}.
+func handleFlagReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	reviewID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || reviewID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid review id"})
+		return
+	}
+	defer r.Body.Close()
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	reason, err := normalizeFlagReason(req.Reason)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := flagReview(userID, reviewID, reason); err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "Thanks, a moderator will take a look."})
+}
+
+// handleModerationQueue serves GET /api/admin/reviews?status=flagged&limit=50.
+func handleModerationQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "flagged"
+	}
+	limit := reviewQueueDefault
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 200 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 200"})
+			return
+		}
+		limit = n
+	}
+	if status != "flagged" && status != ReviewVisible && status != ReviewHidden {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "status must be flagged, visible or hidden"})
+		return
+	}
+	reviews, err := getModerationQueue(status, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, reviews)
+}
+
+// handleModerateReview serves PUT /api/admin/reviews/{id} with a body of
+// {"status": "hidden"} or {"status": "visible"}. Either decision clears the
+// review's flags.
+func handleModerateReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use PUT"})
+		return
+	}
+	reviewID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || reviewID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid review id"})
+		return
+	}
+	defer r.Body.Close()
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	if err := moderateReview(reviewID, req.Status); err != nil {
+		writeReviewError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": req.Status})
+}
+
+// writeReviewError maps review errors to HTTP responses.
+func writeReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errReviewNotFound), errors.Is(err, errResourceNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, errReviewStatus):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, errFlagOwnReview):
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, errAlreadyFlagged):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
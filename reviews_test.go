@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestValidateReviewRequest verifies rating bounds and the body length limit.
+func TestValidateReviewRequest(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		req     ReviewRequest
+		wantErr bool
+	}{
+		{"rating only", ReviewRequest{Rating: 4}, false},
+		{"lowest", ReviewRequest{Rating: 1, Body: "Too fast for me."}, false},
+		{"highest", ReviewRequest{Rating: 5}, false},
+		{"zero", ReviewRequest{Rating: 0}, true},
+		{"too high", ReviewRequest{Rating: 6}, true},
+		{"longest body", ReviewRequest{Rating: 3, Body: strings.Repeat("é", maxReviewBodyLen)}, false},
+		{"body too long", ReviewRequest{Rating: 3, Body: strings.Repeat("a", maxReviewBodyLen+1)}, true},
+	}
+	for _, tt := range tests {
+		err := validateReviewRequest(&tt.req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateReviewRequest() observed err = %v, expected error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	req := ReviewRequest{Rating: 5, Body: "  Best eigenvector video.\n"}
+	if err := validateReviewRequest(&req); err != nil || req.Body != "Best eigenvector video." {
+		t.Errorf("validateReviewRequest() observed body = %q, err = %v, expected a trimmed body", req.Body, err)
+	}
+}
+
+// TestNormalizeFlagReason verifies reasons are trimmed and limited in
+// characters rather than bytes.
+func TestNormalizeFlagReason(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		reason   string
+		expected string
+		wantErr  bool
+	}{
+		{"Empty", "", "", false},
+		{"Trimmed", "  spam\n", "spam", false},
+		{"Non-ASCII at the limit", strings.Repeat("é", maxFlagReasonLen), strings.Repeat("é", maxFlagReasonLen), false},
+		{"Too long", strings.Repeat("é", maxFlagReasonLen+1), "", true},
+	}
+	for _, tt := range tests {
+		observed, err := normalizeFlagReason(tt.reason)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: normalizeFlagReason() observed err = %v, expected error: %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if observed != tt.expected {
+			t.Errorf("%s: normalizeFlagReason() observed = %q, expected: %q", tt.name, observed, tt.expected)
+		}
+	}
+}
+
+// TestReviewAuthorName verifies reviews only show a first name and initial.
+func TestReviewAuthorName(t *testing.T) {
+	t.Parallel()
+	tests := []struct{ first, last, expected string }{
+		{"Ada", "Lovelace", "Ada L."},
+		{"Émile", "Ørsted", "Émile Ø."},
+		{"Ada", "", "Ada"},
+		{" Ada ", "  lovelace", "Ada l."},
+	}
+	for _, tt := range tests {
+		if observed := reviewAuthorName(tt.first, tt.last); observed != tt.expected {
+			t.Errorf("reviewAuthorName(%q, %q) observed = %q, expected: %q", tt.first, tt.last, observed, tt.expected)
+		}
+	}
+}
+
+// TestReviewHandlersValidate verifies bad review requests are refused before
+// reaching the database.
+func TestReviewHandlersValidate(t *testing.T) {
+	t.Parallel()
+	ada := &User{ID: 7}
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		method   string
+		target   string
+		id       string
+		body     string
+		user     *User
+		expected int
+	}{
+		{"reviews bad id", handleResourceReviews, http.MethodGet, "/api/resources/x/reviews", "x", "", nil, http.StatusBadRequest},
+		{"reviews post", handleResourceReviews, http.MethodPost, "/api/resources/1/reviews", "1", "", nil, http.StatusMethodNotAllowed},
+		{"my review logged out", handleMyReview, http.MethodPut, "/api/resources/1/reviews/me", "1", `{"rating":5}`, nil, http.StatusUnauthorized},
+		{"my review bad id", handleMyReview, http.MethodPut, "/api/resources/0/reviews/me", "0", `{"rating":5}`, ada, http.StatusBadRequest},
+		{"my review bad rating", handleMyReview, http.MethodPut, "/api/resources/1/reviews/me", "1", `{"rating":9}`, ada, http.StatusBadRequest},
+		{"my review bad json", handleMyReview, http.MethodPut, "/api/resources/1/reviews/me", "1", `{`, ada, http.StatusBadRequest},
+		{"my review post", handleMyReview, http.MethodPost, "/api/resources/1/reviews/me", "1", "", ada, http.StatusMethodNotAllowed},
+		{"flag logged out", handleFlagReview, http.MethodPost, "/api/reviews/1/flag", "1", "", nil, http.StatusUnauthorized},
+		{"flag bad id", handleFlagReview, http.MethodPost, "/api/reviews/x/flag", "x", "", ada, http.StatusBadRequest},
+		{"flag long reason", handleFlagReview, http.MethodPost, "/api/reviews/1/flag", "1",
+			`{"reason":"` + strings.Repeat("a", maxFlagReasonLen+1) + `"}`, ada, http.StatusBadRequest},
+		{"queue bad status", handleModerationQueue, http.MethodGet, "/api/admin/reviews?status=deleted", "", "", ada, http.StatusBadRequest},
+		{"queue bad limit", handleModerationQueue, http.MethodGet, "/api/admin/reviews?limit=0", "", "", ada, http.StatusBadRequest},
+		{"moderate bad id", handleModerateReview, http.MethodPut, "/api/admin/reviews/x", "x", `{"status":"hidden"}`, ada, http.StatusBadRequest},
+		{"moderate bad status", handleModerateReview, http.MethodPut, "/api/admin/reviews/1", "1", `{"status":"deleted"}`, ada, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.SetPathValue("id", tt.id)
+		if tt.user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), authKey, &requestAuth{user: tt.user}))
+		}
+		rr := httptest.NewRecorder()
+		tt.handler(rr, req)
+		if rr.Code != tt.expected {
+			t.Errorf("%s: expected status %d, observed: %d (%s)", tt.name, tt.expected, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// TestRefreshResourceRating verifies the stored rating figures follow
+// reviews being saved, hidden and deleted.
+func TestRefreshResourceRating(t *testing.T) {
+	useTestDB(t)
+	resourceID := createTestResource(t, true)
+	ada := createTestUser(t, "Ada", "Lovelace")
+	grace := createTestUser(t, "Grace", "Hopper")
+	expectRating := func(step string, avg float64, count int) {
+		t.Helper()
+		var observedAvg float64
+		var observedCount int
+		if err := db.QueryRow("SELECT rating_avg, rating_count FROM resources WHERE id = ?", resourceID).Scan(&observedAvg, &observedCount); err != nil {
+			t.Fatalf("%s: reading rating: %v", step, err)
+		}
+		if observedAvg != avg || observedCount != count {
+			t.Errorf("%s: observed rating %.2f from %d reviews, expected: %.2f from %d", step, observedAvg, observedCount, avg, count)
+		}
+	}
+
+	for _, r := range []struct{ userID, rating int }{{ada, 4}, {grace, 5}} {
+		if err := saveReview(r.userID, resourceID, ReviewRequest{Rating: r.rating}); err != nil {
+			t.Fatalf("saveReview(%d) observed error = %v", r.userID, err)
+		}
+	}
+	expectRating("two reviews", 4.5, 2)
+
+	if err := saveReview(ada, resourceID, ReviewRequest{Rating: 2}); err != nil {
+		t.Fatalf("saveReview(edit) observed error = %v", err)
+	}
+	expectRating("edited review", 3.5, 2)
+
+	var graceReview int
+	if err := db.QueryRow("SELECT id FROM resource_reviews WHERE resource_id = ? AND user_id = ?", resourceID, grace).Scan(&graceReview); err != nil {
+		t.Fatalf("reading review id: %v", err)
+	}
+	if err := moderateReview(graceReview, ReviewHidden); err != nil {
+		t.Fatalf("moderateReview(hidden) observed error = %v", err)
+	}
+	expectRating("hidden review", 2, 1)
+
+	// Editing a hidden review keeps it out of the figures.
+	if err := saveReview(grace, resourceID, ReviewRequest{Rating: 1}); err != nil {
+		t.Fatalf("saveReview(hidden edit) observed error = %v", err)
+	}
+	expectRating("edited hidden review", 2, 1)
+
+	if err := moderateReview(graceReview, ReviewVisible); err != nil {
+		t.Fatalf("moderateReview(visible) observed error = %v", err)
+	}
+	expectRating("restored review", 1.5, 2)
+
+	if err := deleteReview(ada, resourceID); err != nil {
+		t.Fatalf("deleteReview observed error = %v", err)
+	}
+	expectRating("deleted review", 1, 1)
+	if err := deleteReview(grace, resourceID); err != nil {
+		t.Fatalf("deleteReview observed error = %v", err)
+	}
+	expectRating("no reviews", 0, 0)
+}
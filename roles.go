@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ======== Roles and Permissions ========
+
+// User roles stored in users.role. Every new account is a student.
+const (
+	RoleStudent    = "student"
+	RoleInstructor = "instructor"
+	RoleAdmin      = "admin"
+)
+
+// Permissions checked by requirePermission. Routes ask for a permission, not
+// a role, so what each role may do is decided in one place.
+const (
+	PermManageResources = "resources:manage"
+	PermModerate        = "reviews:moderate"
+	PermManageClasses   = "classes:manage"
+	PermManageUsers     = "users:manage"
+)
+
+// rolePermissions lists what each role may do beyond what every user can.
+var rolePermissions = map[string][]string{
+	RoleStudent:    {},
+	RoleInstructor: {PermManageResources, PermModerate, PermManageClasses},
+	RoleAdmin:      {PermManageResources, PermModerate, PermManageClasses, PermManageUsers},
+}
+
+// AdminUser is a user as listed to admins.
+type AdminUser struct {
+	ID        int       `json:"id"`
+	FName     string    `json:"fName"`
+	LName     string    `json:"lName"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var (
+	errUnknownRole = errors.New("role must be student, instructor or admin")
+	errLastAdmin   = errors.New("cannot remove the last admin")
+)
+
+// validRole reports whether role is one of the known roles.
+func validRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// hasPermission reports whether role grants perm.
+func hasPermission(role, perm string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// ======== Middleware ========
+
+// requirePermission guards a route: anonymous requests get 401 and users
+// whose role lacks perm get 403. Roles are read from the database on every
+// request, so a role change applies immediately.
+func requirePermission(perm string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := currentUser(r)
+		if user == nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+			return
+		}
+		if !hasPermission(user.Role, perm) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "you do not have permission to do this"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ======== DB Functions ========
+
+// setUserRole changes the role of userID. The last admin cannot be demoted,
+// so the site always keeps someone who can manage users.
+func setUserRole(userID int, role string) error {
+	if !validRole(role) {
+		return errUnknownRole
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow("SELECT role FROM users WHERE id = ? FOR UPDATE", userID).Scan(&current); err != nil {
+		if err == sql.ErrNoRows {
+			return errUserNotFound
+		}
+		return err
+	}
+	if current == RoleAdmin && role != RoleAdmin {
+		var admins int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE role = ? FOR UPDATE", RoleAdmin).Scan(&admins); err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return errLastAdmin
+		}
+	}
+	if _, err := tx.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getAdminUsers lists up to limit users whose name or email contains query,
+// newest first.
+func getAdminUsers(query string, limit int) ([]AdminUser, error) {
+	like := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+	rows, err := db.Query(`
+        SELECT id, first_name, last_name, email, role, created_at FROM users
+        WHERE email LIKE ? OR CONCAT(first_name, ' ', last_name) LIKE ?
+        ORDER BY id DESC LIMIT ?
+    `, like, like, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []AdminUser{}
+	for rows.Next() {
+		var u AdminUser
+		if err := rows.Scan(&u.ID, &u.FName, &u.LName, &u.Email, &u.Role, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// promoteAdmin makes the user with email an admin. It backs the bootstrap
+// command that creates the first admin, when no one can use the API yet.
+func promoteAdmin(email string) error {
+	user, err := getUserByEmail(email)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no user with email %q; sign up first", email)
+	}
+	if err != nil {
+		return err
+	}
+	return setUserRole(user.ID, RoleAdmin)
+}
+
+// ======== HTTP Handlers ========
+
+// handleAdminUsers serves GET /api/admin/users?q=...&limit=..., which lists
+// users with their roles.
+func handleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+	limit := 50
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 200 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 200"})
+			return
+		}
+		limit = n
+	}
+	users, err := getAdminUsers(strings.TrimSpace(r.URL.Query().Get("q")), limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// handleAdminUserRole serves PUT /api/admin/users/{id}/role with a body of
+// {"role": "instructor"}.
+func handleAdminUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use PUT"})
+		return
+	}
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || userID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		return
+	}
+	defer r.Body.Close()
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if err := setUserRole(userID, req.Role); err != nil {
+		writeRoleError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"role": req.Role})
+}
+
+// writeRoleError maps role errors to HTTP statuses.
+func writeRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUnknownRole):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, errUserNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, errLastAdmin):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHasPermission verifies the permissions granted to each role.
+func TestHasPermission(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		role     string
+		perm     string
+		expected bool
+	}{
+		{RoleStudent, PermManageResources, false},
+		{RoleInstructor, PermManageResources, true},
+		{RoleInstructor, PermModerate, true},
+		{RoleInstructor, PermManageUsers, false},
+		{RoleAdmin, PermManageUsers, true},
+		{RoleAdmin, PermManageClasses, true},
+		{"", PermManageResources, false},
+		{"superuser", PermManageUsers, false},
+	}
+	for _, tt := range tests {
+		if observed := hasPermission(tt.role, tt.perm); observed != tt.expected {
+			t.Errorf("hasPermission(%q, %q) observed = %v, expected: %v", tt.role, tt.perm, observed, tt.expected)
+		}
+	}
+}
+
+// TestRequirePermission verifies anonymous users get 401, users without the
+// permission 403, and permitted users reach the handler.
+func TestRequirePermission(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		auth     *requestAuth
+		expected int
+	}{
+		{"Anonymous", nil, http.StatusUnauthorized},
+		{"Student", &requestAuth{user: &User{ID: 1, Role: RoleStudent}}, http.StatusForbidden},
+		{"Instructor", &requestAuth{user: &User{ID: 2, Role: RoleInstructor}}, http.StatusForbidden},
+		{"Admin", &requestAuth{user: &User{ID: 3, Role: RoleAdmin}}, http.StatusOK},
+		{"Admin API token", &requestAuth{user: &User{ID: 3, Role: RoleAdmin}, tokenID: 9}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+			if tt.auth != nil {
+				req = req.WithContext(context.WithValue(req.Context(), authKey, tt.auth))
+			}
+			rr := httptest.NewRecorder()
+			requirePermission(PermManageUsers, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})(rr, req)
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, observed: %d", tt.expected, rr.Code)
+			}
+		})
+	}
+}
+
+// TestHandleAdminUserRoleValidates verifies bad IDs and roles are refused
+// before reaching the database.
+func TestHandleAdminUserRoleValidates(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		id   string
+		body string
+	}{
+		{"Invalid id", "abc", `{"role":"admin"}`},
+		{"Invalid JSON", "1", `nope`},
+		{"Unknown role", "1", `{"role":"owner"}`},
+		{"Missing role", "1", `{}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodPut, "/api/admin/users/"+tt.id+"/role", strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
+			rr := httptest.NewRecorder()
+			handleAdminUserRole(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, observed: %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,905 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ======== Types ========
+
+// RoomWorkspace is the shared matrix workspace of a study room. It is stored
+// as JSON in study_rooms.workspace and replaced wholesale on every edit.
+type RoomWorkspace struct {
+	Matrices map[string]Matrix `json:"matrices"`
+	Active   string            `json:"active,omitempty"` // name of the matrix being edited
+}
+
+// StudyRoom is a collaborative room shared by a group of friends.
+type StudyRoom struct {
+	ID        int           `json:"id"`
+	Name      string        `json:"name"`
+	OwnerID   int           `json:"owner_id"`
+	Workspace RoomWorkspace `json:"workspace"`
+	Members   []RoomMember  `json:"members,omitempty"`
+	Messages  []RoomMessage `json:"messages,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// RoomMember is one user that belongs to a study room.
+type RoomMember struct {
+	UserID int    `json:"user_id"`
+	FName  string `json:"fName"`
+	LName  string `json:"lName"`
+	Avatar string `json:"avatar"`
+}
+
+// RoomMessage is one chat message posted in a study room.
+type RoomMessage struct {
+	ID        int64     `json:"id"`
+	UserID    int       `json:"user_id"`
+	FName     string    `json:"fName"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateRoomRequest is the JSON payload for POST /api/rooms.
+type CreateRoomRequest struct {
+	Name      string `json:"name"`
+	MemberIDs []int  `json:"member_ids"`
+}
+
+// RoomMemberRequest is the JSON payload for POST /api/rooms/{id}/members.
+type RoomMemberRequest struct {
+	UserID int `json:"user_id"`
+}
+
+const (
+	maxRoomNameLen      = 100
+	maxRoomMatrices     = 26
+	maxRoomMatrixDim    = 20
+	maxRoomMessageLen   = 2000
+	roomHistoryMessages = 50
+)
+
+var (
+	errRoomNotFound  = errors.New("room not found")
+	errRoomNotOwner  = errors.New("only the room owner can do that")
+	errRoomNotFriend = errors.New("room members must be your friends")
+	errRoomOwnerStay = errors.New("the owner cannot leave the room; delete it instead")
+)
+
+// validateWorkspace checks that every matrix is rectangular and within size limits.
+func validateWorkspace(ws RoomWorkspace) error {
+	if len(ws.Matrices) > maxRoomMatrices {
+		return fmt.Errorf("a workspace holds at most %d matrices", maxRoomMatrices)
+	}
+	for name, m := range ws.Matrices {
+		if name == "" || len(name) > 20 {
+			return fmt.Errorf("invalid matrix name %q", name)
+		}
+		if err := validateRect(m); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if r, c := dims(m); r > maxRoomMatrixDim || c > maxRoomMatrixDim {
+			return fmt.Errorf("%s: matrices are limited to %dx%d", name, maxRoomMatrixDim, maxRoomMatrixDim)
+		}
+	}
+	if ws.Active != "" {
+		if _, ok := ws.Matrices[ws.Active]; !ok {
+			return fmt.Errorf("active matrix %q does not exist", ws.Active)
+		}
+	}
+	return nil
+}
+
+// ======== DB Functions ========
+
+// isRoomMember reports whether userID belongs to roomID.
+func isRoomMember(roomID, userID int) (bool, error) {
+	var n int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM study_room_members WHERE room_id = ? AND user_id = ?",
+		roomID, userID,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// createRoom creates a room owned by ownerID with the given friends as members.
+func createRoom(ownerID int, req CreateRoomRequest) (int, error) {
+	for _, id := range req.MemberIDs {
+		if id == ownerID {
+			continue
+		}
+		ok, err := areFriends(ownerID, id)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, errRoomNotFriend
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ws, _ := json.Marshal(RoomWorkspace{Matrices: map[string]Matrix{}})
+	result, err := tx.Exec(
+		"INSERT INTO study_rooms (name, owner_id, workspace) VALUES (?, ?, ?)",
+		req.Name, ownerID, ws,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, memberID := range append([]int{ownerID}, req.MemberIDs...) {
+		if _, err := tx.Exec(
+			"INSERT IGNORE INTO study_room_members (room_id, user_id) VALUES (?, ?)",
+			id, memberID,
+		); err != nil {
+			return 0, err
+		}
+	}
+	return int(id), tx.Commit()
+}
+
+// getRoomsForUser lists the rooms userID belongs to, most recently active first.
+func getRoomsForUser(userID int) ([]StudyRoom, error) {
+	rows, err := db.Query(`
+        SELECT r.id, r.name, r.owner_id, r.workspace, r.created_at, r.updated_at
+        FROM study_rooms r
+        JOIN study_room_members m ON m.room_id = r.id
+        WHERE m.user_id = ?
+        ORDER BY r.updated_at DESC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := []StudyRoom{}
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, *room)
+	}
+	return rooms, rows.Err()
+}
+
+// scanRoom reads one study_rooms row selected as id, name, owner_id,
+// workspace, created_at, updated_at.
+func scanRoom(row interface{ Scan(...any) error }) (*StudyRoom, error) {
+	var room StudyRoom
+	var ws []byte
+	if err := row.Scan(&room.ID, &room.Name, &room.OwnerID, &ws, &room.CreatedAt, &room.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(ws, &room.Workspace); err != nil {
+		return nil, fmt.Errorf("room %d has an invalid workspace: %w", room.ID, err)
+	}
+	if room.Workspace.Matrices == nil {
+		room.Workspace.Matrices = map[string]Matrix{}
+	}
+	return &room, nil
+}
+
+// getRoom loads a room with its members and recent chat history, provided
+// userID is a member.
+func getRoom(roomID, userID int) (*StudyRoom, error) {
+	member, err := isRoomMember(roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, errRoomNotFound
+	}
+
+	room, err := scanRoom(db.QueryRow(
+		"SELECT id, name, owner_id, workspace, created_at, updated_at FROM study_rooms WHERE id = ?",
+		roomID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, errRoomNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+        SELECT u.id, u.first_name, u.last_name, COALESCE(u.avatar, '')
+        FROM study_room_members m
+        JOIN users u ON u.id = m.user_id
+        WHERE m.room_id = ?
+        ORDER BY m.joined_at
+    `, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m RoomMember
+		if err := rows.Scan(&m.UserID, &m.FName, &m.LName, &m.Avatar); err != nil {
+			return nil, err
+		}
+		room.Members = append(room.Members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	room.Messages, err = getRoomMessages(roomID, roomHistoryMessages)
+	return room, err
+}
+
+// getRoomMessages returns the latest limit messages of roomID in chronological order.
+func getRoomMessages(roomID, limit int) ([]RoomMessage, error) {
+	rows, err := db.Query(`
+        SELECT msg.id, msg.user_id, u.first_name, msg.body, msg.created_at
+        FROM study_room_messages msg
+        JOIN users u ON u.id = msg.user_id
+        WHERE msg.room_id = ?
+        ORDER BY msg.id DESC
+        LIMIT ?
+    `, roomID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []RoomMessage{}
+	for rows.Next() {
+		var m RoomMessage
+		if err := rows.Scan(&m.ID, &m.UserID, &m.FName, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	// Reverse so the oldest message comes first.
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, rows.Err()
+}
+
+// saveRoomMessage persists a chat message and returns it with its ID and author name.
+func saveRoomMessage(roomID, userID int, body string) (*RoomMessage, error) {
+	result, err := db.Exec(
+		"INSERT INTO study_room_messages (room_id, user_id, body) VALUES (?, ?, ?)",
+		roomID, userID, body,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	m := &RoomMessage{ID: id, UserID: userID, Body: body, CreatedAt: time.Now().UTC()}
+	err = db.QueryRow("SELECT first_name FROM users WHERE id = ?", userID).Scan(&m.FName)
+	return m, err
+}
+
+// saveRoomWorkspace replaces the persisted workspace of roomID.
+func saveRoomWorkspace(roomID int, ws RoomWorkspace) error {
+	b, err := json.Marshal(ws)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("UPDATE study_rooms SET workspace = ? WHERE id = ?", b, roomID)
+	return err
+}
+
+// getRoomOwner returns the owner of roomID.
+func getRoomOwner(roomID int) (int, error) {
+	var owner int
+	err := db.QueryRow("SELECT owner_id FROM study_rooms WHERE id = ?", roomID).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return 0, errRoomNotFound
+	}
+	return owner, err
+}
+
+// addRoomMember lets the owner of roomID add one of their friends.
+func addRoomMember(roomID, ownerID, userID int) error {
+	owner, err := getRoomOwner(roomID)
+	if err != nil {
+		return err
+	}
+	if owner != ownerID {
+		return errRoomNotOwner
+	}
+	ok, err := areFriends(ownerID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errRoomNotFriend
+	}
+	_, err = db.Exec("INSERT IGNORE INTO study_room_members (room_id, user_id) VALUES (?, ?)", roomID, userID)
+	return err
+}
+
+// removeRoomMember removes userID from roomID. Members may remove themselves;
+// the owner may remove anyone but cannot leave their own room.
+func removeRoomMember(roomID, actorID, userID int) error {
+	owner, err := getRoomOwner(roomID)
+	if err != nil {
+		return err
+	}
+	if actorID != userID && actorID != owner {
+		return errRoomNotOwner
+	}
+	if userID == owner {
+		return errRoomOwnerStay
+	}
+	result, err := db.Exec("DELETE FROM study_room_members WHERE room_id = ? AND user_id = ?", roomID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errRoomNotFound
+	}
+	kickFromRoom(roomID, userID)
+	return nil
+}
+
+// deleteRoom deletes roomID if ownerID owns it; members and messages cascade.
+func deleteRoom(roomID, ownerID int) error {
+	owner, err := getRoomOwner(roomID)
+	if err != nil {
+		return err
+	}
+	if owner != ownerID {
+		return errRoomNotOwner
+	}
+	if _, err := db.Exec("DELETE FROM study_rooms WHERE id = ?", roomID); err != nil {
+		return err
+	}
+	closeRoom(roomID)
+	return nil
+}
+
+// roomMembership is one user's membership of one room.
+type roomMembership struct {
+	roomID int
+	userID int
+}
+
+// removeFromEachOthersRooms removes a from the rooms b owns and b from the
+// rooms a owns inside tx, since room members must be friends of the owner.
+// Rooms of other owners that both belong to are left alone. It returns the
+// removed memberships so callers can disconnect them with kickFromRoom once
+// tx commits.
+func removeFromEachOthersRooms(tx *sql.Tx, a, b int) ([]roomMembership, error) {
+	rows, err := tx.Query(`
+        SELECT m.room_id, m.user_id
+        FROM study_room_members m
+        JOIN study_rooms r ON r.id = m.room_id
+        WHERE (r.owner_id = ? AND m.user_id = ?) OR (r.owner_id = ? AND m.user_id = ?)
+        FOR UPDATE`,
+		a, b, b, a,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var removed []roomMembership
+	for rows.Next() {
+		var m roomMembership
+		if err := rows.Scan(&m.roomID, &m.userID); err != nil {
+			return nil, err
+		}
+		removed = append(removed, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, m := range removed {
+		if _, err := tx.Exec("DELETE FROM study_room_members WHERE room_id = ? AND user_id = ?", m.roomID, m.userID); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// ======== Live Sync ========
+
+// roomEvent is the envelope for every WebSocket message in both directions.
+//
+// Client → server: "chat" (Body) and "workspace" (Workspace).
+// Server → client: "snapshot" (Workspace, Messages, Online), "chat" (Message),
+// "workspace" (Workspace, UserID), "presence" (Online) and "error" (Error).
+type roomEvent struct {
+	Type      string         `json:"type"`
+	Body      string         `json:"body,omitempty"`
+	Workspace *RoomWorkspace `json:"workspace,omitempty"`
+	Message   *RoomMessage   `json:"message,omitempty"`
+	Messages  []RoomMessage  `json:"messages,omitempty"`
+	Online    []int          `json:"online,omitempty"`
+	UserID    int            `json:"user_id,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// roomClient is one WebSocket connection in a room. Outgoing frames are
+// queued on send and written by the connection's writer goroutine.
+type roomClient struct {
+	userID int
+	send   chan []byte
+}
+
+// roomHub fans out events to every connection in one room.
+type roomHub struct {
+	roomID  int
+	mu      sync.Mutex
+	clients map[*roomClient]bool
+}
+
+// roomHubs holds the hubs of rooms with connected clients. A hub is created by
+// the first connection and dropped when the last one leaves or the room is
+// deleted. Lock roomHubs before a hub's mu when holding both.
+var roomHubs = struct {
+	sync.Mutex
+	m map[int]*roomHub
+}{m: map[int]*roomHub{}}
+
+// joinRoomHub registers c in the hub of roomID, creating the hub if needed,
+// and returns it. snapshot is queued as c's first frame.
+func joinRoomHub(roomID int, c *roomClient, snapshot roomEvent) *roomHub {
+	roomHubs.Lock()
+	defer roomHubs.Unlock()
+	h, ok := roomHubs.m[roomID]
+	if !ok {
+		h = &roomHub{roomID: roomID, clients: map[*roomClient]bool{}}
+		roomHubs.m[roomID] = h
+	}
+	h.join(c, &snapshot)
+	return h
+}
+
+// kickFromRoom disconnects every connection of userID from roomID.
+func kickFromRoom(roomID, userID int) {
+	roomHubs.Lock()
+	h := roomHubs.m[roomID]
+	roomHubs.Unlock()
+	if h != nil {
+		h.kick(userID)
+	}
+}
+
+// closeRoom drops the hub of roomID and disconnects everyone in it, used when
+// the room is deleted.
+func closeRoom(roomID int) {
+	roomHubs.Lock()
+	h := roomHubs.m[roomID]
+	delete(roomHubs.m, roomID)
+	roomHubs.Unlock()
+	if h != nil {
+		h.closeAll()
+	}
+}
+
+// join registers c and announces the new presence list. A non-nil snapshot
+// is queued for c first, with the presence list already including c.
+func (h *roomHub) join(c *roomClient, snapshot *roomEvent) {
+	h.mu.Lock()
+	h.clients[c] = true
+	if snapshot != nil {
+		snapshot.Online = h.onlineLocked()
+		if b, err := json.Marshal(snapshot); err == nil {
+			c.send <- b
+		}
+	}
+	h.mu.Unlock()
+	h.broadcast(roomEvent{Type: "presence", Online: h.online()})
+}
+
+// leave unregisters c, closes its queue and announces the new presence list.
+// The hub is dropped once its last client is gone.
+func (h *roomHub) leave(c *roomClient) {
+	h.mu.Lock()
+	member := h.clients[c]
+	if member {
+		delete(h.clients, c)
+		close(c.send)
+	}
+	empty := len(h.clients) == 0
+	h.mu.Unlock()
+	if empty {
+		h.release()
+		return
+	}
+	if member {
+		h.broadcast(roomEvent{Type: "presence", Online: h.online()})
+	}
+}
+
+// release removes h from roomHubs if it is still registered and nobody
+// joined it in the meantime.
+func (h *roomHub) release() {
+	roomHubs.Lock()
+	defer roomHubs.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) == 0 && roomHubs.m[h.roomID] == h {
+		delete(roomHubs.m, h.roomID)
+	}
+}
+
+// kick disconnects every connection of userID.
+func (h *roomHub) kick(userID int) {
+	h.mu.Lock()
+	var gone []*roomClient
+	for c := range h.clients {
+		if c.userID == userID {
+			gone = append(gone, c)
+		}
+	}
+	h.mu.Unlock()
+	for _, c := range gone {
+		h.leave(c)
+	}
+}
+
+// closeAll disconnects everyone, used when the room is deleted.
+func (h *roomHub) closeAll() {
+	h.mu.Lock()
+	for c := range h.clients {
+		delete(h.clients, c)
+		close(c.send)
+	}
+	h.mu.Unlock()
+}
+
+// online returns the distinct IDs of connected users in ascending order.
+func (h *roomHub) online() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.onlineLocked()
+}
+
+// onlineLocked is online for callers holding h.mu.
+func (h *roomHub) onlineLocked() []int {
+	seen := map[int]bool{}
+	ids := []int{}
+	for c := range h.clients {
+		if !seen[c.userID] {
+			seen[c.userID] = true
+			ids = append(ids, c.userID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// broadcast queues ev for every client. Clients whose queue is full are
+// dropped rather than allowed to stall the room.
+func (h *roomHub) broadcast(ev roomEvent) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		select {
+		case c.send <- b:
+		default:
+			delete(h.clients, c)
+			close(c.send)
+		}
+	}
+}
+
+// handleRoomEvent applies one client event: it validates and persists it, then
+// broadcasts the result. Invalid events are answered with an error event to
+// the sender only.
+func (h *roomHub) handleRoomEvent(roomID int, c *roomClient, ev roomEvent) {
+	reply := func(msg string) {
+		b, _ := json.Marshal(roomEvent{Type: "error", Error: msg})
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.clients[c] {
+			select {
+			case c.send <- b:
+			default:
+			}
+		}
+	}
+
+	switch ev.Type {
+	case "chat":
+		body := strings.TrimSpace(ev.Body)
+		if body == "" || len(body) > maxRoomMessageLen {
+			reply(fmt.Sprintf("messages must be 1-%d characters", maxRoomMessageLen))
+			return
+		}
+		msg, err := saveRoomMessage(roomID, c.userID, body)
+		if err != nil {
+			log.Printf("room %d: failed to save message: %v", roomID, err)
+			reply("failed to save message")
+			return
+		}
+		h.broadcast(roomEvent{Type: "chat", Message: msg})
+
+	case "workspace":
+		if ev.Workspace == nil {
+			reply("workspace is required")
+			return
+		}
+		if err := validateWorkspace(*ev.Workspace); err != nil {
+			reply(err.Error())
+			return
+		}
+		if err := saveRoomWorkspace(roomID, *ev.Workspace); err != nil {
+			log.Printf("room %d: failed to save workspace: %v", roomID, err)
+			reply("failed to save workspace")
+			return
+		}
+		h.broadcast(roomEvent{Type: "workspace", Workspace: ev.Workspace, UserID: c.userID})
+
+	default:
+		reply("unknown event type: " + ev.Type)
+	}
+}
+
+var roomUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+const (
+	roomWriteWait  = 10 * time.Second
+	roomPongWait   = 60 * time.Second
+	roomPingPeriod = roomPongWait * 9 / 10
+	roomMaxFrame   = 64 * 1024
+)
+
+// serveRoomSocket upgrades the request and runs the connection until either
+// side closes it.
+func serveRoomSocket(w http.ResponseWriter, r *http.Request, room *StudyRoom, userID int) {
+	conn, err := roomUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade already wrote an error response.
+	}
+	defer conn.Close()
+
+	c := &roomClient{userID: userID, send: make(chan []byte, 32)}
+	h := joinRoomHub(room.ID, c, roomEvent{
+		Type:      "snapshot",
+		Workspace: &room.Workspace,
+		Messages:  room.Messages,
+	})
+	defer h.leave(c)
+
+	go func() {
+		ticker := time.NewTicker(roomPingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case b, ok := <-c.send:
+				conn.SetWriteDeadline(time.Now().Add(roomWriteWait))
+				if !ok {
+					conn.WriteMessage(websocket.CloseMessage, []byte{})
+					conn.Close()
+					return
+				}
+				if err := conn.WriteMessage(websocket.TextMessage, b); err != nil {
+					return
+				}
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(roomWriteWait))
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	conn.SetReadLimit(roomMaxFrame)
+	conn.SetReadDeadline(time.Now().Add(roomPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(roomPongWait))
+	})
+	for {
+		var ev roomEvent
+		if err := conn.ReadJSON(&ev); err != nil {
+			return
+		}
+		h.handleRoomEvent(room.ID, c, ev)
+	}
+}
+
+// ======== HTTP Handlers ========
+
+// handleRooms serves /api/rooms.
+//
+// GET lists the caller's rooms. POST creates a room whose members must all be
+// the caller's friends.
+func handleRooms(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rooms, err := getRoomsForUser(userID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, rooms)
+
+	case http.MethodPost:
+		defer r.Body.Close()
+		var req CreateRoomRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > maxRoomNameLen {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("name must be 1-%d characters", maxRoomNameLen)})
+			return
+		}
+		id, err := createRoom(userID, req)
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+		room, err := getRoom(id, userID)
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, room)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or POST"})
+	}
+}
+
+// handleRoom serves /api/rooms/{id}: GET returns the room with members,
+// workspace and recent messages; DELETE removes it (owner only).
+func handleRoom(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := parseRoomPath(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		room, err := getRoom(roomID, userID)
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, room)
+
+	case http.MethodDelete:
+		if err := deleteRoom(roomID, userID); err != nil {
+			writeRoomError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or DELETE"})
+	}
+}
+
+// handleRoomMembers serves POST /api/rooms/{id}/members (owner adds a friend).
+func handleRoomMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	userID, roomID, ok := parseRoomPath(w, r)
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+	var req RoomMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "user_id is required"})
+		return
+	}
+	if err := addRoomMember(roomID, userID, req.UserID); err != nil {
+		writeRoomError(w, err)
+		return
+	}
+	room, err := getRoom(roomID, userID)
+	if err != nil {
+		writeRoomError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, room)
+}
+
+// handleRoomMember serves DELETE /api/rooms/{id}/members/{userId}, used both
+// to leave a room and, by the owner, to remove a member.
+func handleRoomMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use DELETE"})
+		return
+	}
+	userID, roomID, ok := parseRoomPath(w, r)
+	if !ok {
+		return
+	}
+	memberID, err := strconv.Atoi(r.PathValue("userId"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		return
+	}
+	if err := removeRoomMember(roomID, userID, memberID); err != nil {
+		writeRoomError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRoomSocket serves GET /api/rooms/{id}/ws, the WebSocket that keeps the
+// workspace and chat of a room in sync between members.
+func handleRoomSocket(w http.ResponseWriter, r *http.Request) {
+	userID, roomID, ok := parseRoomPath(w, r)
+	if !ok {
+		return
+	}
+	room, err := getRoom(roomID, userID)
+	if err != nil {
+		writeRoomError(w, err)
+		return
+	}
+	serveRoomSocket(w, r, room, userID)
+}
+
+// parseRoomPath resolves the current user and the {id} path value, writing an
+// error response on failure.
+func parseRoomPath(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return 0, 0, false
+	}
+	roomID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || roomID <= 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid room id"})
+		return 0, 0, false
+	}
+	return userID, roomID, true
+}
+
+// writeRoomError maps room repository errors to HTTP responses.
+func writeRoomError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errRoomNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errRoomNotOwner), errors.Is(err, errRoomNotFriend):
+		status = http.StatusForbidden
+	case errors.Is(err, errRoomOwnerStay):
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestValidateWorkspace verifies shape and size checks on shared workspaces.
+func TestValidateWorkspace(t *testing.T) {
+	t.Parallel()
+	big := make(Matrix, maxRoomMatrixDim+1)
+	for i := range big {
+		big[i] = []float64{0}
+	}
+	tests := []struct {
+		name      string
+		ws        RoomWorkspace
+		expectErr bool
+	}{
+		{"Empty workspace", RoomWorkspace{}, false},
+		{"Valid matrices", RoomWorkspace{Matrices: map[string]Matrix{"A": {{1, 2}}, "B": {{3}, {4}}}, Active: "A"}, false},
+		{"Ragged matrix", RoomWorkspace{Matrices: map[string]Matrix{"A": {{1, 2}, {3}}}}, true},
+		{"Matrix too large", RoomWorkspace{Matrices: map[string]Matrix{"A": big}}, true},
+		{"Active matrix missing", RoomWorkspace{Matrices: map[string]Matrix{"A": {{1}}}, Active: "B"}, true},
+		{"Empty name", RoomWorkspace{Matrices: map[string]Matrix{"": {{1}}}}, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := validateWorkspace(tt.ws); (err != nil) != tt.expectErr {
+				t.Errorf("validateWorkspace() observed error = %v, want expected error: %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+// TestRoomHubBroadcast verifies presence tracking and fan-out between connections.
+func TestRoomHubBroadcast(t *testing.T) {
+	t.Parallel()
+	h := &roomHub{clients: map[*roomClient]bool{}}
+	alice := &roomClient{userID: 1, send: make(chan []byte, 8)}
+	bob := &roomClient{userID: 2, send: make(chan []byte, 8)}
+
+	h.join(alice, nil)
+	h.join(bob, nil)
+	if got := h.online(); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Fatalf("online() observed = %v, expected: [1 2]", got)
+	}
+
+	h.broadcast(roomEvent{Type: "chat", Message: &RoomMessage{UserID: 1, Body: "hi"}})
+
+	// Alice saw both presence updates, Bob only his own join; both got the chat.
+	for _, tc := range []struct {
+		c      *roomClient
+		frames int
+	}{{alice, 3}, {bob, 2}} {
+		var last roomEvent
+		for i := 0; i < tc.frames; i++ {
+			if err := json.Unmarshal(<-tc.c.send, &last); err != nil {
+				t.Fatalf("user %d: invalid frame: %v", tc.c.userID, err)
+			}
+		}
+		if last.Type != "chat" || last.Message == nil || last.Message.Body != "hi" {
+			t.Errorf("user %d: last frame = %+v, expected the chat message", tc.c.userID, last)
+		}
+	}
+
+	h.kick(2)
+	if _, ok := <-bob.send; ok {
+		t.Errorf("kicked client's queue should be closed")
+	}
+	if got := h.online(); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("online() after kick observed = %v, expected: [1]", got)
+	}
+}
+
+// TestRoomHubLifecycle verifies a second tab is listed once in the snapshot
+// and that hubs are dropped when the last client leaves or the room closes.
+func TestRoomHubLifecycle(t *testing.T) {
+	t.Parallel()
+	const roomID, closedRoomID = -101, -102 // never used by real rooms
+	registered := func(id int) bool {
+		roomHubs.Lock()
+		defer roomHubs.Unlock()
+		return roomHubs.m[id] != nil
+	}
+
+	first := &roomClient{userID: 1, send: make(chan []byte, 8)}
+	second := &roomClient{userID: 1, send: make(chan []byte, 8)}
+	h := joinRoomHub(roomID, first, roomEvent{Type: "snapshot"})
+	if joinRoomHub(roomID, second, roomEvent{Type: "snapshot"}) != h {
+		t.Fatalf("joinRoomHub() observed a second hub for the same room")
+	}
+	var snapshot roomEvent
+	if err := json.Unmarshal(<-second.send, &snapshot); err != nil {
+		t.Fatalf("invalid snapshot frame: %v", err)
+	}
+	if snapshot.Type != "snapshot" || !reflect.DeepEqual(snapshot.Online, []int{1}) {
+		t.Errorf("second tab's first frame observed = %+v, expected a snapshot with online [1]", snapshot)
+	}
+
+	h.leave(first)
+	if !registered(roomID) {
+		t.Errorf("hub dropped while a client is still connected")
+	}
+	h.leave(second)
+	if registered(roomID) {
+		t.Errorf("hub still registered after the last client left")
+	}
+
+	c := &roomClient{userID: 2, send: make(chan []byte, 8)}
+	closed := joinRoomHub(closedRoomID, c, roomEvent{Type: "snapshot"})
+	closeRoom(closedRoomID)
+	if registered(closedRoomID) {
+		t.Errorf("hub still registered after closeRoom")
+	}
+	for range c.send {
+	}
+	closed.leave(c) // the connection's own cleanup must not fail on a closed room
+}
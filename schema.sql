@@ -6,8 +6,11 @@ CREATE TABLE IF NOT EXISTS users (
     first_name VARCHAR(100) NOT NULL,
     last_name VARCHAR(100) NOT NULL,
     email VARCHAR(255) NOT NULL UNIQUE,
-    password_hash VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(255) DEFAULT NULL, -- NULL for accounts created through a login provider
     avatar VARCHAR(50) DEFAULT NULL,
+    email_verified_at DATETIME DEFAULT NULL,
+    verification_sent_at DATETIME DEFAULT NULL,
+    role ENUM('student', 'instructor', 'admin') NOT NULL DEFAULT 'student',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     INDEX idx_email (email)
@@ -75,6 +78,8 @@ CREATE TABLE IF NOT EXISTS resources (
     is_featured BOOLEAN DEFAULT FALSE,
     is_active BOOLEAN DEFAULT TRUE,
     view_count INT DEFAULT 0,
+    rating_avg DECIMAL(3,2) NOT NULL DEFAULT 0,
+    rating_count INT NOT NULL DEFAULT 0,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     FOREIGN KEY (type_id) REFERENCES resource_types(id),
@@ -82,6 +87,10 @@ CREATE TABLE IF NOT EXISTS resources (
     INDEX idx_type (type_id),
     INDEX idx_is_active (is_active),
     INDEX idx_is_featured (is_featured),
+    INDEX idx_rating (rating_avg, rating_count),
+    INDEX idx_created_at (created_at),
+    INDEX idx_view_count (view_count),
+    INDEX idx_title (title),
     FULLTEXT INDEX idx_search (title, description, author, source_name)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
@@ -94,3 +103,554 @@ CREATE TABLE IF NOT EXISTS resource_tag_map (
     FOREIGN KEY (tag_id) REFERENCES resource_tags(id) ON DELETE CASCADE,
     INDEX idx_tag_id (tag_id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- Achievements Schema
+-- =====================================================
+
+-- Per-user activity log that trophy rules are evaluated against
+CREATE TABLE IF NOT EXISTS activity_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    kind VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_kind (user_id, kind),
+    INDEX idx_user_created (user_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Trophy catalog. rule = 'count' needs threshold events of event_kind
+-- (NULL event_kind counts every kind); rule = 'streak' needs threshold
+-- consecutive active days.
+CREATE TABLE IF NOT EXISTS trophies (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(255) DEFAULT NULL,
+    icon VARCHAR(50) DEFAULT NULL,
+    rule ENUM('count', 'streak') NOT NULL,
+    event_kind VARCHAR(50) DEFAULT NULL,
+    threshold INT NOT NULL DEFAULT 1,
+    sort_order INT NOT NULL DEFAULT 0,
+    is_active BOOLEAN DEFAULT TRUE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Seed trophies
+INSERT INTO trophies (slug, name, description, icon, rule, event_kind, threshold, sort_order) VALUES
+    ('first-calculation', 'First Steps', 'Record your first activity: a matrix computation, practice problem or quiz', 'calculator', 'count', NULL, 1, 10),
+    ('first-rref', 'Row Reducer', 'Compute your first RREF', 'layers', 'count', 'matrix.rref', 1, 20),
+    ('multiply-25', 'Product Line', 'Multiply 25 pairs of matrices', 'x', 'count', 'matrix.multiply', 25, 30),
+    ('problems-10', 'Problem Solver', 'Solve 10 practice problems', 'check-circle', 'count', 'problem.solved', 10, 40),
+    ('problems-100', 'Centurion', 'Solve 100 practice problems', 'award', 'count', 'problem.solved', 100, 50),
+    ('first-quiz', 'Quiz Taker', 'Complete your first quiz', 'clipboard', 'count', 'quiz.completed', 1, 60),
+    ('streak-7', 'On a Roll', 'Stay active 7 days in a row', 'flame', 'streak', NULL, 7, 70),
+    ('streak-30', 'Unstoppable', 'Stay active 30 days in a row', 'zap', 'streak', NULL, 30, 80)
+ON DUPLICATE KEY UPDATE slug = slug;
+
+-- first-calculation counts every activity kind (NULL event_kind). Existing
+-- databases, seeded when it claimed to need a matrix computation, reword it once:
+--
+-- UPDATE trophies SET description = 'Record your first activity: a matrix computation, practice problem or quiz'
+--     WHERE slug = 'first-calculation';
+
+-- Trophies awarded to users; the primary key makes awards idempotent
+CREATE TABLE IF NOT EXISTS user_trophies (
+    user_id INT NOT NULL,
+    trophy_id INT NOT NULL,
+    awarded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, trophy_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (trophy_id) REFERENCES trophies(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- Progression Schema
+-- =====================================================
+
+-- Append-only XP ledger. Level and total XP are derived from it, and rows with
+-- a ref (quiz attempts, solved problems, streak milestones) are unique so awards are not repeated.
+CREATE TABLE IF NOT EXISTS xp_ledger (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    amount INT NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    ref VARCHAR(100) DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uq_user_reason_ref (user_id, reason, ref),
+    INDEX idx_user_created (user_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Quizzes and practice problems that can be reported for XP. Refs missing
+-- here are rejected, so clients cannot invent XP; question_count bounds the
+-- reported score.
+CREATE TABLE IF NOT EXISTS quizzes (
+    ref VARCHAR(100) PRIMARY KEY,
+    title VARCHAR(200) NOT NULL,
+    question_count INT NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS practice_problems (
+    ref VARCHAR(100) PRIMARY KEY,
+    title VARCHAR(200) NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Seed catalog
+INSERT INTO quizzes (ref, title, question_count) VALUES
+    ('matrix-basics', 'Matrix Basics', 10),
+    ('matrix-multiplication', 'Matrix Multiplication', 10),
+    ('row-reduction', 'Row Reduction', 10),
+    ('determinants', 'Determinants', 8),
+    ('eigenvalues', 'Eigenvalues and Eigenvectors', 10)
+ON DUPLICATE KEY UPDATE ref = ref;
+
+INSERT INTO practice_problems (ref, title) VALUES
+    ('matrices/add-1', 'Add two 2x2 matrices'),
+    ('matrices/add-2', 'Add two 3x3 matrices'),
+    ('matrices/multiply-1', 'Multiply a 2x3 by a 3x2 matrix'),
+    ('matrices/multiply-2', 'Multiply two 3x3 matrices'),
+    ('systems/gaussian-elimination-1', 'Solve a 2x2 system by elimination'),
+    ('systems/gaussian-elimination-2', 'Solve a 3x3 system by elimination'),
+    ('systems/rref-1', 'Reduce a 3x4 matrix to RREF'),
+    ('systems/rref-2', 'Find the rank of a 4x4 matrix'),
+    ('determinants/cofactor-1', 'Expand a 3x3 determinant by cofactors'),
+    ('determinants/inverse-1', 'Invert a 2x2 matrix'),
+    ('eigen/characteristic-1', 'Find the characteristic polynomial of a 2x2 matrix'),
+    ('eigen/eigenvectors-1', 'Find the eigenvectors of a 2x2 matrix')
+ON DUPLICATE KEY UPDATE ref = ref;
+
+
+-- =====================================================
+-- Journal Schema
+-- =====================================================
+
+-- Per-user study notes. body is Markdown; ```matrix fenced blocks hold
+-- Matrix JSON that is re-evaluated whenever the entry is read.
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    title VARCHAR(200) NOT NULL,
+    body MEDIUMTEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_updated (user_id, updated_at),
+    FULLTEXT INDEX idx_search (title, body)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Free-form tags on journal entries (stored lowercase)
+CREATE TABLE IF NOT EXISTS journal_entry_tags (
+    entry_id INT NOT NULL,
+    tag VARCHAR(50) NOT NULL,
+    PRIMARY KEY (entry_id, tag),
+    FOREIGN KEY (entry_id) REFERENCES journal_entries(id) ON DELETE CASCADE,
+    INDEX idx_tag (tag)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- Friends and Study Rooms Schema
+-- =====================================================
+
+-- One row per pair of users; requester_id sent the request
+CREATE TABLE IF NOT EXISTS friendships (
+    requester_id INT NOT NULL,
+    addressee_id INT NOT NULL,
+    status ENUM('pending', 'accepted', 'declined') NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (requester_id, addressee_id),
+    FOREIGN KEY (requester_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (addressee_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_addressee_status (addressee_id, status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Blocks prevent friend requests in either direction
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id INT NOT NULL,
+    blocked_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id),
+    FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- When a pair last got a friend request email; outlives the request so
+-- cancelling and re-sending cannot mail the addressee again
+CREATE TABLE IF NOT EXISTS friend_request_mails (
+    requester_id INT NOT NULL,
+    addressee_id INT NOT NULL,
+    sent_at DATETIME NOT NULL,
+    PRIMARY KEY (requester_id, addressee_id),
+    FOREIGN KEY (requester_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (addressee_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Collaborative rooms; workspace holds the shared matrices as JSON
+CREATE TABLE IF NOT EXISTS study_rooms (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    owner_id INT NOT NULL,
+    workspace JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS study_room_members (
+    room_id INT NOT NULL,
+    user_id INT NOT NULL,
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (room_id, user_id),
+    FOREIGN KEY (room_id) REFERENCES study_rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS study_room_messages (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    room_id INT NOT NULL,
+    user_id INT NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (room_id) REFERENCES study_rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_room_id (room_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- Sessions Schema
+-- =====================================================
+
+-- Server-side login sessions. id is the SHA-256 of the cookie token, so the
+-- raw token only ever exists in the browser.
+CREATE TABLE IF NOT EXISTS sessions (
+    id CHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    user_agent VARCHAR(255) DEFAULT NULL,
+    ip VARCHAR(45) DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_id (user_id),
+    INDEX idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- API Tokens Schema
+-- =====================================================
+
+-- Personal access tokens for programmatic use. Only the SHA-256 of the token
+-- is stored; prefix keeps enough of it for users to recognize their tokens.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    prefix VARCHAR(16) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME DEFAULT NULL,
+    expires_at DATETIME DEFAULT NULL,
+    revoked_at DATETIME DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- Login Identities Schema
+-- =====================================================
+
+-- users.password_hash is NULL for accounts created through a login provider.
+-- Existing databases, where the column was NOT NULL and such accounts got an
+-- empty hash, migrate once:
+--
+-- ALTER TABLE users MODIFY password_hash VARCHAR(255) DEFAULT NULL;
+-- UPDATE users SET password_hash = NULL WHERE password_hash = '';
+
+-- Provider accounts (Google, GitHub, OIDC) linked to users. subject is the
+-- provider's stable account ID; a user links at most one account per provider.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) DEFAULT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at DATETIME DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uniq_provider_subject (provider, subject),
+    UNIQUE KEY uniq_user_provider (user_id, provider)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- Password Reset Schema
+-- =====================================================
+
+-- Single-use password reset tokens. Only the SHA-256 of the emailed token is
+-- stored; used_at is set when the token is consumed or superseded.
+CREATE TABLE IF NOT EXISTS password_resets (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_created (user_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- Email Verification Schema
+-- =====================================================
+
+-- users.email_verified_at is set when the owner follows the emailed link (or
+-- a login provider vouches for the address); verification_sent_at enforces
+-- the resend cooldown. Existing databases add both columns once, treating
+-- accounts created before verification existed as verified:
+--
+-- ALTER TABLE users
+--     ADD COLUMN email_verified_at DATETIME DEFAULT NULL AFTER avatar,
+--     ADD COLUMN verification_sent_at DATETIME DEFAULT NULL AFTER email_verified_at;
+-- UPDATE users SET email_verified_at = created_at;
+
+
+-- =====================================================
+-- Auth Audit Schema
+-- =====================================================
+
+-- Login audit trail. Failed logins also drive throttling: per email (since
+-- the last successful login) and per IP. user_id is NULL for unknown emails.
+CREATE TABLE IF NOT EXISTS auth_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT DEFAULT NULL,
+    email VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    kind VARCHAR(30) NOT NULL,
+    detail VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_email_kind (email, kind, created_at),
+    INDEX idx_ip_kind (ip, kind, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- Two-Factor Authentication Schema
+-- =====================================================
+
+-- TOTP secrets (base32). enabled_at stays NULL until the user confirms a code
+-- from their app; last_used_step blocks replaying a code.
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INT PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    enabled_at DATETIME DEFAULT NULL,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- One-time recovery codes, stored as SHA-256 hashes
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_code (user_id, code_hash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- User Preferences Schema
+-- =====================================================
+
+-- Dashboard settings; users without a row get the column defaults.
+-- streak_reminded_on is the last day a streak reminder was mailed.
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id INT PRIMARY KEY,
+    email_notifications BOOLEAN NOT NULL DEFAULT TRUE,
+    updates BOOLEAN NOT NULL DEFAULT TRUE,
+    newsletter BOOLEAN NOT NULL DEFAULT FALSE,
+    streak_reminders BOOLEAN NOT NULL DEFAULT TRUE,
+    mute BOOLEAN NOT NULL DEFAULT FALSE,
+    stay_signed_in BOOLEAN NOT NULL DEFAULT TRUE,
+    smooth_animations BOOLEAN NOT NULL DEFAULT TRUE,
+    focus_mode BOOLEAN NOT NULL DEFAULT FALSE,
+    streak_reminded_on DATE DEFAULT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- Data Erasure Schema
+-- =====================================================
+
+-- Account erasure queue and record. DELETE /api/me adds a row and erases at
+-- once; a background job retries failures and also picks up rows staff insert
+-- for deletion requests received elsewhere:
+--
+-- INSERT INTO erasure_requests (user_id, requested_at) VALUES (42, UTC_TIMESTAMP());
+--
+-- user_id has no foreign key, since the row outlives the user as proof of
+-- erasure.
+CREATE TABLE IF NOT EXISTS erasure_requests (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    requested_at DATETIME NOT NULL,
+    completed_at DATETIME DEFAULT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(255) DEFAULT NULL,
+    INDEX idx_pending (completed_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+
+-- =====================================================
+-- Roles Schema
+-- =====================================================
+
+-- users.role decides what a user may manage (see roles.go). Existing
+-- databases add the column once; everyone starts as a student and the first
+-- admin is promoted with "g6labs admin promote <email>":
+--
+-- ALTER TABLE users
+--     ADD COLUMN role ENUM('student', 'instructor', 'admin') NOT NULL DEFAULT 'student' AFTER verification_sent_at;
+
+-- =====================================================
+-- Resource Link Checks Schema
+-- =====================================================
+
+-- Latest result of the dead-link checker per resource (see linkcheck.go).
+-- deactivated_at is set while the checker itself has hidden the resource, so
+-- it can show it again once the link works; manual changes clear it.
+CREATE TABLE IF NOT EXISTS resource_link_checks (
+    resource_id INT PRIMARY KEY,
+    status_code SMALLINT DEFAULT NULL,
+    error VARCHAR(255) DEFAULT NULL,
+    latency_ms INT NOT NULL DEFAULT 0,
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    checked_at DATETIME NOT NULL,
+    deactivated_at DATETIME DEFAULT NULL,
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE,
+    INDEX idx_failures (consecutive_failures)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- =====================================================
+-- Resource Clicks Schema
+-- =====================================================
+
+-- One row per click through /r/{id} (see clicks.go). visitor is an HMAC of
+-- the user ID or IP address, never the address itself; counted marks clicks
+-- that incremented resources.view_count after deduplication.
+CREATE TABLE IF NOT EXISTS resource_clicks (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    resource_id INT NOT NULL,
+    user_id INT DEFAULT NULL,
+    visitor CHAR(64) NOT NULL,
+    referrer VARCHAR(255) DEFAULT NULL,
+    counted BOOLEAN NOT NULL,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_dedup (resource_id, visitor, created_at),
+    INDEX idx_created (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- =====================================================
+-- Resource Reviews Schema
+-- =====================================================
+
+-- One rating (1-5) and optional short review per user per resource (see
+-- reviews.go). resources.rating_avg and rating_count cache the aggregates of
+-- visible reviews; existing databases add them once:
+--
+-- ALTER TABLE resources
+--     ADD COLUMN rating_avg DECIMAL(3,2) NOT NULL DEFAULT 0 AFTER view_count,
+--     ADD COLUMN rating_count INT NOT NULL DEFAULT 0 AFTER rating_avg,
+--     ADD INDEX idx_rating (rating_avg, rating_count);
+CREATE TABLE IF NOT EXISTS resource_reviews (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    resource_id INT NOT NULL,
+    user_id INT NOT NULL,
+    rating TINYINT NOT NULL,
+    body VARCHAR(1000) NOT NULL DEFAULT '',
+    status ENUM('visible', 'hidden') NOT NULL DEFAULT 'visible',
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uniq_resource_user (resource_id, user_id),
+    INDEX idx_status_updated (status, updated_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Reports of reviews for moderators; resolved flags are deleted.
+CREATE TABLE IF NOT EXISTS review_flags (
+    review_id INT NOT NULL,
+    user_id INT NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (review_id, user_id),
+    FOREIGN KEY (review_id) REFERENCES resource_reviews(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- =====================================================
+-- Bookmarks Schema
+-- =====================================================
+
+-- Resources saved by a user (see bookmarks.go).
+CREATE TABLE IF NOT EXISTS resource_bookmarks (
+    user_id INT NOT NULL,
+    resource_id INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (user_id, resource_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE,
+    INDEX idx_user_created (user_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Named groups of a user's bookmarks. share_token is set while the
+-- collection can be read by anyone with its link.
+CREATE TABLE IF NOT EXISTS bookmark_collections (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(500) NOT NULL DEFAULT '',
+    share_token VARCHAR(32) DEFAULT NULL UNIQUE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uniq_user_name (user_id, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS bookmark_collection_items (
+    collection_id INT NOT NULL,
+    resource_id INT NOT NULL,
+    added_at DATETIME NOT NULL,
+    PRIMARY KEY (collection_id, resource_id),
+    FOREIGN KEY (collection_id) REFERENCES bookmark_collections(id) ON DELETE CASCADE,
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE,
+    INDEX idx_resource_id (resource_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- =====================================================
+-- Resource Listing Schema
+-- =====================================================
+
+-- GET /api/resources sorts by newest, most viewed or title and pages with
+-- LIMIT/OFFSET (see resources.go). Existing databases add the indexes once:
+--
+-- ALTER TABLE resources
+--     ADD INDEX idx_created_at (created_at),
+--     ADD INDEX idx_view_count (view_count),
+--     ADD INDEX idx_title (title);
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ======== Session Cookies ========
+
+const (
+	sessionCookieName = "g6_session"
+	sessionTTL        = 7 * 24 * time.Hour
+)
+
+// sessionCookieSecure reports whether session cookies carry the Secure flag.
+// It defaults to true; set SESSION_COOKIE_SECURE=false only when serving over
+// plain HTTP on a host other than localhost.
+func sessionCookieSecure() bool {
+	return envOr("SESSION_COOKIE_SECURE", "true") != "false"
+}
+
+// hashSessionToken returns the hex SHA-256 of a session token. Only hashes are
+// stored, so a leaked sessions table cannot be replayed as cookies.
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSessionToken returns a random URL-safe token with 256 bits of entropy.
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// clientIP returns the remote address of r without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startSession creates a session for userID and sets its cookie on w. The
+// lifetime follows the user's "Stay Signed In" preference.
+func startSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	token, err := newSessionToken()
+	if err != nil {
+		return err
+	}
+	ttl, persistent := sessionLifetime(userID)
+	expires := time.Now().Add(ttl)
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	if _, err := db.Exec(
+		"INSERT INTO sessions (id, user_id, expires_at, user_agent, ip) VALUES (?, ?, ?, ?, ?)",
+		hashSessionToken(token), userID, expires.UTC(), userAgent, clientIP(r),
+	); err != nil {
+		return err
+	}
+
+	cookie := &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   sessionCookieSecure(),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if persistent {
+		cookie.Expires = expires
+		cookie.MaxAge = int(ttl.Seconds())
+	}
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// clearSessionCookie tells the browser to drop the session cookie.
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   sessionCookieSecure(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ======== DB Functions ========
+
+// getSessionUser returns the user owning an unexpired session token.
+func getSessionUser(token string) (*User, error) {
+	user := &User{}
+	err := db.QueryRow(`
+        SELECT u.id, u.first_name, u.last_name, u.email, COALESCE(u.avatar, ''), u.email_verified_at IS NOT NULL, u.role
+        FROM sessions s
+        JOIN users u ON u.id = s.user_id
+        WHERE s.id = ? AND s.expires_at > UTC_TIMESTAMP()
+    `, hashSessionToken(token)).Scan(&user.ID, &user.FName, &user.LName, &user.Email, &user.Avatar, &user.EmailVerified, &user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// deleteSession removes the session identified by token.
+func deleteSession(token string) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE id = ?", hashSessionToken(token))
+	return err
+}
+
+// deleteExpiredSessions purges sessions past their expiry.
+func deleteExpiredSessions() error {
+	_, err := db.Exec("DELETE FROM sessions WHERE expires_at <= UTC_TIMESTAMP()")
+	return err
+}
+
+// ======== Middleware ========
+
+type ctxKey int
+
+const authKey ctxKey = iota
+
+// requestAuth describes how the current request authenticated.
+type requestAuth struct {
+	user    *User
+	tokenID int             // non-zero when authenticated by a personal API token
+	scopes  map[string]bool // scopes granted to the token
+	scoped  bool            // a requireScope check passed for this request
+}
+
+// withCurrentUser resolves the credentials of every request and stores the
+// matching user in the request context.
+//
+// A session cookie or an "Authorization: Bearer" API token is accepted.
+// Requests without credentials pass through anonymously and handlers decide
+// whether they need a user; an invalid bearer token is rejected with 401 so
+// scripts notice instead of silently running anonymously.
+func withCurrentUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if token, ok := bearerToken(r); ok {
+			auth, err := getAPITokenAuth(token)
+			if err == sql.ErrNoRows {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid or expired API token"})
+				return
+			}
+			if err != nil {
+				log.Printf("failed to resolve API token: %v", err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to resolve API token"})
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authKey, auth)))
+			return
+		}
+
+		cookie, err := r.Cookie(sessionCookieName)
+		if err != nil || cookie.Value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, err := getSessionUser(cookie.Value)
+		switch {
+		case err == sql.ErrNoRows:
+			// Expired or revoked: make the browser forget it.
+			clearSessionCookie(w)
+		case err != nil:
+			log.Printf("failed to resolve session: %v", err)
+		default:
+			r = r.WithContext(context.WithValue(r.Context(), authKey, &requestAuth{user: user}))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// currentUser returns the user attached by withCurrentUser, or nil.
+//
+// API tokens only identify their user on routes guarded by requireScope, so a
+// token can never reach account endpoints it was not scoped for.
+func currentUser(r *http.Request) *User {
+	auth, _ := r.Context().Value(authKey).(*requestAuth)
+	if auth == nil || (auth.tokenID != 0 && !auth.scoped) {
+		return nil
+	}
+	return auth.user
+}
+
+// isSessionRequest reports whether the request is authenticated by a browser
+// session rather than an API token.
+func isSessionRequest(r *http.Request) bool {
+	auth, _ := r.Context().Value(authKey).(*requestAuth)
+	return auth != nil && auth.tokenID == 0
+}
+
+// requestUserID returns the ID of the logged-in user making the request.
+func requestUserID(r *http.Request) (int, bool) {
+	if user := currentUser(r); user != nil {
+		return user.ID, true
+	}
+	return 0, false
+}
+
+// startSessionCleanup periodically purges expired sessions until the process exits.
+func startSessionCleanup(interval time.Duration) {
+	go func() {
+		for {
+			if err := deleteExpiredSessions(); err != nil {
+				log.Printf("failed to purge expired sessions: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// ======== HTTP Handlers ========
+
+// handleLogout serves POST /api/auth/logout. It revokes the current session
+// and clears its cookie; logging out without a session still succeeds.
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, AuthResponse{Success: false, Message: "use POST"})
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil && strings.TrimSpace(cookie.Value) != "" {
+		if err := deleteSession(cookie.Value); err != nil {
+			writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to log out"})
+			return
+		}
+	}
+	clearSessionCookie(w)
+	writeJSON(w, http.StatusOK, AuthResponse{Success: true, Message: "logged out"})
+}
+
+// handleMe serves /api/me: GET returns the logged-in user, PATCH edits the
+// profile (see handleUpdateProfile) and DELETE deletes the account (see
+// handleDeleteAccount).
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, AuthResponse{Success: false, Message: "use GET, PATCH or DELETE"})
+		return
+	}
+	user := currentUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, AuthResponse{Success: false, Message: "login required"})
+		return
+	}
+	switch r.Method {
+	case http.MethodPatch:
+		handleUpdateProfile(w, r, user)
+	case http.MethodDelete:
+		handleDeleteAccount(w, r, user)
+	default:
+		writeJSON(w, http.StatusOK, AuthResponse{Success: true, Message: "ok", User: user})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRequestUserIDIgnoresClientHeaders verifies that identity only comes from
+// the session middleware, never from headers the browser controls.
+func TestRequestUserIDIgnoresClientHeaders(t *testing.T) {
+	t.Parallel()
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set("X-User-ID", "1")
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: "forged"})
+
+	var gotID int
+	var gotOK bool
+	// With no database, the middleware must pass the request through anonymously.
+	withCurrentUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID, gotOK = requestUserID(r)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	if gotOK || gotID != 0 {
+		t.Errorf("requestUserID() observed = (%d, %v), expected: (0, false)", gotID, gotOK)
+	}
+}
+
+// TestHandleMeRequiresSession verifies /api/me rejects anonymous requests.
+func TestHandleMeRequiresSession(t *testing.T) {
+	t.Parallel()
+	rr := httptest.NewRecorder()
+	handleMe(rr, httptest.NewRequest(http.MethodGet, "/api/me", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, observed: %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+// TestHandleLogoutClearsCookie verifies logout expires the session cookie even
+// without an active session.
+func TestHandleLogoutClearsCookie(t *testing.T) {
+	t.Parallel()
+	rr := httptest.NewRecorder()
+	handleLogout(rr, httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, observed: %d", http.StatusOK, rr.Code)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookieName || cookies[0].MaxAge >= 0 {
+		t.Fatalf("Expected an expired %s cookie, observed: %v", sessionCookieName, cookies)
+	}
+	if !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Errorf("Session cookie must be HttpOnly and SameSite=Lax, observed: %+v", cookies[0])
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ======== Signed Payloads ========
+
+var (
+	signingKeyOnce sync.Once
+	signingKey     []byte
+)
+
+// appSigningKey returns the HMAC key for signed cookies and links.
+//
+// It comes from APP_SECRET. Without it a random key is generated per process,
+// which works for a single instance but invalidates signed values on restart.
+func appSigningKey() []byte {
+	signingKeyOnce.Do(func() {
+		if secret := envOr("APP_SECRET", ""); secret != "" {
+			sum := sha256.Sum256([]byte(secret))
+			signingKey = sum[:]
+			return
+		}
+		log.Println(" APP_SECRET not set; using a random signing key for this process.")
+		signingKey = make([]byte, 32)
+		if _, err := rand.Read(signingKey); err != nil {
+			log.Fatalf("failed to generate signing key: %v", err)
+		}
+	})
+	return signingKey
+}
+
+// signedEnvelope wraps a payload with its purpose and expiry before signing,
+// so a value signed for one use cannot be replayed for another.
+type signedEnvelope struct {
+	Purpose string          `json:"p"`
+	Expires int64           `json:"e"`
+	Data    json.RawMessage `json:"d"`
+}
+
+var (
+	errSignatureInvalid = errors.New("invalid signature")
+	errSignatureExpired = errors.New("signed value expired")
+)
+
+// signPayload serializes v and returns "<payload>.<signature>", both
+// base64url-encoded, valid for ttl and only for purpose.
+func signPayload(purpose string, v any, ttl time.Duration) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	env, err := json.Marshal(signedEnvelope{Purpose: purpose, Expires: time.Now().Add(ttl).Unix(), Data: data})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(env)
+	return payload + "." + signatureOf(payload), nil
+}
+
+// verifyPayload checks a value produced by signPayload for purpose and decodes
+// its payload into v.
+func verifyPayload(purpose, signed string, v any) error {
+	payload, sig, ok := strings.Cut(signed, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signatureOf(payload))) {
+		return errSignatureInvalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return errSignatureInvalid
+	}
+	var env signedEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil || env.Purpose != purpose {
+		return errSignatureInvalid
+	}
+	if time.Now().Unix() > env.Expires {
+		return errSignatureExpired
+	}
+	return json.Unmarshal(env.Data, v)
+}
+
+// signatureOf returns the base64url HMAC-SHA256 of payload.
+func signatureOf(payload string) string {
+	mac := hmac.New(sha256.New, appSigningKey())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
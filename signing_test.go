@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSignPayloadRoundTrip verifies signing, tamper detection, purpose binding and expiry.
+func TestSignPayloadRoundTrip(t *testing.T) {
+	t.Parallel()
+	type payload struct {
+		UserID int `json:"user_id"`
+	}
+
+	signed, err := signPayload("test", payload{UserID: 42}, time.Minute)
+	if err != nil {
+		t.Fatalf("signPayload() error = %v", err)
+	}
+
+	var got payload
+	if err := verifyPayload("test", signed, &got); err != nil || got.UserID != 42 {
+		t.Fatalf("verifyPayload() observed = (%+v, %v), expected: ({UserID:42}, nil)", got, err)
+	}
+
+	tampered := "x" + signed[1:]
+	if err := verifyPayload("test", tampered, &got); !errors.Is(err, errSignatureInvalid) {
+		t.Errorf("tampered value: observed error = %v, expected: %v", err, errSignatureInvalid)
+	}
+	if err := verifyPayload("other", signed, &got); !errors.Is(err, errSignatureInvalid) {
+		t.Errorf("wrong purpose: observed error = %v, expected: %v", err, errSignatureInvalid)
+	}
+	if err := verifyPayload("test", "no-dot", &got); !errors.Is(err, errSignatureInvalid) {
+		t.Errorf("malformed value: observed error = %v, expected: %v", err, errSignatureInvalid)
+	}
+
+	expired, _ := signPayload("test", payload{UserID: 1}, -time.Second)
+	if err := verifyPayload("test", expired, &got); !errors.Is(err, errSignatureExpired) {
+		t.Errorf("expired value: observed error = %v, expected: %v", err, errSignatureExpired)
+	}
+}
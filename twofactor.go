@@ -0,0 +1,500 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// ======== TOTP (RFC 6238) ========
+
+const (
+	totpPeriod = 30 // seconds per time step
+	totpDigits = 6
+	// totpSkew is how many steps before and after now are accepted, to
+	// tolerate clock drift between the server and the user's phone.
+	totpSkew = 1
+
+	totpIssuer         = "G6Labs"
+	recoveryCodeCount  = 10
+	twoFactorPurpose   = "2fa-login"
+	twoFactorChallenge = 5 * time.Minute
+)
+
+// totpEncoding is the base32 alphabet authenticator apps expect, unpadded.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a random 160-bit secret, base32-encoded.
+func newTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// totpCode returns the RFC 4226 HOTP value of key for counter step.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%uint32(math.Pow10(totpDigits)))
+}
+
+// verifyTOTP checks code against secret at now. It returns the matched time
+// step, which must be newer than lastStep so a code cannot be replayed.
+func verifyTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step > lastStep && subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// otpauthURI builds the key URI that authenticator apps scan.
+func otpauthURI(secret, account string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(totpDigits))
+	q.Set("period", strconv.Itoa(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+account) + "?" + q.Encode()
+}
+
+// newRecoveryCodes returns recoveryCodeCount one-time codes like "k3vq-9xz2".
+func newRecoveryCodes() ([]string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, recoveryCodeCount)
+	b := make([]byte, 8)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:4]) + "-" + string(b[4:])
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode makes recovery codes case- and dash-insensitive.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
+
+// ======== Types ========
+
+// TwoFactorStatus is returned by GET /api/me/2fa.
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorEnrollment is returned when enrollment starts. The secret is shown
+// for manual entry; QRCode is a PNG data URL of OTPAuthURI.
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCode     string `json:"qr_code"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code or a recovery code.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorLoginRequest is the JSON payload for POST /api/auth/login/2fa.
+type TwoFactorLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// twoFactorClaim is the signed challenge issued after a correct password.
+type twoFactorClaim struct {
+	UserID int    `json:"uid"`
+	Email  string `json:"email"`
+}
+
+var (
+	errTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	errTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	errTwoFactorNoPending  = errors.New("start enrollment first")
+	errTwoFactorCode       = errors.New("invalid two-factor code")
+)
+
+// ======== DB Functions ========
+
+// twoFactorEnabled reports whether userID has completed 2FA enrollment.
+func twoFactorEnabled(userID int) (bool, error) {
+	var enabled bool
+	err := db.QueryRow("SELECT enabled_at IS NOT NULL FROM user_totp WHERE user_id = ?", userID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return enabled, err
+}
+
+// getTwoFactorStatus returns whether 2FA is on and how many recovery codes remain.
+func getTwoFactorStatus(userID int) (*TwoFactorStatus, error) {
+	status := &TwoFactorStatus{}
+	var err error
+	if status.Enabled, err = twoFactorEnabled(userID); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow(
+		"SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID,
+	).Scan(&status.RecoveryCodesRemaining); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// startTwoFactorEnrollment stores a new pending secret for userID, replacing
+// any earlier pending one.
+func startTwoFactorEnrollment(userID int) (string, error) {
+	enabled, err := twoFactorEnabled(userID)
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		return "", errTwoFactorEnabled
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.Exec(`
+        INSERT INTO user_totp (user_id, secret, enabled_at, last_used_step) VALUES (?, ?, NULL, 0)
+        ON DUPLICATE KEY UPDATE secret = VALUES(secret), enabled_at = NULL, last_used_step = 0
+    `, userID, secret)
+	return secret, err
+}
+
+// replaceRecoveryCodes stores hashes of fresh recovery codes for userID
+// inside tx and returns the codes.
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if _, err := tx.Exec(
+			"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, hashSessionToken(normalizeRecoveryCode(code)),
+		); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// confirmTwoFactorEnrollment enables 2FA once the user proves their app
+// produces valid codes, and returns their recovery codes.
+func confirmTwoFactorEnrollment(userID int, code string) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var secret string
+	var enabled bool
+	err = tx.QueryRow(
+		"SELECT secret, enabled_at IS NOT NULL FROM user_totp WHERE user_id = ? FOR UPDATE", userID,
+	).Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		return nil, errTwoFactorNoPending
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errTwoFactorEnabled
+	}
+	step, ok := verifyTOTP(secret, code, time.Now(), 0)
+	if !ok {
+		return nil, errTwoFactorCode
+	}
+	if _, err := tx.Exec(
+		"UPDATE user_totp SET enabled_at = UTC_TIMESTAMP(), last_used_step = ? WHERE user_id = ?", step, userID,
+	); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// checkSecondFactor consumes a TOTP code or an unused recovery code of userID.
+func checkSecondFactor(userID int, code string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var secret string
+	var lastStep int64
+	err = tx.QueryRow(
+		"SELECT secret, last_used_step FROM user_totp WHERE user_id = ? AND enabled_at IS NOT NULL FOR UPDATE", userID,
+	).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return errTwoFactorNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+
+	if step, ok := verifyTOTP(secret, code, time.Now(), lastStep); ok {
+		if _, err := tx.Exec("UPDATE user_totp SET last_used_step = ? WHERE user_id = ?", step, userID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	result, err := tx.Exec(
+		"UPDATE user_recovery_codes SET used_at = UTC_TIMESTAMP() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		userID, hashSessionToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errTwoFactorCode
+	}
+	return tx.Commit()
+}
+
+// disableTwoFactor removes userID's secret and recovery codes.
+func disableTwoFactor(userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM user_totp WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ======== Login Step ========
+
+// issueTwoFactorChallenge returns a signed, short-lived challenge proving that
+// user passed the first login step.
+func issueTwoFactorChallenge(user *User) (string, error) {
+	return signPayload(twoFactorPurpose, twoFactorClaim{UserID: user.ID, Email: user.Email}, twoFactorChallenge)
+}
+
+// ======== HTTP Handlers ========
+
+// handleTwoFactor serves /api/me/2fa.
+//
+// GET returns the 2FA status. DELETE turns 2FA off and needs a current code
+// or a recovery code in the body.
+func handleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok || !isSessionRequest(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		status, err := getTwoFactorStatus(userID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+
+	case http.MethodDelete:
+		var req TwoFactorCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+			return
+		}
+		if err := checkSecondFactor(userID, req.Code); err != nil {
+			writeTwoFactorError(w, err)
+			return
+		}
+		if err := disableTwoFactor(userID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or DELETE"})
+	}
+}
+
+// handleTwoFactorEnroll serves POST /api/me/2fa/enroll. It creates a pending
+// secret and returns it as an otpauth URI and a QR code to scan.
+func handleTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	user := currentUser(r)
+	if user == nil || !isSessionRequest(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+
+	secret, err := startTwoFactorEnrollment(user.ID)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	uri := otpauthURI(secret, user.Email)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to render QR code"})
+		return
+	}
+	writeJSON(w, http.StatusOK, TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// handleTwoFactorVerify serves POST /api/me/2fa/verify. A valid code from the
+// authenticator app enables 2FA; the recovery codes are returned only here.
+func handleTwoFactorVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	userID, ok := requestUserID(r)
+	if !ok || !isSessionRequest(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "login required"})
+		return
+	}
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	codes, err := confirmTwoFactorEnrollment(userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// handleTwoFactorLogin serves POST /api/auth/login/2fa, the second login step.
+// It takes the challenge returned by /api/auth/login and a TOTP or recovery
+// code, and starts the session. Wrong codes count as failed logins.
+func handleTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, AuthResponse{Success: false, Message: "use POST"})
+		return
+	}
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: "invalid JSON"})
+		return
+	}
+	var claim twoFactorClaim
+	if err := verifyPayload(twoFactorPurpose, req.Challenge, &claim); err != nil {
+		writeJSON(w, http.StatusUnauthorized, AuthResponse{Success: false, Message: "login expired; please log in again"})
+		return
+	}
+
+	email, ip := normalizeLoginEmail(claim.Email), clientIP(r)
+	wait, err := loginRetryAfter(email, ip)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to log in"})
+		return
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		recordAuthEvent(AuthEventLoginBlocked, claim.UserID, email, ip, fmt.Sprintf("second factor, retry_after=%ds", seconds))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		writeJSON(w, http.StatusTooManyRequests, AuthResponse{
+			Success: false,
+			Message: fmt.Sprintf("too many failed login attempts; try again in %d seconds", seconds),
+		})
+		return
+	}
+
+	if err := checkSecondFactor(claim.UserID, req.Code); err != nil {
+		if errors.Is(err, errTwoFactorCode) {
+			recordAuthEvent(AuthEventLoginFailed, claim.UserID, email, ip, "wrong second factor")
+			writeJSON(w, http.StatusUnauthorized, AuthResponse{Success: false, Message: err.Error()})
+			return
+		}
+		if errors.Is(err, errTwoFactorNotEnabled) {
+			writeJSON(w, http.StatusUnauthorized, AuthResponse{Success: false, Message: "login expired; please log in again"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to log in"})
+		return
+	}
+
+	user, err := getUserByEmail(claim.Email)
+	if err != nil || user.ID != claim.UserID {
+		writeJSON(w, http.StatusUnauthorized, AuthResponse{Success: false, Message: "login expired; please log in again"})
+		return
+	}
+	recordAuthEvent(AuthEventLoginSucceeded, user.ID, email, ip, "second factor")
+	if err := startSession(w, r, user.ID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to start session"})
+		return
+	}
+	user.Password = ""
+	writeJSON(w, http.StatusOK, AuthResponse{Success: true, Message: "login successful", User: user})
+}
+
+// writeTwoFactorError maps 2FA errors to HTTP statuses.
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTwoFactorCode):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, errTwoFactorEnabled), errors.Is(err, errTwoFactorNotEnabled), errors.Is(err, errTwoFactorNoPending):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
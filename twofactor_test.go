@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/base32"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTOTPCode verifies the SHA-1 test vectors of RFC 6238, Appendix B,
+// truncated to six digits.
+func TestTOTPCode(t *testing.T) {
+	t.Parallel()
+	key := []byte("12345678901234567890")
+	tests := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range tests {
+		if got := totpCode(key, unix/totpPeriod); got != expected {
+			t.Errorf("totpCode(t=%d) observed = %q, expected: %q", unix, got, expected)
+		}
+	}
+}
+
+// TestVerifyTOTP verifies clock skew tolerance and replay protection.
+func TestVerifyTOTP(t *testing.T) {
+	t.Parallel()
+	key := []byte("12345678901234567890")
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		ok       bool
+	}{
+		{"Current code", totpCode(key, step), 0, true},
+		{"Previous step", totpCode(key, step-1), 0, true},
+		{"Two steps old", totpCode(key, step-2), 0, false},
+		{"Replayed code", totpCode(key, step), step, false},
+		{"Wrong code", "000000", 0, false},
+	}
+	for _, tt := range tests {
+		if _, ok := verifyTOTP(secret, tt.code, now, tt.lastStep); ok != tt.ok {
+			t.Errorf("%s: verifyTOTP() observed = %v, expected: %v", tt.name, ok, tt.ok)
+		}
+	}
+}
+
+// TestOTPAuthURI verifies the key URI carries the secret and issuer.
+func TestOTPAuthURI(t *testing.T) {
+	t.Parallel()
+	u, err := url.Parse(otpauthURI("JBSWY3DPEHPK3PXP", "ada@example.com"))
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/G6Labs:ada@example.com" {
+		t.Errorf("Unexpected URI %q", u)
+	}
+	if u.Query().Get("secret") != "JBSWY3DPEHPK3PXP" || u.Query().Get("issuer") != "G6Labs" {
+		t.Errorf("Unexpected query %q", u.RawQuery)
+	}
+}
+
+// TestNewRecoveryCodes verifies the count, format and uniqueness of recovery codes.
+func TestNewRecoveryCodes(t *testing.T) {
+	t.Parallel()
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatalf("newRecoveryCodes() error = %v", err)
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 9 || c[4] != '-' || seen[c] {
+			t.Errorf("Unexpected recovery code %q", c)
+		}
+		seen[c] = true
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("Expected %d codes, observed: %d", recoveryCodeCount, len(codes))
+	}
+	if normalizeRecoveryCode(" ABCD-efgh ") != "abcdefgh" {
+		t.Errorf("normalizeRecoveryCode() did not ignore case and dashes")
+	}
+}
+
+// TestHandleTwoFactorLoginRejectsBadChallenge verifies the second step needs
+// a challenge issued by the first.
+func TestHandleTwoFactorLoginRejectsBadChallenge(t *testing.T) {
+	t.Parallel()
+	body := `{"challenge":"e30.forged","code":"123456"}`
+	rr := httptest.NewRecorder()
+	handleTwoFactorLogin(rr, httptest.NewRequest(http.MethodPost, "/api/auth/login/2fa", strings.NewReader(body)))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, observed: %d", http.StatusUnauthorized, rr.Code)
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -12,12 +15,14 @@ import (
 // Password carries the stored bcrypt hash when loaded for verification and
 // is omitted from JSON responses.
 type User struct {
-	ID       int    `json:"id"`
-	FName    string `json:"fName"`
-	LName    string `json:"lName"`
-	Password string `json:"password,omitempty"` // omitempty prevents sending in JSON
-	Email    string `json:"email"`
-	Avatar   string `json:"avatar"`
+	ID            int    `json:"id"`
+	FName         string `json:"fName"`
+	LName         string `json:"lName"`
+	Password      string `json:"password,omitempty"` // omitempty prevents sending in JSON
+	Email         string `json:"email"`
+	Avatar        string `json:"avatar"`
+	EmailVerified bool   `json:"emailVerified"` // owner confirmed the address
+	Role          string `json:"role"`          // student, instructor or admin
 }
 
 // hashPassword converts a plaintext password into a bcrypt hash suitable for storage.
@@ -62,19 +67,21 @@ func createUser(fName, lName, email, password string) (*User, error) {
 		FName: fName,
 		LName: lName,
 		Email: email,
+		Role:  RoleStudent,
 	}, nil
 }
 
 // getUserByEmail fetches one user by email and includes the stored password hash
-// in User.Password for login verification.
+// in User.Password for login verification. Accounts created through a login
+// provider have no password and get an empty hash, which never verifies.
 func getUserByEmail(email string) (*User, error) {
 	user := &User{}
 	var passwordHash string
 
 	err := db.QueryRow(
-		"SELECT id, first_name, last_name, email, password_hash, COALESCE(avatar, '') FROM users WHERE email = ?",
+		"SELECT id, first_name, last_name, email, COALESCE(password_hash, ''), COALESCE(avatar, ''), email_verified_at IS NOT NULL, role FROM users WHERE email = ?",
 		email,
-	).Scan(&user.ID, &user.FName, &user.LName, &user.Email, &passwordHash, &user.Avatar)
+	).Scan(&user.ID, &user.FName, &user.LName, &user.Email, &passwordHash, &user.Avatar, &user.EmailVerified, &user.Role)
 
 	if err != nil {
 		return nil, err
@@ -84,50 +91,6 @@ func getUserByEmail(email string) (*User, error) {
 	return user, nil
 }
 
-// updateUserAvatar updates the avatar URL for the user identified by email.
-func updateUserAvatar(email, avatar string) error {
-	_, err := db.Exec("UPDATE users SET avatar = ? WHERE email = ?", avatar, email)
-	return err
-}
-
-// getOrCreateOAuthUser returns the existing user for email or creates one if none
-// exists, which supports first-time Google OAuth logins.
-func getOrCreateOAuthUser(fName, lName, email, avatar string) (*User, error) {
-	user, err := getUserByEmail(email)
-	if err == nil {
-		// Update avatar if it changed.
-		if avatar != "" && user.Avatar != avatar {
-			_ = updateUserAvatar(email, avatar)
-			user.Avatar = avatar
-		}
-		return user, nil
-	}
-	if err != nil && err != sql.ErrNoRows {
-		return nil, err
-	}
-
-	result, err := db.Exec(
-		"INSERT INTO users (first_name, last_name, email, password_hash, avatar) VALUES (?, ?, ?, ?, ?)",
-		fName, lName, email, "", avatar,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-
-	return &User{
-		ID:     int(id),
-		FName:  fName,
-		LName:  lName,
-		Email:  email,
-		Avatar: avatar,
-	}, nil
-}
-
 // API Handlers
 
 // SignupRequest is the expected JSON payload for account creation.
@@ -139,18 +102,23 @@ type SignupRequest struct {
 }
 
 // AuthResponse is the JSON envelope returned by signup and login endpoints.
+// When the account uses two-factor authentication, login answers with
+// TwoFactorRequired and a Challenge to send to /api/auth/login/2fa.
 type AuthResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	User    *User  `json:"user,omitempty"`
+	Success           bool   `json:"success"`
+	Message           string `json:"message"`
+	User              *User  `json:"user,omitempty"`
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	Challenge         string `json:"challenge,omitempty"`
 }
 
-// handleSignup creates a user account from a JSON request body.
+// handleSignup creates a user account from a JSON request body and logs the
+// new user in with a session cookie.
 //
 // Method: POST
 // Responses:
 // - 201: account created
-// - 400: invalid JSON or missing required fields
+// - 400: invalid JSON, missing required fields or a password rejected by the policy
 // - 409: user already exists
 // - 500: server/database error
 func handleSignup(w http.ResponseWriter, r *http.Request) {
@@ -170,6 +138,10 @@ func handleSignup(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: "all fields are required"})
 		return
 	}
+	if err := validateNewPassword(req.Password); err != nil {
+		writeJSON(w, http.StatusBadRequest, AuthResponse{Success: false, Message: err.Error()})
+		return
+	}
 
 	// Check if user already exists
 	_, err := getUserByEmail(req.Email)
@@ -186,13 +158,25 @@ func handleSignup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := startSession(w, r, user.ID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to start session"})
+		return
+	}
+
+	// The account works right away; social features wait for verification.
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	// Return success (don't send password back)
 	userResponse := &User{
-		ID:     user.ID,
-		FName:  user.FName,
-		LName:  user.LName,
-		Email:  user.Email,
-		Avatar: user.Avatar,
+		ID:            user.ID,
+		FName:         user.FName,
+		LName:         user.LName,
+		Email:         user.Email,
+		Avatar:        user.Avatar,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
 	}
 
 	writeJSON(w, http.StatusCreated, AuthResponse{
@@ -208,14 +192,18 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-// handleLogin authenticates a user by email and password.
+// handleLogin authenticates a user by email and password and issues a
+// session cookie.
 //
 // Method: POST
 // Responses:
 // - 200: authentication successful
+// - 202: password accepted; a two-factor code is required (see handleTwoFactorLogin)
 // - 400: invalid JSON
 // - 401: invalid credentials
 // - 405: unsupported HTTP method
+// - 429: too many failed attempts for the account or address (see Retry-After)
+// - 500: session could not be created
 func handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeJSON(w, http.StatusMethodNotAllowed, AuthResponse{Success: false, Message: "use POST"})
@@ -228,27 +216,76 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Throttle before checking the password, so guesses cost no bcrypt work
+	email, ip := normalizeLoginEmail(req.Email), clientIP(r)
+	wait, err := loginRetryAfter(email, ip)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to log in"})
+		return
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		recordAuthEvent(AuthEventLoginBlocked, 0, email, ip, fmt.Sprintf("retry_after=%ds", seconds))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		writeJSON(w, http.StatusTooManyRequests, AuthResponse{
+			Success: false,
+			Message: fmt.Sprintf("too many failed login attempts; try again in %d seconds", seconds),
+		})
+		return
+	}
+
 	// Get user from database
 	user, err := getUserByEmail(req.Email)
 	if err != nil {
 		// User not found
+		recordAuthEvent(AuthEventLoginFailed, 0, email, ip, "unknown email")
 		writeJSON(w, http.StatusUnauthorized, AuthResponse{Success: false, Message: "invalid email or password"})
 		return
 	}
 
 	// Check password
 	if !checkPasswordHash(req.Password, user.Password) {
+		recordAuthEvent(AuthEventLoginFailed, user.ID, email, ip, "wrong password")
 		writeJSON(w, http.StatusUnauthorized, AuthResponse{Success: false, Message: "invalid email or password"})
 		return
 	}
 
+	// With 2FA on, the password only earns a challenge for the second step
+	enabled, err := twoFactorEnabled(user.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to log in"})
+		return
+	}
+	if enabled {
+		challenge, err := issueTwoFactorChallenge(user)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to log in"})
+			return
+		}
+		writeJSON(w, http.StatusAccepted, AuthResponse{
+			Success:           false,
+			Message:           "two-factor code required",
+			TwoFactorRequired: true,
+			Challenge:         challenge,
+		})
+		return
+	}
+	recordAuthEvent(AuthEventLoginSucceeded, user.ID, email, ip, "")
+
+	if err := startSession(w, r, user.ID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, AuthResponse{Success: false, Message: "failed to start session"})
+		return
+	}
+
 	// Return success (don't send password back)
 	userResponse := &User{
-		ID:     user.ID,
-		FName:  user.FName,
-		LName:  user.LName,
-		Email:  user.Email,
-		Avatar: user.Avatar,
+		ID:            user.ID,
+		FName:         user.FName,
+		LName:         user.LName,
+		Email:         user.Email,
+		Avatar:        user.Avatar,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
 	}
 
 	writeJSON(w, http.StatusOK, AuthResponse{